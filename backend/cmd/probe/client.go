@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/abstractmelon/is-site-live/internal/models"
+)
+
+// resultBatchSize is the most results pushed at once, the limit of the server
+const resultBatchSize = 1000
+
+// errUnauthorized is returned when the server rejects a token, e.g. because
+// the probe was deleted
+var errUnauthorized = errors.New("token rejected by the server")
+
+// client calls the probe API of the server
+type client struct {
+	baseURL string
+	http    *http.Client
+}
+
+// newClient creates a client of the server at baseURL
+func newClient(baseURL string) *client {
+	return &client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		http:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// register registers the probe with the agent token, returning the token of
+// the probe
+func (c *client) register(ctx context.Context, agentToken string, registration models.ProbeRegistration) (*models.RegisteredProbe, error) {
+	var probe models.RegisteredProbe
+	if err := c.do(ctx, http.MethodPost, "/probe/register", agentToken, registration, &probe); err != nil {
+		return nil, err
+	}
+	return &probe, nil
+}
+
+// getChecks gets the sites the probe checks
+func (c *client) getChecks(ctx context.Context, token string) (*models.ProbeAssignment, error) {
+	var assignment models.ProbeAssignment
+	if err := c.do(ctx, http.MethodGet, "/probe/checks", token, nil, &assignment); err != nil {
+		return nil, err
+	}
+	return &assignment, nil
+}
+
+// pushResults sends check results in batches, returning how many the server
+// recorded
+func (c *client) pushResults(ctx context.Context, token string, results []models.ProbeResult) (int, error) {
+	accepted := 0
+	for start := 0; start < len(results); start += resultBatchSize {
+		end := min(start+resultBatchSize, len(results))
+		var response models.ProbeResultsAccepted
+		err := c.do(ctx, http.MethodPost, "/probe/results", token, models.ProbeResults{Results: results[start:end]}, &response)
+		if err != nil {
+			return accepted, err
+		}
+		accepted += response.Accepted
+	}
+	return accepted, nil
+}
+
+// do sends a request with a bearer token and decodes the JSON response into
+// out. body is sent as JSON unless nil.
+func (c *client) do(ctx context.Context, method, path, token string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return errUnauthorized
+	}
+	if resp.StatusCode != http.StatusOK {
+		// Report the error message of the server
+		var apiError struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiError)
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, apiError.Error)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,192 @@
+// Command probe is a remote probe agent. It registers with the server, then
+// checks the sites it is assigned from where it runs and pushes the results,
+// tagged with its location.
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/abstractmelon/is-site-live/internal/checker"
+	"github.com/abstractmelon/is-site-live/internal/config"
+	"github.com/abstractmelon/is-site-live/internal/logging"
+	"github.com/abstractmelon/is-site-live/internal/models"
+)
+
+// retryDelay is how long the probe waits after failing to reach the server
+const retryDelay = 10 * time.Second
+
+// probe checks sites on behalf of the server
+type probe struct {
+	config  *config.ProbeConfig
+	server  *client
+	checker *http.Client
+	token   string // token of the probe, empty until registered
+}
+
+func main() {
+	// Load configuration
+	cfg, err := config.LoadProbe()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	// Set up logging before anything else logs
+	if err := logging.Setup(cfg.Logging); err != nil {
+		log.Fatalf("Failed to set up logging: %v", err)
+	}
+
+	p := &probe{
+		config:  cfg,
+		server:  newClient(cfg.ServerURL),
+		checker: checker.NewClient(),
+	}
+
+	// Keep the token of an earlier run, as the name can't be registered again
+	token, err := os.ReadFile(cfg.TokenFile)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Fatalf("Failed to read the probe token: %v", err)
+	}
+	p.token = strings.TrimSpace(string(token))
+
+	// Check sites until interrupted
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	slog.Info("Probe started", "name", cfg.Name, "location", cfg.Location, "server", cfg.ServerURL)
+	p.run(ctx)
+	slog.Info("Probe exited properly")
+}
+
+// run checks the assigned sites every interval until ctx is done
+func (p *probe) run(ctx context.Context) {
+	for {
+		start := time.Now()
+		interval, err := p.round(ctx)
+		if err != nil && ctx.Err() == nil {
+			slog.Error("Error running checks", "error", err)
+			interval = retryDelay
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(start.Add(interval))):
+		}
+	}
+}
+
+// round registers the probe if needed, then checks the assigned sites once
+// and pushes the results, returning the check interval
+func (p *probe) round(ctx context.Context) (time.Duration, error) {
+	if p.token == "" {
+		if err := p.register(ctx); err != nil {
+			return 0, err
+		}
+	}
+
+	assignment, err := p.server.getChecks(ctx, p.token)
+	if errors.Is(err, errUnauthorized) {
+		// Register again on the next round
+		p.token = ""
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	results := p.checkAll(ctx, assignment.Checks)
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+
+	accepted, err := p.server.pushResults(ctx, p.token, results)
+	if errors.Is(err, errUnauthorized) {
+		p.token = ""
+	}
+	if err != nil {
+		return 0, err
+	}
+	slog.Debug("Pushed results", "results", len(results), "accepted", accepted)
+
+	return time.Duration(assignment.Interval) * time.Second, nil
+}
+
+// register registers the probe, saving the token it gets. A name that is
+// already registered is refused until an admin deletes the probe.
+func (p *probe) register(ctx context.Context) error {
+	registered, err := p.server.register(ctx, p.config.AgentToken, models.ProbeRegistration{
+		Name:     p.config.Name,
+		Location: p.config.Location,
+	})
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(p.config.TokenFile, []byte(registered.Token+"\n"), 0o600); err != nil {
+		// Carry on, the probe only has to be deleted and registered again
+		// after a restart
+		slog.Error("Error saving the probe token", "file", p.config.TokenFile, "error", err)
+	}
+	p.token = registered.Token
+	slog.Info("Registered with the server", "probe_id", registered.ID)
+	return nil
+}
+
+// checkAll checks the sites with the configured number of workers
+func (p *probe) checkAll(ctx context.Context, checks []models.ProbeCheck) []models.ProbeResult {
+	queue := make(chan models.ProbeCheck)
+	results := make([]models.ProbeResult, 0, len(checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for i := 0; i < p.config.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for check := range queue {
+				result := p.check(ctx, check)
+				mu.Lock()
+				results = append(results, result)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	// Stop queueing when interrupted, the running checks are cancelled
+	for _, check := range checks {
+		if ctx.Err() != nil {
+			break
+		}
+		queue <- check
+	}
+	close(queue)
+	wg.Wait()
+
+	return results
+}
+
+// check checks a site with the same code as the server
+func (p *probe) check(ctx context.Context, check models.ProbeCheck) models.ProbeResult {
+	result := checker.Check(ctx, p.checker, check.URL, check.TracePropagation)
+	slog.Debug("Site checked", "site_id", check.SiteID, "up", result.IsUp,
+		"status_code", result.StatusCode, "response_time_ms", result.ResponseTime, "error", result.ErrorMessage)
+
+	return models.ProbeResult{
+		SiteID:        check.SiteID,
+		StatusCode:    result.StatusCode,
+		ResponseTime:  result.ResponseTime,
+		IsUp:          result.IsUp,
+		ErrorMessage:  result.ErrorMessage,
+		CheckedAt:     time.Now(),
+		CertExpiresAt: result.CertExpiresAt,
+	}
+}
@@ -2,16 +2,29 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
+	_ "time/tzdata" // on-call schedules need timezone data even on minimal images
 
 	"github.com/abstractmelon/is-site-live/internal/api"
 	"github.com/abstractmelon/is-site-live/internal/config"
 	"github.com/abstractmelon/is-site-live/internal/database"
+	"github.com/abstractmelon/is-site-live/internal/logging"
+	"github.com/abstractmelon/is-site-live/internal/metrics"
 	"github.com/abstractmelon/is-site-live/internal/monitoring"
+	"github.com/abstractmelon/is-site-live/internal/storage"
+	"github.com/abstractmelon/is-site-live/internal/storage/postgres"
+	"github.com/abstractmelon/is-site-live/internal/storage/sqlite"
+	"github.com/abstractmelon/is-site-live/internal/tracing"
+	"github.com/abstractmelon/is-site-live/internal/utils"
 )
 
 func main() {
@@ -21,42 +34,92 @@ func main() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
-	// Connect to database
-	db, err := database.Connect(cfg.Database)
+	// Set up logging before anything else logs
+	if err := logging.Setup(cfg.Logging); err != nil {
+		log.Fatalf("Failed to set up logging: %v", err)
+	}
+
+	// Make sure the email templates are valid before sending any alerts
+	if err := utils.CheckEmailTemplates(cfg.SMTP.TemplateDir); err != nil {
+		fatal("Failed to load email templates", err)
+	}
+
+	// Export traces if an OTLP endpoint is configured
+	shutdownTracing, err := tracing.Setup(cfg.Tracing)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		fatal("Failed to set up tracing", err)
 	}
-	defer db.Close()
 
-	// Run database migrations
-	if err := database.Migrate(db); err != nil {
-		log.Fatalf("Failed to run database migrations: %v", err)
+	// Open the storage backend
+	var store *storage.Store
+	var db *database.DB
+	switch cfg.Database.Driver {
+	case storage.DriverPostgres:
+		db, err = database.Connect(cfg.Database)
+		if err != nil {
+			fatal("Failed to connect to database", err)
+		}
+
+		// Run the migrate subcommand instead of the server if requested
+		if len(os.Args) > 1 && os.Args[1] == "migrate" {
+			err := runMigrateCommand(db, os.Args[2:])
+			db.Close()
+			if err != nil {
+				fatal("Migration failed", err)
+			}
+			return
+		}
+
+		// Run database migrations
+		if err := database.Migrate(db); err != nil {
+			fatal("Failed to run database migrations", err)
+		}
+
+		store = postgres.New(db, cfg.Monitoring.MaxCheckGap())
+	case storage.DriverSQLite:
+		if len(os.Args) > 1 && os.Args[1] == "migrate" {
+			slog.Error("The migrate command is only available with PostgreSQL")
+			os.Exit(1)
+		}
+
+		store, err = sqlite.Open(cfg.Database.SQLitePath, cfg.Monitoring.MaxCheckGap())
+		if err != nil {
+			fatal("Failed to open SQLite database", err)
+		}
+		slog.Warn("Using SQLite database, incidents, alerts, on-call schedules, escalation policies, digests, rollups and the history, histogram, daily uptime and notification endpoints need PostgreSQL and are disabled",
+			"path", cfg.Database.SQLitePath)
+		warnPostgresOnlySettings(cfg)
+	default:
+		slog.Error("Unknown database driver, expected postgres or sqlite", "driver", cfg.Database.Driver)
+		os.Exit(1)
 	}
+	defer store.Close()
 
 	// Create monitoring service
-	monitoringService := monitoring.NewService(db)
+	monitoringService := monitoring.NewService(store, db, cfg)
+	metrics.Registry.MustRegister(monitoringService.MetricsCollector())
 
 	// Start the monitoring worker pool
 	monitoringService.StartWorkerPool(cfg.Monitoring.Workers, cfg.Monitoring.Interval)
 
 	// Create and setup API server
-	server := api.NewServer(cfg, db, monitoringService)
+	server := api.NewServer(cfg, store, db, monitoringService)
 
 	// Start server in a goroutine
 	go func() {
-		if err := server.Start(); err != nil {
-			log.Fatalf("Failed to start server: %v", err)
+		if err := server.Start(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fatal("Failed to start server", err)
 		}
 	}()
 
-	log.Printf("Server started on %s", cfg.Server.Address)
+	slog.Info("Server started", "address", cfg.Server.Address)
 
 	// Wait for interrupt signal to gracefully shutdown the server
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
-	log.Println("Shutting down server...")
+	slog.Info("Shutting down server")
 
 	// Create a deadline for the shutdown
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -64,11 +127,71 @@ func main() {
 
 	// Shutdown the server
 	if err := server.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+		fatal("Server forced to shutdown", err)
 	}
 
 	// Stop the monitoring service
 	monitoringService.Stop()
 
-	log.Println("Server exited properly")
+	// Send the remaining spans
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Error("Failed to flush traces", "error", err)
+	}
+
+	slog.Info("Server exited properly")
+}
+
+// warnPostgresOnlySettings warns about settings of features that are disabled
+// without PostgreSQL, so they aren't silently ignored
+func warnPostgresOnlySettings(cfg *config.Config) {
+	if cfg.SMTP.Host != "" {
+		slog.Warn("SMTP is configured, but email alerts and digests need PostgreSQL and won't be sent")
+	}
+	if cfg.Monitoring.Retention > 0 {
+		slog.Warn("CHECK_RETENTION_DAYS is set, but retention needs PostgreSQL and raw checks are kept forever")
+	}
+}
+
+// fatal logs an error and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// runMigrateCommand handles "server migrate [status|up|down [steps]]"
+func runMigrateCommand(db *database.DB, args []string) error {
+	command := "status"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "status":
+		statuses, err := database.GetMigrationStatus(db)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = "applied " + status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%s\t%s\n", status.Version, status.Name, applied)
+		}
+		return nil
+	case "up":
+		return database.Migrate(db)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n <= 0 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+			steps = n
+		}
+		return database.MigrateDown(db, steps)
+	default:
+		return fmt.Errorf("unknown migrate command %q, expected status, up or down", command)
+	}
 }
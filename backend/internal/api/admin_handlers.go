@@ -0,0 +1,46 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/abstractmelon/is-site-live/internal/monitoring"
+	"github.com/gin-gonic/gin"
+)
+
+// getNotificationStatus gets the state of the notification outbox
+func (s *Server) getNotificationStatus(c *gin.Context) {
+	status, err := s.monitoringService.GetOutboxStatus()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get notification status"})
+		return
+	}
+
+	// Return status
+	c.JSON(http.StatusOK, status)
+}
+
+// retryNotification puts a dead-lettered notification back in the queue
+func (s *Server) retryNotification(c *gin.Context) {
+	// Get notification ID from URL
+	messageID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notification ID"})
+		return
+	}
+
+	// Queue the notification again
+	message, err := s.monitoringService.RetryOutboxMessage(messageID)
+	if errors.Is(err, monitoring.ErrOutboxMessageNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Dead-lettered notification not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retry notification"})
+		return
+	}
+
+	// Return notification
+	c.JSON(http.StatusOK, message)
+}
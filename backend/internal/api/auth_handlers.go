@@ -1,11 +1,13 @@
 package api
 
 import (
-	"context"
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/abstractmelon/is-site-live/internal/auth"
 	"github.com/abstractmelon/is-site-live/internal/models"
+	"github.com/abstractmelon/is-site-live/internal/storage"
 	"github.com/gin-gonic/gin"
 )
 
@@ -19,20 +21,6 @@ func (s *Server) register(c *gin.Context) {
 		return
 	}
 
-	// Check if username already exists
-	var count int
-	err := s.db.Pool.QueryRow(context.Background(), `
-		SELECT COUNT(*) FROM users WHERE username = $1
-	`, registration.Username).Scan(&count)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check username"})
-		return
-	}
-	if count > 0 {
-		c.JSON(http.StatusConflict, gin.H{"error": "Username already exists"})
-		return
-	}
-
 	// Hash password
 	passwordHash, err := models.HashPassword(registration.Password)
 	if err != nil {
@@ -41,18 +29,11 @@ func (s *Server) register(c *gin.Context) {
 	}
 
 	// Create user
-	var user models.User
-	err = s.db.Pool.QueryRow(context.Background(), `
-		INSERT INTO users (username, password_hash, email)
-		VALUES ($1, $2, $3)
-		RETURNING id, username, email, created_at, updated_at
-	`, registration.Username, passwordHash, registration.Email).Scan(
-		&user.ID,
-		&user.Username,
-		&user.Email,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
+	user, err := s.store.Users.Create(c.Request.Context(), registration.Username, passwordHash, registration.Email)
+	if errors.Is(err, storage.ErrConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Username already exists"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
 		return
@@ -83,19 +64,7 @@ func (s *Server) login(c *gin.Context) {
 	}
 
 	// Get user by username
-	var user models.User
-	err := s.db.Pool.QueryRow(context.Background(), `
-		SELECT id, username, password_hash, email, created_at, updated_at
-		FROM users
-		WHERE username = $1
-	`, login.Username).Scan(
-		&user.ID,
-		&user.Username,
-		&user.PasswordHash,
-		&user.Email,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
+	user, err := s.store.Users.GetByUsername(c.Request.Context(), login.Username)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
 		return
@@ -131,18 +100,7 @@ func (s *Server) getCurrentUser(c *gin.Context) {
 	}
 
 	// Get user from database
-	var user models.User
-	err := s.db.Pool.QueryRow(context.Background(), `
-		SELECT id, username, email, created_at, updated_at
-		FROM users
-		WHERE id = $1
-	`, userID).Scan(
-		&user.ID,
-		&user.Username,
-		&user.Email,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
+	user, err := s.store.Users.Get(c.Request.Context(), userID.(int))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
 		return
@@ -163,18 +121,38 @@ func (s *Server) updateUser(c *gin.Context) {
 
 	// Bind request body
 	var update struct {
-		Email    *string `json:"email"`
-		Password *string `json:"password"`
+		Email           *string `json:"email"`
+		Password        *string `json:"password"`
+		DigestFrequency *string `json:"digest_frequency" binding:"omitempty,oneof=none daily weekly"`
+		Timezone        *string `json:"timezone"`
 	}
 	if err := c.ShouldBindJSON(&update); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Update user
-	var user models.User
-	var err error
+	// Validate timezone
+	if update.Timezone != nil {
+		if _, err := time.LoadLocation(*update.Timezone); err != nil || *update.Timezone == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid timezone"})
+			return
+		}
+	}
 
+	// Generate an unsubscribe token in case the user opts in to digests
+	unsubscribeToken, err := auth.GenerateRandomToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate unsubscribe token"})
+		return
+	}
+
+	// Update user
+	userUpdate := storage.UserUpdate{
+		Email:            update.Email,
+		DigestFrequency:  update.DigestFrequency,
+		Timezone:         update.Timezone,
+		UnsubscribeToken: &unsubscribeToken,
+	}
 	if update.Password != nil {
 		// Hash new password
 		passwordHash, err := models.HashPassword(*update.Password)
@@ -182,36 +160,10 @@ func (s *Server) updateUser(c *gin.Context) {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
 			return
 		}
-
-		// Update user with new password
-		err = s.db.Pool.QueryRow(context.Background(), `
-			UPDATE users
-			SET password_hash = $1, email = COALESCE($2, email), updated_at = NOW()
-			WHERE id = $3
-			RETURNING id, username, email, created_at, updated_at
-		`, passwordHash, update.Email, userID).Scan(
-			&user.ID,
-			&user.Username,
-			&user.Email,
-			&user.CreatedAt,
-			&user.UpdatedAt,
-		)
-	} else {
-		// Update user without changing password
-		err = s.db.Pool.QueryRow(context.Background(), `
-			UPDATE users
-			SET email = COALESCE($1, email), updated_at = NOW()
-			WHERE id = $2
-			RETURNING id, username, email, created_at, updated_at
-		`, update.Email, userID).Scan(
-			&user.ID,
-			&user.Username,
-			&user.Email,
-			&user.CreatedAt,
-			&user.UpdatedAt,
-		)
+		userUpdate.PasswordHash = &passwordHash
 	}
 
+	user, err := s.store.Users.Update(c.Request.Context(), userID.(int), userUpdate)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
 		return
@@ -227,54 +179,33 @@ func (s *Server) getUserProfile(c *gin.Context) {
 	username := c.Param("username")
 
 	// Get user from database
-	var user models.User
-	err := s.db.Pool.QueryRow(context.Background(), `
-		SELECT id, username, created_at
-		FROM users
-		WHERE username = $1
-	`, username).Scan(
-		&user.ID,
-		&user.Username,
-		&user.CreatedAt,
-	)
+	user, err := s.store.Users.GetByUsername(c.Request.Context(), username)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
 
 	// Get user's sites
-	rows, err := s.db.Pool.Query(context.Background(), `
-		SELECT id, user_id, name, url, created_at, updated_at
-		FROM sites
-		WHERE user_id = $1
-	`, user.ID)
+	sites, err := s.store.Sites.ListByUser(c.Request.Context(), user.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user's sites"})
 		return
 	}
-	defer rows.Close()
 
-	var sites []models.Site
-	for rows.Next() {
-		var site models.Site
-		err := rows.Scan(
-			&site.ID,
-			&site.UserID,
-			&site.Name,
-			&site.URL,
-			&site.CreatedAt,
-			&site.UpdatedAt,
-		)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan site"})
-			return
-		}
-		sites = append(sites, site)
+	// Add the current status and daily uptime bars
+	sitesWithStatus, err := s.siteSummaries(sites)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get site status"})
+		return
 	}
 
-	// Return user profile
+	// Return user profile, leaving out private fields
 	c.JSON(http.StatusOK, gin.H{
-		"user":  user.ToResponse(),
-		"sites": sites,
+		"user": models.UserResponse{
+			ID:        user.ID,
+			Username:  user.Username,
+			CreatedAt: user.CreatedAt,
+		},
+		"sites": sitesWithStatus,
 	})
 }
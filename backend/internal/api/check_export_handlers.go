@@ -0,0 +1,274 @@
+package api
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/abstractmelon/is-site-live/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// Check export settings
+const (
+	defaultExportPeriod = 30 * 24 * time.Hour // period exported without from and to
+	exportFlushEvery    = 1000                // rows written between flushes
+)
+
+// checkExportColumns are the columns of a check CSV export
+var checkExportColumns = []string{"checked_at", "is_up", "status_code", "response_time", "error_message", "location"}
+
+// exportChecksCSV handles streaming the raw checks of a site as CSV
+func (s *Server) exportChecksCSV(c *gin.Context) {
+	s.exportChecks(c, "csv")
+}
+
+// exportChecksNDJSON handles streaming the raw checks of a site as
+// newline-delimited JSON
+func (s *Server) exportChecksNDJSON(c *gin.Context) {
+	s.exportChecks(c, "ndjson")
+}
+
+// exportChecks streams the raw checks of a site owned by the current user
+// between optional from and to times (RFC 3339, defaulting to the last 30
+// days). Checks older than the retention period are no longer available.
+func (s *Server) exportChecks(c *gin.Context, format string) {
+	// Get site, checking it belongs to the user
+	site, ok := s.getOwnedSite(c)
+	if !ok {
+		return
+	}
+
+	// Get period from query
+	to := time.Now()
+	if value := c.Query("to"); value != "" {
+		var err error
+		to, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to time, expected RFC 3339"})
+			return
+		}
+	}
+	from := to.Add(-defaultExportPeriod)
+	if value := c.Query("from"); value != "" {
+		var err error
+		from, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from time, expected RFC 3339"})
+			return
+		}
+	}
+	if !from.Before(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return
+	}
+
+	// Start the download
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="site-%d-checks.%s"`, site.ID, format))
+	var write func(check models.Check) error
+	var flush func() error
+	switch format {
+	case "csv":
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		writer := csv.NewWriter(c.Writer)
+		write = func(check models.Check) error {
+			return writer.Write([]string{
+				check.CheckedAt.UTC().Format(time.RFC3339Nano),
+				strconv.FormatBool(check.IsUp),
+				strconv.Itoa(check.StatusCode),
+				strconv.Itoa(check.ResponseTime),
+				check.ErrorMessage,
+				check.Location,
+			})
+		}
+		flush = func() error {
+			writer.Flush()
+			return writer.Error()
+		}
+		if err := writer.Write(checkExportColumns); err != nil {
+			return
+		}
+	default:
+		c.Header("Content-Type", "application/x-ndjson")
+		encoder := json.NewEncoder(c.Writer)
+		write = func(check models.Check) error {
+			return encoder.Encode(check)
+		}
+		flush = func() error {
+			return nil
+		}
+	}
+	c.Status(http.StatusOK)
+
+	// Stream the checks, flushing regularly so the client receives them as
+	// they are read
+	rows := 0
+	err := s.store.Checks.Stream(c.Request.Context(), site.ID, from, to, func(check models.Check) error {
+		if err := write(check); err != nil {
+			return err
+		}
+		if rows++; rows%exportFlushEvery == 0 {
+			if err := flush(); err != nil {
+				return err
+			}
+			c.Writer.Flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error exporting checks", "site_id", site.ID, "error", err)
+		abortStream(c)
+	}
+}
+
+// exportSLAReportCSV handles exporting the monthly SLA report of a site as
+// CSV
+func (s *Server) exportSLAReportCSV(c *gin.Context) {
+	s.exportSLAReport(c, "csv")
+}
+
+// exportSLAReportJSON handles exporting the monthly SLA report of a site as
+// JSON
+func (s *Server) exportSLAReportJSON(c *gin.Context) {
+	s.exportSLAReport(c, "json")
+}
+
+// exportSLAReport exports the daily uptime of a site owned by the current
+// user for a month in the user's timezone. The month query parameter
+// (YYYY-MM) defaults to the previous month.
+func (s *Server) exportSLAReport(c *gin.Context, format string) {
+	// Get site, checking it belongs to the user
+	site, ok := s.getOwnedSite(c)
+	if !ok {
+		return
+	}
+
+	// Get the owner's timezone
+	user, err := s.store.Users.Get(context.Background(), site.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+	loc, err := time.LoadLocation(user.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	// Get month from query
+	now := time.Now().In(loc)
+	month := time.Date(now.Year(), now.Month()-1, 1, 0, 0, 0, 0, loc)
+	if value := c.Query("month"); value != "" {
+		month, err = time.ParseInLocation("2006-01", value, loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid month, expected YYYY-MM"})
+			return
+		}
+		if month.After(now) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Month is in the future"})
+			return
+		}
+	}
+
+	// Build report
+	report, err := s.monitoringService.GetSLAReport(*site, month.Year(), month.Month(), loc)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build SLA report"})
+		return
+	}
+
+	// Return report as a download
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="site-%d-sla-%s.%s"`, site.ID, report.Month, format))
+	if format == "json" {
+		c.JSON(http.StatusOK, report)
+		return
+	}
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Status(http.StatusOK)
+	writer := csv.NewWriter(c.Writer)
+	writer.Write([]string{
+		"date", "total_checks", "successful_checks", "uptime_percentage", "average_response_time",
+		"time_weighted_uptime_percentage", "down_seconds", "no_data_seconds",
+	})
+	for _, day := range report.Days {
+		writer.Write(slaReportRow(day))
+	}
+	writer.Write(slaReportRow(models.SLAReportDay{
+		Date:                "total",
+		TotalChecks:         report.TotalChecks,
+		SuccessfulChecks:    report.SuccessfulChecks,
+		UptimePercentage:    report.UptimePercentage,
+		AverageResponseTime: report.AverageResponseTime,
+		TimeWeightedUptime:  report.TimeWeightedUptime,
+		DownSeconds:         report.DownSeconds,
+		NoDataSeconds:       report.NoDataSeconds,
+	}))
+	writer.Flush()
+}
+
+// slaReportRow formats a row of an SLA report CSV, leaving the uptime empty
+// when there is no data
+func slaReportRow(day models.SLAReportDay) []string {
+	return []string{
+		day.Date,
+		strconv.Itoa(day.TotalChecks),
+		strconv.Itoa(day.SuccessfulChecks),
+		formatPercentage(day.UptimePercentage),
+		strconv.Itoa(day.AverageResponseTime),
+		formatPercentage(day.TimeWeightedUptime),
+		strconv.FormatInt(day.DownSeconds, 10),
+		strconv.FormatInt(day.NoDataSeconds, 10),
+	}
+}
+
+// formatPercentage formats an optional percentage for CSV
+func formatPercentage(percentage *float64) string {
+	if percentage == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*percentage, 'f', 3, 64)
+}
+
+// getOwnedSite gets the site in the URL if it belongs to the current user,
+// otherwise it responds with an error
+func (s *Server) getOwnedSite(c *gin.Context) (*models.Site, bool) {
+	// Get user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return nil, false
+	}
+
+	// Get site ID from URL
+	siteID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid site ID"})
+		return nil, false
+	}
+
+	// Get site from database
+	site, err := s.store.Sites.Get(c.Request.Context(), siteID)
+	if err != nil || site.UserID != userID.(int) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Site not found"})
+		return nil, false
+	}
+
+	return site, true
+}
+
+// abortStream aborts a response that failed after it started, so the client
+// sees an incomplete download rather than a file that looks complete. What
+// was written is flushed, then net/http closes the connection, or resets the
+// stream on HTTP/2, where connections can't be hijacked. It doesn't return.
+func abortStream(c *gin.Context) {
+	_ = http.NewResponseController(c.Writer).Flush()
+	panic(http.ErrAbortHandler)
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"html/template"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// confirmationTemplate is the page links in emails lead to. Mail security
+// scanners and link prefetchers open every link in an email, so following a
+// link never changes anything: the page's form does, with a POST.
+var confirmationTemplate = template.Must(template.New("confirmation").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{.Title}}</title>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{.Message}}</p>
+<form method="post" action="{{.Action}}">
+<button type="submit">{{.Button}}</button>
+</form>
+</body>
+</html>
+`))
+
+// confirmation is the content of a confirmation page
+type confirmation struct {
+	Title   string
+	Message string
+	Button  string
+	Action  string // URL the form posts to, including the link's token
+}
+
+// renderConfirmation writes a confirmation page
+func renderConfirmation(c *gin.Context, page confirmation) {
+	// Keep the token in the URL out of the Referer of anything the page loads
+	c.Header("Referrer-Policy", "no-referrer")
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(http.StatusOK)
+	if err := confirmationTemplate.Execute(c.Writer, page); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error rendering confirmation page", "error", err)
+	}
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/abstractmelon/is-site-live/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// unsubscribeDigestPage serves the page the unsubscribe link in digest
+// emails leads to, which asks to confirm. Mail scanners open every link, so
+// the link itself must not unsubscribe.
+func (s *Server) unsubscribeDigestPage(c *gin.Context) {
+	// Get token from URL
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing unsubscribe token"})
+		return
+	}
+
+	// Check the token exists
+	var found bool
+	err := s.db.Pool.QueryRow(c.Request.Context(), `
+		SELECT EXISTS (SELECT 1 FROM users WHERE digest_unsubscribe_token = $1)
+	`, token).Scan(&found)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check unsubscribe token"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invalid unsubscribe token"})
+		return
+	}
+
+	renderConfirmation(c, confirmation{
+		Title:   "Unsubscribe from digests",
+		Message: "Stop receiving digest emails? You can turn them back on in your settings.",
+		Button:  "Unsubscribe",
+		Action:  "unsubscribe?token=" + url.QueryEscape(token),
+	})
+}
+
+// unsubscribeDigest turns off digest emails for the user owning the token.
+// It is posted from the confirmation page, and is also the one-click POST
+// mail clients send for the List-Unsubscribe header (RFC 8058).
+func (s *Server) unsubscribeDigest(c *gin.Context) {
+	// Get token from URL
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing unsubscribe token"})
+		return
+	}
+
+	// Turn off digests
+	result, err := s.db.Pool.Exec(c.Request.Context(), `
+		UPDATE users
+		SET digest_frequency = $1, updated_at = NOW()
+		WHERE digest_unsubscribe_token = $2
+	`, models.DigestNone, token)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unsubscribe"})
+		return
+	}
+
+	// Check if token was found
+	if result.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invalid unsubscribe token"})
+		return
+	}
+
+	// Return success
+	c.JSON(http.StatusOK, gin.H{"message": "Unsubscribed from digest emails"})
+}
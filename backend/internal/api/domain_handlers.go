@@ -1,13 +1,14 @@
 package api
 
 import (
-	"context"
+	"errors"
 	"net"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"github.com/abstractmelon/is-site-live/internal/models"
+	"github.com/abstractmelon/is-site-live/internal/storage"
 	"github.com/gin-gonic/gin"
 )
 
@@ -28,19 +29,11 @@ func (s *Server) createCustomDomain(c *gin.Context) {
 	}
 
 	// Create custom domain
-	var domain models.CustomDomain
-	err := s.db.Pool.QueryRow(context.Background(), `
-		INSERT INTO custom_domains (user_id, domain, verified)
-		VALUES ($1, $2, false)
-		RETURNING id, user_id, domain, verified, created_at, updated_at
-	`, userID, domainCreation.Domain).Scan(
-		&domain.ID,
-		&domain.UserID,
-		&domain.Domain,
-		&domain.Verified,
-		&domain.CreatedAt,
-		&domain.UpdatedAt,
-	)
+	domain, err := s.store.Domains.Create(c.Request.Context(), userID.(int), domainCreation.Domain)
+	if errors.Is(err, storage.ErrConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Custom domain already exists"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create custom domain"})
 		return
@@ -60,35 +53,11 @@ func (s *Server) getUserDomains(c *gin.Context) {
 	}
 
 	// Get domains from database
-	rows, err := s.db.Pool.Query(context.Background(), `
-		SELECT id, user_id, domain, verified, created_at, updated_at
-		FROM custom_domains
-		WHERE user_id = $1
-		ORDER BY domain
-	`, userID)
+	domains, err := s.store.Domains.ListByUser(c.Request.Context(), userID.(int))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get custom domains"})
 		return
 	}
-	defer rows.Close()
-
-	var domains []models.CustomDomain
-	for rows.Next() {
-		var domain models.CustomDomain
-		err := rows.Scan(
-			&domain.ID,
-			&domain.UserID,
-			&domain.Domain,
-			&domain.Verified,
-			&domain.CreatedAt,
-			&domain.UpdatedAt,
-		)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan custom domain"})
-			return
-		}
-		domains = append(domains, domain)
-	}
 
 	// Return domains
 	c.JSON(http.StatusOK, domains)
@@ -111,19 +80,13 @@ func (s *Server) deleteCustomDomain(c *gin.Context) {
 	}
 
 	// Delete domain
-	result, err := s.db.Pool.Exec(context.Background(), `
-		DELETE FROM custom_domains
-		WHERE id = $1 AND user_id = $2
-	`, domainID, userID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete custom domain"})
+	err = s.store.Domains.Delete(c.Request.Context(), domainID, userID.(int))
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Custom domain not found"})
 		return
 	}
-
-	// Check if domain was found
-	rowsAffected := result.RowsAffected()
-	if rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Custom domain not found"})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete custom domain"})
 		return
 	}
 
@@ -148,19 +111,7 @@ func (s *Server) verifyCustomDomain(c *gin.Context) {
 	}
 
 	// Get domain from database
-	var domain models.CustomDomain
-	err = s.db.Pool.QueryRow(context.Background(), `
-		SELECT id, user_id, domain, verified, created_at, updated_at
-		FROM custom_domains
-		WHERE id = $1 AND user_id = $2
-	`, domainID, userID).Scan(
-		&domain.ID,
-		&domain.UserID,
-		&domain.Domain,
-		&domain.Verified,
-		&domain.CreatedAt,
-		&domain.UpdatedAt,
-	)
+	domain, err := s.store.Domains.Get(c.Request.Context(), domainID, userID.(int))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Custom domain not found"})
 		return
@@ -174,19 +125,7 @@ func (s *Server) verifyCustomDomain(c *gin.Context) {
 	}
 
 	// Update domain verification status
-	err = s.db.Pool.QueryRow(context.Background(), `
-		UPDATE custom_domains
-		SET verified = $1, updated_at = NOW()
-		WHERE id = $2
-		RETURNING id, user_id, domain, verified, created_at, updated_at
-	`, verified, domain.ID).Scan(
-		&domain.ID,
-		&domain.UserID,
-		&domain.Domain,
-		&domain.Verified,
-		&domain.CreatedAt,
-		&domain.UpdatedAt,
-	)
+	domain, err = s.store.Domains.SetVerified(c.Request.Context(), domain.ID, verified)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update domain verification status"})
 		return
@@ -202,67 +141,41 @@ func (s *Server) getDomainDashboard(c *gin.Context) {
 	domainName := c.Param("domain")
 
 	// Get domain from database
-	var domain models.CustomDomain
-	var userID int
-	var username string
-	err := s.db.Pool.QueryRow(context.Background(), `
-		SELECT d.id, d.user_id, d.domain, d.verified, d.created_at, d.updated_at, u.id, u.username
-		FROM custom_domains d
-		JOIN users u ON d.user_id = u.id
-		WHERE d.domain = $1 AND d.verified = true
-	`, domainName).Scan(
-		&domain.ID,
-		&domain.UserID,
-		&domain.Domain,
-		&domain.Verified,
-		&domain.CreatedAt,
-		&domain.UpdatedAt,
-		&userID,
-		&username,
-	)
-	if err != nil {
+	domain, err := s.store.Domains.GetByName(c.Request.Context(), domainName)
+	if err != nil || !domain.Verified {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Custom domain not found or not verified"})
 		return
 	}
 
+	// Get the domain's owner
+	user, err := s.store.Users.Get(c.Request.Context(), domain.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+
 	// Get user's sites
-	rows, err := s.db.Pool.Query(context.Background(), `
-		SELECT id, user_id, name, url, created_at, updated_at
-		FROM sites
-		WHERE user_id = $1
-	`, userID)
+	sites, err := s.store.Sites.ListByUser(c.Request.Context(), user.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user's sites"})
 		return
 	}
-	defer rows.Close()
 
-	var sites []models.Site
-	for rows.Next() {
-		var site models.Site
-		err := rows.Scan(
-			&site.ID,
-			&site.UserID,
-			&site.Name,
-			&site.URL,
-			&site.CreatedAt,
-			&site.UpdatedAt,
-		)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan site"})
-			return
-		}
-		sites = append(sites, site)
+	// Add the current status and daily uptime bars
+	sitesWithStatus, err := s.siteSummaries(sites)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get site status"})
+		return
 	}
 
 	// Return dashboard data
 	c.JSON(http.StatusOK, gin.H{
 		"domain": domain,
 		"user": gin.H{
-			"id":       userID,
-			"username": username,
+			"id":       user.ID,
+			"username": user.Username,
 		},
-		"sites": sites,
+		"sites": sitesWithStatus,
 	})
 }
 
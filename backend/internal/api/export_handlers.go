@@ -0,0 +1,434 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/abstractmelon/is-site-live/internal/auth"
+	"github.com/abstractmelon/is-site-live/internal/models"
+	"github.com/abstractmelon/is-site-live/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// maxSiteNameLength is the longest site name, see models.SiteCreation
+const maxSiteNameLength = 100
+
+// exportConfig handles exporting the current user's sites, custom domains and
+// notification settings. The format query parameter picks json (default) or
+// yaml.
+func (s *Server) exportConfig(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	// Get format from query
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "yaml" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format, expected json or yaml"})
+		return
+	}
+
+	// Get the user's configuration
+	user, err := s.store.Users.Get(c.Request.Context(), userID.(int))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+	sites, err := s.store.Sites.ListByUser(c.Request.Context(), user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get sites"})
+		return
+	}
+	domains, err := s.store.Domains.ListByUser(c.Request.Context(), user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get custom domains"})
+		return
+	}
+	policyNames, err := s.escalationPolicyNames(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get escalation policies"})
+		return
+	}
+
+	// Build the export
+	export := models.Export{
+		Version:    models.ExportVersion,
+		ExportedAt: time.Now().UTC(),
+		Settings: models.ExportSettings{
+			DigestFrequency: &user.DigestFrequency,
+			Timezone:        &user.Timezone,
+		},
+		Sites:         make([]models.ExportSite, 0, len(sites)),
+		CustomDomains: make([]string, 0, len(domains)),
+	}
+	if user.Email != "" {
+		export.Settings.Email = &user.Email
+	}
+	for _, site := range sites {
+		exportSite := models.ExportSite{
+			Name:             site.Name,
+			URL:              site.URL,
+			SLOTarget:        site.SLOTarget,
+			SLOBurnRateAlert: site.SLOBurnRateAlert,
+			TracePropagation: site.TracePropagation,
+			LocationQuorum:   site.LocationQuorum,
+		}
+		if site.SLOTarget != nil {
+			exportSite.SLOWindow = site.SLOWindow
+		}
+		if site.EscalationPolicyID != nil {
+			exportSite.EscalationPolicy = policyNames[*site.EscalationPolicyID]
+		}
+		export.Sites = append(export.Sites, exportSite)
+	}
+	for _, domain := range domains {
+		export.CustomDomains = append(export.CustomDomains, domain.Domain)
+	}
+
+	// Return export as a download
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="isitlive-%s.%s"`, user.Username, format))
+	if format == "yaml" {
+		c.YAML(http.StatusOK, export)
+		return
+	}
+	c.JSON(http.StatusOK, export)
+}
+
+// importConfig handles importing a document made by exportConfig, as JSON or
+// as YAML depending on the content type. Sites are matched on their name;
+// the mode query parameter decides whether existing sites are skipped
+// (default), overwritten, or kept while the imported site is renamed. With
+// dry_run=true the changes are reported without being made. The whole
+// document is validated before anything is changed.
+func (s *Server) importConfig(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	// Get options from query
+	mode := c.DefaultQuery("mode", models.ImportModeSkip)
+	if mode != models.ImportModeSkip && mode != models.ImportModeOverwrite && mode != models.ImportModeRename {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid mode, expected skip, overwrite or rename"})
+		return
+	}
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid dry_run, expected true or false"})
+		return
+	}
+
+	// Bind request body
+	var export models.Export
+	switch c.ContentType() {
+	case "application/yaml", "application/x-yaml", "text/yaml":
+		err = c.ShouldBindYAML(&export)
+	default:
+		err = c.ShouldBindJSON(&export)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if export.Version > models.ExportVersion {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unsupported export version %d", export.Version)})
+		return
+	}
+	if export.Settings.Timezone != nil {
+		if _, err := time.LoadLocation(*export.Settings.Timezone); err != nil || *export.Settings.Timezone == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid timezone"})
+			return
+		}
+	}
+
+	// Plan the changes
+	plan, err := s.planImport(userID.(int), &export, mode)
+	var invalid importError
+	if errors.As(err, &invalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": invalid.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to plan import"})
+		return
+	}
+	plan.result.DryRun = dryRun
+
+	// Apply them
+	if !dryRun {
+		if err := s.applyImport(userID.(int), plan); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import configuration"})
+			return
+		}
+	}
+
+	// Return result
+	c.JSON(http.StatusOK, plan.result)
+}
+
+// importError is a problem with an imported document
+type importError string
+
+func (e importError) Error() string {
+	return string(e)
+}
+
+// importPlan holds the changes an import makes
+type importPlan struct {
+	result   models.ImportResult
+	sites    []siteChange
+	domains  []string
+	settings *storage.UserUpdate
+}
+
+// siteChange creates a site, or updates it if id is set
+type siteChange struct {
+	id   int
+	site models.SiteCreation
+}
+
+// planImport works out the changes an import makes without making them
+func (s *Server) planImport(userID int, export *models.Export, mode string) (*importPlan, error) {
+	plan := &importPlan{
+		result: models.ImportResult{
+			Mode:          mode,
+			Sites:         []models.ImportAction{},
+			CustomDomains: []models.ImportAction{},
+		},
+	}
+
+	// Sites are matched on name, escalation policies by name too
+	existingSites, err := s.store.Sites.ListByUser(context.Background(), userID)
+	if err != nil {
+		return nil, err
+	}
+	sitesByName := make(map[string]models.Site, len(existingSites))
+	takenNames := make(map[string]bool, len(existingSites)+len(export.Sites))
+	for _, site := range existingSites {
+		sitesByName[site.Name] = site
+		takenNames[site.Name] = true
+	}
+	policyNames, err := s.escalationPolicyNames(userID)
+	if err != nil {
+		return nil, err
+	}
+	policyIDs := make(map[string]int, len(policyNames))
+	for id, name := range policyNames {
+		policyIDs[name] = id
+	}
+	locations, err := s.locationCount(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	imported := make(map[string]bool, len(export.Sites))
+	for _, exportSite := range export.Sites {
+		if imported[exportSite.Name] {
+			return nil, importError(fmt.Sprintf("Duplicate site %q", exportSite.Name))
+		}
+		imported[exportSite.Name] = true
+		if exportSite.LocationQuorum > locations {
+			return nil, importError(fmt.Sprintf("Location quorum of site %q is larger than the number of locations (%d)", exportSite.Name, locations))
+		}
+
+		site := models.SiteCreation{
+			Name:             exportSite.Name,
+			URL:              exportSite.URL,
+			SLOTarget:        exportSite.SLOTarget,
+			SLOWindow:        exportSite.SLOWindow,
+			SLOBurnRateAlert: exportSite.SLOBurnRateAlert,
+			TracePropagation: exportSite.TracePropagation,
+			LocationQuorum:   exportSite.LocationQuorum,
+		}
+		action := models.ImportAction{Name: site.Name, Action: models.ImportCreated}
+
+		// Escalation policies aren't exported, so the site is imported
+		// without one unless a policy with the same name exists here
+		if exportSite.EscalationPolicy != "" {
+			if policyID, ok := policyIDs[exportSite.EscalationPolicy]; ok {
+				site.EscalationPolicyID = &policyID
+			} else {
+				action.Notes = append(action.Notes, fmt.Sprintf("escalation policy %q doesn't exist and was left out", exportSite.EscalationPolicy))
+			}
+		}
+
+		existing, exists := sitesByName[site.Name]
+		switch {
+		case !exists:
+			plan.sites = append(plan.sites, siteChange{site: site})
+		case sameSite(existing, site):
+			action.Action = models.ImportUnchanged
+		case mode == models.ImportModeSkip:
+			action.Action = models.ImportSkipped
+			action.Reason = "a site with this name already exists"
+		case mode == models.ImportModeOverwrite:
+			action.Action = models.ImportUpdated
+			plan.sites = append(plan.sites, siteChange{id: existing.ID, site: site})
+		case mode == models.ImportModeRename:
+			site.Name = uniqueSiteName(site.Name, takenNames)
+			action.Action = models.ImportRenamed
+			action.NewName = site.Name
+			plan.sites = append(plan.sites, siteChange{site: site})
+		}
+		takenNames[site.Name] = true
+		plan.result.Sites = append(plan.result.Sites, action)
+	}
+
+	// Custom domains are unique across users, so they are only added
+	seenDomains := make(map[string]bool, len(export.CustomDomains))
+	for _, name := range export.CustomDomains {
+		if seenDomains[name] {
+			return nil, importError(fmt.Sprintf("Duplicate custom domain %q", name))
+		}
+		seenDomains[name] = true
+
+		action := models.ImportAction{Name: name, Action: models.ImportCreated}
+		domain, err := s.store.Domains.GetByName(context.Background(), name)
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			plan.domains = append(plan.domains, name)
+		case err != nil:
+			return nil, err
+		case domain.UserID == userID:
+			action.Action = models.ImportUnchanged
+		default:
+			action.Action = models.ImportSkipped
+			action.Reason = "the domain is used by another user"
+		}
+		plan.result.CustomDomains = append(plan.result.CustomDomains, action)
+	}
+
+	// Only settings that differ are updated
+	user, err := s.store.Users.Get(context.Background(), userID)
+	if err != nil {
+		return nil, err
+	}
+	settings := export.Settings
+	update := storage.UserUpdate{}
+	if settings.Email != nil && *settings.Email != user.Email {
+		update.Email = settings.Email
+	}
+	if settings.DigestFrequency != nil && *settings.DigestFrequency != user.DigestFrequency {
+		update.DigestFrequency = settings.DigestFrequency
+	}
+	if settings.Timezone != nil && *settings.Timezone != user.Timezone {
+		update.Timezone = settings.Timezone
+	}
+	if update.Email != nil || update.DigestFrequency != nil || update.Timezone != nil {
+		plan.settings = &update
+		plan.result.SettingsUpdated = true
+	}
+
+	return plan, nil
+}
+
+// applyImport makes the changes of an import plan in a single transaction,
+// so a failed import changes nothing
+func (s *Server) applyImport(userID int, plan *importPlan) error {
+	if plan.settings != nil {
+		// Generate an unsubscribe token in case the user opts in to digests
+		unsubscribeToken, err := auth.GenerateRandomToken()
+		if err != nil {
+			return err
+		}
+		plan.settings.UnsubscribeToken = &unsubscribeToken
+	}
+
+	return s.store.InTx(context.Background(), func(tx storage.Tx) error {
+		for _, change := range plan.sites {
+			var err error
+			if change.id == 0 {
+				_, err = tx.Sites.Create(context.Background(), userID, change.site)
+			} else {
+				_, err = tx.Sites.Update(context.Background(), change.id, userID, change.site)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to import site %q: %v", change.site.Name, err)
+			}
+		}
+
+		for _, domain := range plan.domains {
+			if _, err := tx.Domains.Create(context.Background(), userID, domain); err != nil {
+				return fmt.Errorf("failed to import custom domain %q: %v", domain, err)
+			}
+		}
+
+		if plan.settings != nil {
+			if _, err := tx.Users.Update(context.Background(), userID, *plan.settings); err != nil {
+				return fmt.Errorf("failed to import settings: %v", err)
+			}
+		}
+		return nil
+	})
+}
+
+// escalationPolicyNames gets the names of a user's escalation policies by ID
+func (s *Server) escalationPolicyNames(userID int) (map[int]string, error) {
+	names := make(map[int]string)
+	if s.db == nil {
+		return names, nil
+	}
+
+	rows, err := s.db.Pool.Query(context.Background(), `
+		SELECT id, name FROM escalation_policies WHERE user_id = $1
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		names[id] = name
+	}
+
+	return names, rows.Err()
+}
+
+// uniqueSiteName appends a number to a site name so it isn't taken, keeping
+// it within the maximum length
+func uniqueSiteName(name string, taken map[string]bool) string {
+	for i := 2; ; i++ {
+		suffix := fmt.Sprintf(" (%d)", i)
+		base := []rune(name)
+		if len(base)+len(suffix) > maxSiteNameLength {
+			base = base[:maxSiteNameLength-len(suffix)]
+		}
+		if candidate := string(base) + suffix; !taken[candidate] {
+			return candidate
+		}
+	}
+}
+
+// sameSite reports whether importing a site would leave an existing one
+// unchanged
+func sameSite(existing models.Site, site models.SiteCreation) bool {
+	return existing.URL == site.URL &&
+		equalPointers(existing.EscalationPolicyID, site.EscalationPolicyID) &&
+		equalPointers(existing.SLOTarget, site.SLOTarget) &&
+		existing.SLOWindow == site.SLOWindowOrDefault() &&
+		equalPointers(existing.SLOBurnRateAlert, site.SLOBurnRateAlert) &&
+		existing.TracePropagation == site.TracePropagation &&
+		existing.LocationQuorum == site.LocationQuorum
+}
+
+// equalPointers reports whether two optional values are equal
+func equalPointers[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
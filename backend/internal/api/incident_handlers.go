@@ -0,0 +1,164 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/abstractmelon/is-site-live/internal/auth"
+	"github.com/abstractmelon/is-site-live/internal/models"
+	"github.com/abstractmelon/is-site-live/internal/monitoring"
+	"github.com/gin-gonic/gin"
+)
+
+// getUserIncidents gets the most recent incidents of the current user's sites
+func (s *Server) getUserIncidents(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	// Get incidents from database
+	rows, err := s.db.Pool.Query(c.Request.Context(), `
+		SELECT i.id, i.site_id, i.started_at, i.resolved_at, i.acknowledged_at, i.acknowledged_by,
+			i.status_code, COALESCE(i.error_message, ''), i.escalation_step, i.last_escalated_at
+		FROM incidents i
+		JOIN sites s ON s.id = i.site_id
+		WHERE s.user_id = $1
+		ORDER BY i.started_at DESC
+		LIMIT 100
+	`, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get incidents"})
+		return
+	}
+	defer rows.Close()
+
+	incidents := []models.Incident{}
+	for rows.Next() {
+		var incident models.Incident
+		err := rows.Scan(
+			&incident.ID,
+			&incident.SiteID,
+			&incident.StartedAt,
+			&incident.ResolvedAt,
+			&incident.AcknowledgedAt,
+			&incident.AcknowledgedBy,
+			&incident.StatusCode,
+			&incident.ErrorMessage,
+			&incident.EscalationStep,
+			&incident.LastEscalatedAt,
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan incident"})
+			return
+		}
+		incidents = append(incidents, incident)
+	}
+
+	// Return incidents
+	c.JSON(http.StatusOK, incidents)
+}
+
+// acknowledgeIncident acknowledges an incident as the current user
+func (s *Server) acknowledgeIncident(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	// Get incident ID from URL
+	incidentID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid incident ID"})
+		return
+	}
+
+	// Only the site owner and notified users may acknowledge
+	allowed, err := s.monitoringService.CanAcknowledgeIncident(incidentID, userID.(int))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get incident"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Incident not found"})
+		return
+	}
+
+	s.respondToAcknowledgement(c, incidentID, userID.(int))
+}
+
+// acknowledgeIncidentPage serves the page the signed link in alert emails
+// leads to, which asks to confirm the acknowledgement. Mail scanners open
+// every link, so the link itself must not acknowledge the incident.
+func (s *Server) acknowledgeIncidentPage(c *gin.Context) {
+	claims, token, ok := s.ackLinkClaims(c)
+	if !ok {
+		return
+	}
+
+	renderConfirmation(c, confirmation{
+		Title:   "Acknowledge incident",
+		Message: fmt.Sprintf("Acknowledge incident #%d? Escalation stops once it is acknowledged.", claims.IncidentID),
+		Button:  "Acknowledge",
+		Action:  "ack/confirm?token=" + url.QueryEscape(token),
+	})
+}
+
+// acknowledgeIncidentLink acknowledges an incident with the signed token of
+// the link sent in alert emails, posted from the confirmation page
+func (s *Server) acknowledgeIncidentLink(c *gin.Context) {
+	claims, _, ok := s.ackLinkClaims(c)
+	if !ok {
+		return
+	}
+
+	s.respondToAcknowledgement(c, claims.IncidentID, claims.UserID)
+}
+
+// ackLinkClaims validates the signed token of an acknowledgement link,
+// responding with an error if it isn't valid for the incident in the URL
+func (s *Server) ackLinkClaims(c *gin.Context) (*auth.AckClaims, string, bool) {
+	// Get incident ID from URL
+	incidentID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid incident ID"})
+		return nil, "", false
+	}
+
+	// Validate the signed token
+	token := c.Query("token")
+	claims, err := auth.ValidateAckToken(token, s.config.JWT)
+	if err != nil || claims.IncidentID != incidentID {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired acknowledgement link"})
+		return nil, "", false
+	}
+
+	return claims, token, true
+}
+
+// respondToAcknowledgement acknowledges an incident and writes the response
+func (s *Server) respondToAcknowledgement(c *gin.Context, incidentID, userID int) {
+	incident, err := s.monitoringService.AcknowledgeIncident(incidentID, userID)
+	if errors.Is(err, monitoring.ErrIncidentNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Incident not found"})
+		return
+	}
+	if errors.Is(err, monitoring.ErrIncidentClosed) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Incident is already resolved or acknowledged"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to acknowledge incident"})
+		return
+	}
+
+	// Return acknowledged incident
+	c.JSON(http.StatusOK, incident)
+}
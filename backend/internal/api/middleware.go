@@ -0,0 +1,100 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/abstractmelon/is-site-live/internal/logging"
+	"github.com/gin-gonic/gin"
+)
+
+// requestIDHeader carries the ID of a request, from the client or generated,
+// in requests and responses
+const requestIDHeader = "X-Request-ID"
+
+// requestIDPattern matches the request IDs accepted from clients
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// quietPaths are polled by infrastructure, so their requests are only logged
+// at debug level
+var quietPaths = map[string]bool{
+	"/health":  true,
+	"/livez":   true,
+	"/readyz":  true,
+	"/metrics": true,
+}
+
+func init() {
+	// Send gin's debug output, e.g. the registered routes, through slog
+	gin.DebugPrintFunc = func(format string, values ...any) {
+		slog.Debug(strings.TrimSpace(fmt.Sprintf(format, values...)))
+	}
+}
+
+// requestLogger gives every request an ID, available to handlers through
+// the request context, and logs the request once it has been handled
+func requestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Keep the client's request ID if it looks sensible
+		requestID := c.GetHeader(requestIDHeader)
+		if !requestIDPattern.MatchString(requestID) {
+			requestID = newRequestID()
+		}
+		c.Header(requestIDHeader, requestID)
+		c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), requestID))
+
+		start := time.Now()
+		c.Next()
+
+		// Log the path without the query, which may hold tokens
+		level := slog.LevelInfo
+		if quietPaths[c.Request.URL.Path] {
+			level = slog.LevelDebug
+		}
+		if c.Writer.Status() >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.String("route", c.FullPath()),
+			slog.Int("status", c.Writer.Status()),
+			slog.Int("bytes", c.Writer.Size()),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("client_ip", c.ClientIP()),
+		}
+		if userID, exists := c.Get("userID"); exists {
+			attrs = append(attrs, slog.Any("user_id", userID))
+		}
+		slog.LogAttrs(c.Request.Context(), level, "Request handled", attrs...)
+	}
+}
+
+// recoverer turns panics into internal server errors, logging them with the
+// request they happened in. http.ErrAbortHandler is passed on to net/http,
+// which aborts the response without logging it.
+func recoverer() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, err any) {
+		if err == http.ErrAbortHandler {
+			panic(err)
+		}
+		slog.ErrorContext(c.Request.Context(), "Panic handling request", "error", err, "stack", string(debug.Stack()))
+		c.AbortWithStatus(http.StatusInternalServerError)
+	})
+}
+
+// newRequestID generates a random request ID
+func newRequestID() string {
+	bytes := make([]byte, 16)
+	// crypto/rand only fails if the system's randomness source is unusable
+	_, _ = rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/abstractmelon/is-site-live/internal/importers"
+	"github.com/abstractmelon/is-site-live/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// maxMonitorImportSize is the largest file accepted by the monitor importers
+const maxMonitorImportSize = 10 << 20
+
+// monitorParser reads the monitors of another tool's export
+type monitorParser func(data []byte, interval time.Duration) ([]importers.Monitor, error)
+
+// importUptimeKuma handles importing the monitors of an Uptime Kuma backup
+func (s *Server) importUptimeKuma(c *gin.Context) {
+	s.importMonitors(c, "uptime-kuma", importers.ParseUptimeKuma)
+}
+
+// importUptimeRobot handles importing the monitors of an UptimeRobot
+// getMonitors response
+func (s *Server) importUptimeRobot(c *gin.Context) {
+	s.importMonitors(c, "uptimerobot", importers.ParseUptimeRobot)
+}
+
+// importMonitors creates a site for every HTTP monitor in the request body.
+// Paused monitors and monitors named like an existing site are skipped. With
+// dry_run=true the sites are reported without being created.
+func (s *Server) importMonitors(c *gin.Context, source string, parse monitorParser) {
+	// Get user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	// Get options from query
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid dry_run, expected true or false"})
+		return
+	}
+
+	// Read request body
+	data, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxMonitorImportSize))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Import file is too large"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read import file"})
+		return
+	}
+	monitors, err := parse(data, s.config.Monitoring.Interval)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Sites are matched on name
+	sites, err := s.store.Sites.ListByUser(c.Request.Context(), userID.(int))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get sites"})
+		return
+	}
+	takenNames := make(map[string]bool, len(sites)+len(monitors))
+	for _, site := range sites {
+		takenNames[site.Name] = true
+	}
+
+	result := models.MonitorImportResult{
+		Source:      source,
+		DryRun:      dryRun,
+		Imported:    []models.MonitorImport{},
+		Skipped:     []models.MonitorImport{},
+		Unsupported: []models.MonitorImport{},
+	}
+	for _, monitor := range monitors {
+		item := models.MonitorImport{
+			Name:  monitor.Name,
+			Type:  monitor.Type,
+			URL:   monitor.URL,
+			Notes: monitor.Notes,
+		}
+
+		// Name the site after the monitor, or its URL if it has no name
+		site := models.SiteCreation{Name: monitor.Name, URL: monitor.URL}
+		if site.Name == "" {
+			site.Name = monitor.URL
+		}
+		if name := []rune(site.Name); len(name) > maxSiteNameLength {
+			site.Name = string(name[:maxSiteNameLength])
+		}
+
+		switch {
+		case monitor.Unsupported != "":
+			item.Reason = monitor.Unsupported
+			result.Unsupported = append(result.Unsupported, item)
+			continue
+		case monitor.Paused:
+			item.Reason = "the monitor is paused"
+		case takenNames[site.Name]:
+			item.Reason = "a site with this name already exists"
+		default:
+			if err := binding.Validator.ValidateStruct(&site); err != nil {
+				item.Reason = fmt.Sprintf("invalid monitor: %v", err)
+			}
+		}
+		if item.Reason != "" {
+			result.Skipped = append(result.Skipped, item)
+			continue
+		}
+		takenNames[site.Name] = true
+
+		// Create the site
+		if !dryRun {
+			created, err := s.addSite(userID.(int), site)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import monitors, they may have been partly imported"})
+				return
+			}
+			item.SiteID = created.ID
+		}
+		result.Imported = append(result.Imported, item)
+	}
+
+	// Return result
+	c.JSON(http.StatusOK, result)
+}
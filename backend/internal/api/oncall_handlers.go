@@ -0,0 +1,639 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/abstractmelon/is-site-live/internal/models"
+	"github.com/abstractmelon/is-site-live/internal/monitoring"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// createOnCallSchedule creates a new on-call schedule
+func (s *Server) createOnCallSchedule(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	// Bind request body
+	var scheduleCreation models.OnCallScheduleCreation
+	if err := c.ShouldBindJSON(&scheduleCreation); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Apply defaults
+	if scheduleCreation.Timezone == "" {
+		scheduleCreation.Timezone = "UTC"
+	}
+	if scheduleCreation.HandoffTime == "" {
+		scheduleCreation.HandoffTime = "09:00"
+	}
+
+	// Validate the schedule settings
+	if _, err := time.LoadLocation(scheduleCreation.Timezone); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid timezone"})
+		return
+	}
+	if _, _, err := models.ParseHandoffTime(scheduleCreation.HandoffTime); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	startDate, err := time.Parse("2006-01-02", scheduleCreation.StartDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start date, expected YYYY-MM-DD"})
+		return
+	}
+
+	// Look up the members
+	memberIDs := make([]int, 0, len(scheduleCreation.Members))
+	for _, username := range scheduleCreation.Members {
+		memberID, err := s.getPageableUserID(userID.(int), username)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown user: " + username})
+			return
+		}
+		memberIDs = append(memberIDs, memberID)
+	}
+
+	// Create the schedule and its members in a transaction
+	tx, err := s.db.Pool.Begin(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create schedule"})
+		return
+	}
+	defer tx.Rollback(c.Request.Context())
+
+	var scheduleID int
+	err = tx.QueryRow(c.Request.Context(), `
+		INSERT INTO oncall_schedules (user_id, name, timezone, rotation, handoff_time, start_date)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`, userID, scheduleCreation.Name, scheduleCreation.Timezone, scheduleCreation.Rotation,
+		scheduleCreation.HandoffTime, startDate).Scan(&scheduleID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create schedule"})
+		return
+	}
+
+	for position, memberID := range memberIDs {
+		_, err := tx.Exec(c.Request.Context(), `
+			INSERT INTO oncall_schedule_members (schedule_id, position, user_id)
+			VALUES ($1, $2, $3)
+		`, scheduleID, position, memberID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add schedule member"})
+			return
+		}
+	}
+
+	if err := tx.Commit(c.Request.Context()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create schedule"})
+		return
+	}
+
+	// Return created schedule
+	schedule, err := s.monitoringService.GetOnCallSchedule(scheduleID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get schedule"})
+		return
+	}
+	c.JSON(http.StatusCreated, schedule)
+}
+
+// getUserOnCallSchedules gets all on-call schedules of the current user
+func (s *Server) getUserOnCallSchedules(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	// Get schedule IDs from database
+	rows, err := s.db.Pool.Query(c.Request.Context(), `
+		SELECT id FROM oncall_schedules WHERE user_id = $1 ORDER BY name
+	`, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get schedules"})
+		return
+	}
+	var scheduleIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan schedule"})
+			return
+		}
+		scheduleIDs = append(scheduleIDs, id)
+	}
+	rows.Close()
+
+	// Load each schedule with its members and overrides
+	schedules := []models.OnCallSchedule{}
+	for _, id := range scheduleIDs {
+		schedule, err := s.monitoringService.GetOnCallSchedule(id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get schedule"})
+			return
+		}
+		schedules = append(schedules, *schedule)
+	}
+
+	// Return schedules
+	c.JSON(http.StatusOK, schedules)
+}
+
+// getOnCallSchedule gets an on-call schedule and who is currently on call
+func (s *Server) getOnCallSchedule(c *gin.Context) {
+	schedule, ok := s.getOwnedSchedule(c)
+	if !ok {
+		return
+	}
+
+	// Work out who is on call right now
+	var onCall *int
+	if userID, err := schedule.OnCallAt(time.Now()); err == nil {
+		onCall = &userID
+	}
+
+	// Return schedule
+	c.JSON(http.StatusOK, gin.H{
+		"schedule":        schedule,
+		"on_call_user_id": onCall,
+	})
+}
+
+// deleteOnCallSchedule deletes an on-call schedule
+func (s *Server) deleteOnCallSchedule(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	// Get schedule ID from URL
+	scheduleID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid schedule ID"})
+		return
+	}
+
+	// Refuse to delete a schedule that escalation policies still point at
+	var inUse bool
+	err = s.db.Pool.QueryRow(c.Request.Context(), `
+		SELECT EXISTS (
+			SELECT 1 FROM escalation_steps WHERE target_type = $1 AND target_id = $2
+		)
+	`, models.TargetTypeSchedule, scheduleID).Scan(&inUse)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete schedule"})
+		return
+	}
+	if inUse {
+		c.JSON(http.StatusConflict, gin.H{"error": "Schedule is used by an escalation policy"})
+		return
+	}
+
+	// Delete schedule
+	result, err := s.db.Pool.Exec(c.Request.Context(), `
+		DELETE FROM oncall_schedules
+		WHERE id = $1 AND user_id = $2
+	`, scheduleID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete schedule"})
+		return
+	}
+
+	// Check if schedule was found
+	if result.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Schedule not found"})
+		return
+	}
+
+	// Return success
+	c.JSON(http.StatusOK, gin.H{"message": "Schedule deleted successfully"})
+}
+
+// createOnCallOverride temporarily puts someone else on call
+func (s *Server) createOnCallOverride(c *gin.Context) {
+	schedule, ok := s.getOwnedSchedule(c)
+	if !ok {
+		return
+	}
+
+	// Bind request body
+	var overrideCreation models.OnCallOverrideCreation
+	if err := c.ShouldBindJSON(&overrideCreation); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !overrideCreation.EndsAt.After(overrideCreation.StartsAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Override must end after it starts"})
+		return
+	}
+
+	// Look up the user taking over
+	overrideUserID, err := s.getPageableUserID(schedule.UserID, overrideCreation.Username)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown user: " + overrideCreation.Username})
+		return
+	}
+
+	// Create override
+	override := models.OnCallOverride{Username: overrideCreation.Username}
+	err = s.db.Pool.QueryRow(c.Request.Context(), `
+		INSERT INTO oncall_overrides (schedule_id, user_id, starts_at, ends_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, schedule_id, user_id, starts_at, ends_at, created_at
+	`, schedule.ID, overrideUserID, overrideCreation.StartsAt, overrideCreation.EndsAt).Scan(
+		&override.ID,
+		&override.ScheduleID,
+		&override.UserID,
+		&override.StartsAt,
+		&override.EndsAt,
+		&override.CreatedAt,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create override"})
+		return
+	}
+
+	// Return created override
+	c.JSON(http.StatusCreated, override)
+}
+
+// deleteOnCallOverride deletes an on-call override
+func (s *Server) deleteOnCallOverride(c *gin.Context) {
+	schedule, ok := s.getOwnedSchedule(c)
+	if !ok {
+		return
+	}
+
+	// Get override ID from URL
+	overrideID, err := strconv.Atoi(c.Param("overrideId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid override ID"})
+		return
+	}
+
+	// Delete override
+	result, err := s.db.Pool.Exec(c.Request.Context(), `
+		DELETE FROM oncall_overrides
+		WHERE id = $1 AND schedule_id = $2
+	`, overrideID, schedule.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete override"})
+		return
+	}
+
+	// Check if override was found
+	if result.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Override not found"})
+		return
+	}
+
+	// Return success
+	c.JSON(http.StatusOK, gin.H{"message": "Override deleted successfully"})
+}
+
+// createEscalationPolicy creates a new escalation policy
+func (s *Server) createEscalationPolicy(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	// Bind request body
+	var policyCreation models.EscalationPolicyCreation
+	if err := c.ShouldBindJSON(&policyCreation); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Resolve each step's target
+	steps := make([]models.EscalationStep, 0, len(policyCreation.Steps))
+	for position, stepCreation := range policyCreation.Steps {
+		step := models.EscalationStep{
+			Position:     position,
+			DelayMinutes: stepCreation.DelayMinutes,
+			TargetType:   stepCreation.TargetType,
+		}
+
+		switch stepCreation.TargetType {
+		case models.TargetTypeUser:
+			targetID, err := s.getPageableUserID(userID.(int), stepCreation.Username)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown user: " + stepCreation.Username})
+				return
+			}
+			step.TargetID = targetID
+		case models.TargetTypeSchedule:
+			schedule, err := s.monitoringService.GetOnCallSchedule(stepCreation.ScheduleID)
+			if err != nil || schedule.UserID != userID.(int) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown schedule: " + strconv.Itoa(stepCreation.ScheduleID)})
+				return
+			}
+			step.TargetID = schedule.ID
+		}
+
+		steps = append(steps, step)
+	}
+
+	// Create the policy and its steps in a transaction
+	tx, err := s.db.Pool.Begin(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create escalation policy"})
+		return
+	}
+	defer tx.Rollback(c.Request.Context())
+
+	var policyID int
+	err = tx.QueryRow(c.Request.Context(), `
+		INSERT INTO escalation_policies (user_id, name)
+		VALUES ($1, $2)
+		RETURNING id
+	`, userID, policyCreation.Name).Scan(&policyID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create escalation policy"})
+		return
+	}
+
+	for _, step := range steps {
+		_, err := tx.Exec(c.Request.Context(), `
+			INSERT INTO escalation_steps (policy_id, position, delay_minutes, target_type, target_id)
+			VALUES ($1, $2, $3, $4, $5)
+		`, policyID, step.Position, step.DelayMinutes, step.TargetType, step.TargetID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create escalation step"})
+			return
+		}
+	}
+
+	if err := tx.Commit(c.Request.Context()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create escalation policy"})
+		return
+	}
+
+	// Return created policy
+	policy, err := s.monitoringService.GetEscalationPolicy(policyID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get escalation policy"})
+		return
+	}
+	c.JSON(http.StatusCreated, policy)
+}
+
+// getUserEscalationPolicies gets all escalation policies of the current user
+func (s *Server) getUserEscalationPolicies(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	// Get policy IDs from database
+	rows, err := s.db.Pool.Query(c.Request.Context(), `
+		SELECT id FROM escalation_policies WHERE user_id = $1 ORDER BY name
+	`, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get escalation policies"})
+		return
+	}
+	var policyIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan escalation policy"})
+			return
+		}
+		policyIDs = append(policyIDs, id)
+	}
+	rows.Close()
+
+	// Load each policy with its steps
+	policies := []models.EscalationPolicy{}
+	for _, id := range policyIDs {
+		policy, err := s.monitoringService.GetEscalationPolicy(id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get escalation policy"})
+			return
+		}
+		policies = append(policies, *policy)
+	}
+
+	// Return policies
+	c.JSON(http.StatusOK, policies)
+}
+
+// deleteEscalationPolicy deletes an escalation policy
+func (s *Server) deleteEscalationPolicy(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	// Get policy ID from URL
+	policyID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid escalation policy ID"})
+		return
+	}
+
+	// Delete policy; sites using it fall back to alerting their owner
+	result, err := s.db.Pool.Exec(c.Request.Context(), `
+		DELETE FROM escalation_policies
+		WHERE id = $1 AND user_id = $2
+	`, policyID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete escalation policy"})
+		return
+	}
+
+	// Check if policy was found
+	if result.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Escalation policy not found"})
+		return
+	}
+
+	// Return success
+	c.JSON(http.StatusOK, gin.H{"message": "Escalation policy deleted successfully"})
+}
+
+// getOwnedSchedule gets the schedule from the URL if it belongs to the
+// current user, writing an error response otherwise
+func (s *Server) getOwnedSchedule(c *gin.Context) (*models.OnCallSchedule, bool) {
+	// Get user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return nil, false
+	}
+
+	// Get schedule ID from URL
+	scheduleID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid schedule ID"})
+		return nil, false
+	}
+
+	// Get schedule
+	schedule, err := s.monitoringService.GetOnCallSchedule(scheduleID)
+	if errors.Is(err, monitoring.ErrScheduleNotFound) || (err == nil && schedule.UserID != userID.(int)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Schedule not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get schedule"})
+		return nil, false
+	}
+
+	return schedule, true
+}
+
+// checkEscalationPolicy checks that an optional escalation policy belongs to
+// the user, writing an error response otherwise
+func (s *Server) checkEscalationPolicy(c *gin.Context, policyID *int, userID interface{}) bool {
+	if policyID == nil {
+		return true
+	}
+	if s.db == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Escalation policies require PostgreSQL"})
+		return false
+	}
+
+	var ownerID int
+	err := s.db.Pool.QueryRow(context.Background(), `
+		SELECT user_id FROM escalation_policies WHERE id = $1
+	`, *policyID).Scan(&ownerID)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && ownerID != userID.(int)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown escalation policy"})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check escalation policy"})
+		return false
+	}
+
+	return true
+}
+
+// getPageableUserID looks up a user a user may page: themselves, or a user
+// who allowed them to. Unknown users and users who didn't allow it give the
+// same error, so usernames can't be probed.
+func (s *Server) getPageableUserID(pagerID int, username string) (int, error) {
+	var userID int
+	err := s.db.Pool.QueryRow(context.Background(), `
+		SELECT u.id FROM users u
+		WHERE u.username = $1 AND (u.id = $2 OR EXISTS (
+			SELECT 1 FROM oncall_consents oc WHERE oc.user_id = u.id AND oc.pager_id = $2
+		))
+	`, username, pagerID).Scan(&userID)
+	return userID, err
+}
+
+// createOnCallConsent allows a user to page the current user. It succeeds
+// whether or not the user exists, so usernames can't be probed.
+func (s *Server) createOnCallConsent(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	// Bind request body
+	var consentCreation models.OnCallConsentCreation
+	if err := c.ShouldBindJSON(&consentCreation); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Create consent
+	_, err := s.db.Pool.Exec(c.Request.Context(), `
+		INSERT INTO oncall_consents (user_id, pager_id)
+		SELECT $1, id FROM users WHERE username = $2 AND id <> $1
+		ON CONFLICT DO NOTHING
+	`, userID, consentCreation.Username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create consent"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// getOnCallConsents gets the users allowed to page the current user
+func (s *Server) getOnCallConsents(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	// Get consents from database
+	rows, err := s.db.Pool.Query(c.Request.Context(), `
+		SELECT u.username, oc.created_at
+		FROM oncall_consents oc
+		JOIN users u ON u.id = oc.pager_id
+		WHERE oc.user_id = $1
+		ORDER BY u.username
+	`, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get consents"})
+		return
+	}
+	defer rows.Close()
+
+	consents := []models.OnCallConsent{}
+	for rows.Next() {
+		var consent models.OnCallConsent
+		if err := rows.Scan(&consent.Username, &consent.CreatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan consent"})
+			return
+		}
+		consents = append(consents, consent)
+	}
+
+	// Return consents
+	c.JSON(http.StatusOK, consents)
+}
+
+// deleteOnCallConsent stops a user from paging the current user. Escalations
+// already set up skip the current user from then on.
+func (s *Server) deleteOnCallConsent(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	// Delete consent
+	_, err := s.db.Pool.Exec(c.Request.Context(), `
+		DELETE FROM oncall_consents
+		WHERE user_id = $1 AND pager_id = (SELECT id FROM users WHERE username = $2)
+	`, userID, c.Param("username"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete consent"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/abstractmelon/is-site-live/internal/auth"
+	"github.com/abstractmelon/is-site-live/internal/models"
+	"github.com/abstractmelon/is-site-live/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// registerProbe registers a probe, returning the token it authenticates
+// with from then on. Names can't be registered again, so the agent token
+// can't take over a probe; admins delete a probe that lost its token.
+func (s *Server) registerProbe(c *gin.Context) {
+	// Bind request body
+	var registration models.ProbeRegistration
+	if err := c.ShouldBindJSON(&registration); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The server's own results are reported under its location, so a probe
+	// sharing it would never count
+	if registration.Location == s.config.Monitoring.Location {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Location is used by the server's own checks"})
+		return
+	}
+
+	// Generate the probe's token
+	token, err := auth.GenerateRandomToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	// Register probe
+	probe, err := s.store.Probes.Register(c.Request.Context(), registration, auth.HashToken(token))
+	if errors.Is(err, storage.ErrConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": "A probe with this name is already registered"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register probe"})
+		return
+	}
+
+	// Return probe with its token
+	c.JSON(http.StatusOK, models.RegisteredProbe{Probe: *probe, Token: token})
+}
+
+// getProbeChecks gets the sites the authenticated probe checks
+func (s *Server) getProbeChecks(c *gin.Context) {
+	assignment, err := s.monitoringService.GetProbeAssignment(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get checks"})
+		return
+	}
+
+	// Return assignment
+	c.JSON(http.StatusOK, assignment)
+}
+
+// pushProbeResults records the check results of the authenticated probe
+func (s *Server) pushProbeResults(c *gin.Context) {
+	// Get probe from context
+	probe, exists := c.Get("probe")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	// Bind request body
+	var results models.ProbeResults
+	if err := c.ShouldBindJSON(&results); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Record results
+	accepted, err := s.monitoringService.RecordProbeResults(c.Request.Context(), probe.(models.Probe), results.Results)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record results"})
+		return
+	}
+
+	// Return how many results were recorded
+	c.JSON(http.StatusOK, accepted)
+}
+
+// getProbes lists the registered probes
+func (s *Server) getProbes(c *gin.Context) {
+	probes, err := s.store.Probes.List(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get probes"})
+		return
+	}
+
+	// Return probes
+	c.JSON(http.StatusOK, probes)
+}
+
+// deleteProbe deletes a probe, revoking its token. Its checks are kept.
+func (s *Server) deleteProbe(c *gin.Context) {
+	// Get probe ID from URL
+	probeID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid probe ID"})
+		return
+	}
+
+	// Delete probe
+	err = s.store.Probes.Delete(c.Request.Context(), probeID)
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Probe not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete probe"})
+		return
+	}
+
+	// Return success
+	c.JSON(http.StatusOK, gin.H{"message": "Probe deleted successfully"})
+}
+
+// checkLocationQuorum checks that a site's location quorum can be reached,
+// responding with an error if not
+func (s *Server) checkLocationQuorum(c *gin.Context, quorum int) bool {
+	locations, err := s.locationCount(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check location quorum"})
+		return false
+	}
+	if quorum > locations {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Location quorum is larger than the number of locations (%d)", locations)})
+		return false
+	}
+	return true
+}
+
+// locationCount counts the locations sites are checked from, the server's
+// own and those of the registered probes
+func (s *Server) locationCount(ctx context.Context) (int, error) {
+	probes, err := s.store.Probes.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	locations := map[string]bool{s.config.Monitoring.Location: true}
+	for _, probe := range probes {
+		locations[probe.Location] = true
+	}
+	return len(locations), nil
+}
@@ -8,24 +8,38 @@ import (
 	"github.com/abstractmelon/is-site-live/internal/auth"
 	"github.com/abstractmelon/is-site-live/internal/config"
 	"github.com/abstractmelon/is-site-live/internal/database"
+	"github.com/abstractmelon/is-site-live/internal/metrics"
+	"github.com/abstractmelon/is-site-live/internal/models"
 	"github.com/abstractmelon/is-site-live/internal/monitoring"
+	"github.com/abstractmelon/is-site-live/internal/storage"
+	"github.com/abstractmelon/is-site-live/internal/tracing"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
 // Server represents the API server
 type Server struct {
 	router            *gin.Engine
 	config            *config.Config
-	db                *database.DB
+	store             *storage.Store
+	db                *database.DB // nil unless running on PostgreSQL
 	monitoringService *monitoring.Service
 	httpServer        *http.Server
 }
 
-// NewServer creates a new API server
-func NewServer(cfg *config.Config, db *database.DB, monitoringService *monitoring.Service) *Server {
+// NewServer creates a new API server. Routes for incidents, on-call,
+// digests, notifications and check history need PostgreSQL and answer with
+// 501 Not Implemented when db is nil.
+func NewServer(cfg *config.Config, store *storage.Store, db *database.DB, monitoringService *monitoring.Service) *Server {
 	// Create router
-	router := gin.Default()
+	router := gin.New()
+
+	// Trace requests, except health checks and metrics scrapes, then log them
+	router.Use(otelgin.Middleware(tracing.ServiceName, otelgin.WithFilter(func(r *http.Request) bool {
+		return !quietPaths[r.URL.Path]
+	})))
+	router.Use(requestLogger(), recoverer())
 
 	// Configure CORS
 	router.Use(cors.New(cors.Config{
@@ -41,6 +55,7 @@ func NewServer(cfg *config.Config, db *database.DB, monitoringService *monitorin
 	server := &Server{
 		router:            router,
 		config:            cfg,
+		store:             store,
 		db:                db,
 		monitoringService: monitoringService,
 		httpServer: &http.Server{
@@ -57,8 +72,13 @@ func NewServer(cfg *config.Config, db *database.DB, monitoringService *monitorin
 
 // setupRoutes sets up the API routes
 func (s *Server) setupRoutes() {
-	// Health check
+	// Health checks
 	s.router.GET("/health", s.healthCheck)
+	s.router.GET("/livez", s.livenessCheck)
+	s.router.GET("/readyz", s.readinessCheck)
+
+	// Prometheus metrics
+	s.router.GET("/metrics", auth.MetricsMiddleware(s.config.Server), gin.WrapH(metrics.Handler()))
 
 	// Auth routes
 	s.router.POST("/auth/register", s.register)
@@ -78,18 +98,97 @@ func (s *Server) setupRoutes() {
 		protected.GET("/sites/:id", s.getSite)
 		protected.PUT("/sites/:id", s.updateSite)
 		protected.DELETE("/sites/:id", s.deleteSite)
+		protected.GET("/sites/:id/checks.csv", s.exportChecksCSV)
+		protected.GET("/sites/:id/checks.ndjson", s.exportChecksNDJSON)
+		protected.GET("/sites/:id/sla-report.csv", s.exportSLAReportCSV)
+		protected.GET("/sites/:id/sla-report.json", s.exportSLAReportJSON)
 
 		// Custom domain routes
 		protected.POST("/domains", s.createCustomDomain)
 		protected.GET("/domains", s.getUserDomains)
 		protected.DELETE("/domains/:id", s.deleteCustomDomain)
 		protected.GET("/domains/:id/verify", s.verifyCustomDomain)
+
+		// Export and import routes
+		protected.GET("/export", s.exportConfig)
+		protected.POST("/import", s.importConfig)
+		protected.POST("/import/uptime-kuma", s.importUptimeKuma)
+		protected.POST("/import/uptimerobot", s.importUptimeRobot)
 	}
 
 	// Public routes
 	s.router.GET("/user/:username", s.getUserProfile)
 	s.router.GET("/site/:id/stats", s.getSiteStats)
 	s.router.GET("/domain/:domain", s.getDomainDashboard)
+
+	// Probe routes
+	s.router.POST("/probe/register", auth.AgentMiddleware(s.config.Server), s.registerProbe)
+	probe := s.router.Group("/probe")
+	probe.Use(auth.ProbeMiddleware(s.store.Probes))
+	{
+		probe.GET("/checks", s.getProbeChecks)
+		probe.POST("/results", s.pushProbeResults)
+	}
+
+	// Admin routes
+	admin := s.router.Group("/admin")
+	admin.Use(auth.AuthMiddleware(s.config.JWT), auth.AdminMiddleware(s.config.Server))
+	{
+		admin.GET("/probes", s.getProbes)
+		admin.DELETE("/probes/:id", s.deleteProbe)
+	}
+
+	// The remaining routes need PostgreSQL, without it they answer with 501
+	pg := s.postgresOnly
+	{
+		// Incident routes
+		protected.GET("/incidents", pg(s.getUserIncidents))
+		protected.POST("/incidents/:id/ack", pg(s.acknowledgeIncident))
+
+		// On-call schedule routes
+		protected.POST("/oncall/schedules", pg(s.createOnCallSchedule))
+		protected.GET("/oncall/schedules", pg(s.getUserOnCallSchedules))
+		protected.GET("/oncall/schedules/:id", pg(s.getOnCallSchedule))
+		protected.DELETE("/oncall/schedules/:id", pg(s.deleteOnCallSchedule))
+		protected.POST("/oncall/schedules/:id/overrides", pg(s.createOnCallOverride))
+		protected.DELETE("/oncall/schedules/:id/overrides/:overrideId", pg(s.deleteOnCallOverride))
+
+		// Users allowed to page the current user
+		protected.POST("/oncall/consents", pg(s.createOnCallConsent))
+		protected.GET("/oncall/consents", pg(s.getOnCallConsents))
+		protected.DELETE("/oncall/consents/:username", pg(s.deleteOnCallConsent))
+
+		// Escalation policy routes
+		protected.POST("/escalation-policies", pg(s.createEscalationPolicy))
+		protected.GET("/escalation-policies", pg(s.getUserEscalationPolicies))
+		protected.DELETE("/escalation-policies/:id", pg(s.deleteEscalationPolicy))
+	}
+
+	{
+		// Notification outbox routes
+		admin.GET("/notifications", pg(s.getNotificationStatus))
+		admin.POST("/notifications/:id/retry", pg(s.retryNotification))
+	}
+
+	// Public routes
+	s.router.GET("/site/:id/latency-histogram", pg(s.getLatencyHistogram))
+	s.router.GET("/site/:id/checks", pg(s.getSiteChecks))
+	s.router.GET("/site/:id/daily-uptime", pg(s.getDailyUptime))
+	s.router.GET("/incidents/:id/ack", pg(s.acknowledgeIncidentPage))
+	s.router.POST("/incidents/:id/ack/confirm", pg(s.acknowledgeIncidentLink))
+	s.router.GET("/digest/unsubscribe", pg(s.unsubscribeDigestPage))
+	s.router.POST("/digest/unsubscribe", pg(s.unsubscribeDigest))
+}
+
+// postgresOnly returns the handler of a route that needs PostgreSQL, or a
+// handler explaining that the route isn't available without it
+func (s *Server) postgresOnly(handler gin.HandlerFunc) gin.HandlerFunc {
+	if s.db != nil {
+		return handler
+	}
+	return func(c *gin.Context) {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "This feature requires PostgreSQL"})
+	}
 }
 
 // Start starts the API server
@@ -109,3 +208,25 @@ func (s *Server) healthCheck(c *gin.Context) {
 		"time":   time.Now(),
 	})
 }
+
+// livenessCheck handles the liveness endpoint, failing when the server is
+// stuck and should be restarted
+func (s *Server) livenessCheck(c *gin.Context) {
+	s.healthReport(c, s.monitoringService.GetLiveness())
+}
+
+// readinessCheck handles the readiness endpoint, failing when the server or
+// one of its dependencies doesn't work
+func (s *Server) readinessCheck(c *gin.Context) {
+	s.healthReport(c, s.monitoringService.GetReadiness(c.Request.Context()))
+}
+
+// healthReport responds with a health report, as a service unavailable
+// error if it's unhealthy
+func (s *Server) healthReport(c *gin.Context, report models.HealthReport) {
+	status := http.StatusOK
+	if report.Status != models.HealthOK {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
@@ -2,11 +2,16 @@ package api
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/abstractmelon/is-site-live/internal/models"
+	"github.com/abstractmelon/is-site-live/internal/monitoring"
+	"github.com/abstractmelon/is-site-live/internal/storage"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 )
 
 // createSite creates a new site
@@ -25,20 +30,16 @@ func (s *Server) createSite(c *gin.Context) {
 		return
 	}
 
+	// Check that the escalation policy belongs to the user
+	if !s.checkEscalationPolicy(c, siteCreation.EscalationPolicyID, userID) {
+		return
+	}
+	if !s.checkLocationQuorum(c, siteCreation.LocationQuorum) {
+		return
+	}
+
 	// Create site
-	var site models.Site
-	err := s.db.Pool.QueryRow(context.Background(), `
-		INSERT INTO sites (user_id, name, url)
-		VALUES ($1, $2, $3)
-		RETURNING id, user_id, name, url, created_at, updated_at
-	`, userID, siteCreation.Name, siteCreation.URL).Scan(
-		&site.ID,
-		&site.UserID,
-		&site.Name,
-		&site.URL,
-		&site.CreatedAt,
-		&site.UpdatedAt,
-	)
+	site, err := s.addSite(userID.(int), siteCreation)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create site"})
 		return
@@ -48,6 +49,16 @@ func (s *Server) createSite(c *gin.Context) {
 	c.JSON(http.StatusCreated, site)
 }
 
+// addSite validates a site and creates it for a user. It is the creation
+// path shared by createSite and the monitor importers; the escalation policy
+// is checked by the caller.
+func (s *Server) addSite(userID int, siteCreation models.SiteCreation) (*models.Site, error) {
+	if err := binding.Validator.ValidateStruct(&siteCreation); err != nil {
+		return nil, err
+	}
+	return s.store.Sites.Create(context.Background(), userID, siteCreation)
+}
+
 // getUserSites gets all sites for the current user
 func (s *Server) getUserSites(c *gin.Context) {
 	// Get user ID from context
@@ -58,35 +69,11 @@ func (s *Server) getUserSites(c *gin.Context) {
 	}
 
 	// Get sites from database
-	rows, err := s.db.Pool.Query(context.Background(), `
-		SELECT id, user_id, name, url, created_at, updated_at
-		FROM sites
-		WHERE user_id = $1
-		ORDER BY name
-	`, userID)
+	sites, err := s.store.Sites.ListByUser(c.Request.Context(), userID.(int))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get sites"})
 		return
 	}
-	defer rows.Close()
-
-	var sites []models.Site
-	for rows.Next() {
-		var site models.Site
-		err := rows.Scan(
-			&site.ID,
-			&site.UserID,
-			&site.Name,
-			&site.URL,
-			&site.CreatedAt,
-			&site.UpdatedAt,
-		)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan site"})
-			return
-		}
-		sites = append(sites, site)
-	}
 
 	// Return sites
 	c.JSON(http.StatusOK, sites)
@@ -109,20 +96,8 @@ func (s *Server) getSite(c *gin.Context) {
 	}
 
 	// Get site from database
-	var site models.Site
-	err = s.db.Pool.QueryRow(context.Background(), `
-		SELECT id, user_id, name, url, created_at, updated_at
-		FROM sites
-		WHERE id = $1 AND user_id = $2
-	`, siteID, userID).Scan(
-		&site.ID,
-		&site.UserID,
-		&site.Name,
-		&site.URL,
-		&site.CreatedAt,
-		&site.UpdatedAt,
-	)
-	if err != nil {
+	site, err := s.store.Sites.Get(c.Request.Context(), siteID)
+	if err != nil || site.UserID != userID.(int) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Site not found"})
 		return
 	}
@@ -154,21 +129,16 @@ func (s *Server) updateSite(c *gin.Context) {
 		return
 	}
 
+	// Check that the escalation policy belongs to the user
+	if !s.checkEscalationPolicy(c, siteUpdate.EscalationPolicyID, userID) {
+		return
+	}
+	if !s.checkLocationQuorum(c, siteUpdate.LocationQuorum) {
+		return
+	}
+
 	// Update site
-	var site models.Site
-	err = s.db.Pool.QueryRow(context.Background(), `
-		UPDATE sites
-		SET name = $1, url = $2, updated_at = NOW()
-		WHERE id = $3 AND user_id = $4
-		RETURNING id, user_id, name, url, created_at, updated_at
-	`, siteUpdate.Name, siteUpdate.URL, siteID, userID).Scan(
-		&site.ID,
-		&site.UserID,
-		&site.Name,
-		&site.URL,
-		&site.CreatedAt,
-		&site.UpdatedAt,
-	)
+	site, err := s.store.Sites.Update(c.Request.Context(), siteID, userID.(int), siteUpdate)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Site not found"})
 		return
@@ -195,19 +165,13 @@ func (s *Server) deleteSite(c *gin.Context) {
 	}
 
 	// Delete site
-	result, err := s.db.Pool.Exec(context.Background(), `
-		DELETE FROM sites
-		WHERE id = $1 AND user_id = $2
-	`, siteID, userID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete site"})
+	err = s.store.Sites.Delete(c.Request.Context(), siteID, userID.(int))
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Site not found"})
 		return
 	}
-
-	// Check if site was found
-	rowsAffected := result.RowsAffected()
-	if rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Site not found"})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete site"})
 		return
 	}
 
@@ -234,3 +198,181 @@ func (s *Server) getSiteStats(c *gin.Context) {
 	// Return site stats
 	c.JSON(http.StatusOK, siteWithStats)
 }
+
+// getLatencyHistogram handles getting the response time histogram of a site.
+// The optional days query parameter limits it to the last number of days.
+func (s *Server) getLatencyHistogram(c *gin.Context) {
+	// Get site ID from URL
+	siteID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid site ID"})
+		return
+	}
+
+	// Get period from query
+	days := 0
+	if value := c.Query("days"); value != "" {
+		days, err = strconv.Atoi(value)
+		if err != nil || days < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid number of days"})
+			return
+		}
+	}
+
+	// Get histogram
+	histogram, err := s.monitoringService.GetLatencyHistogram(siteID, days)
+	if errors.Is(err, monitoring.ErrSiteNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Site not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get latency histogram"})
+		return
+	}
+
+	// Return histogram
+	c.JSON(http.StatusOK, histogram)
+}
+
+// Check history limits
+const (
+	maxSeriesPoints      = 5000
+	defaultCheckPageSize = 500
+	maxCheckPageSize     = 1000
+)
+
+// getSiteChecks handles getting the check history of a site for charts.
+// It takes optional from and to times (RFC 3339, defaulting to the last 24
+// hours) and a resolution of raw, minute, hour or day, picked from the length
+// of the period if omitted. Raw checks are paginated with the cursor and
+// limit parameters.
+func (s *Server) getSiteChecks(c *gin.Context) {
+	// Get site ID from URL
+	siteID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid site ID"})
+		return
+	}
+
+	// Get period from query
+	to := time.Now()
+	if value := c.Query("to"); value != "" {
+		to, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to time, expected RFC 3339"})
+			return
+		}
+	}
+	from := to.Add(-24 * time.Hour)
+	if value := c.Query("from"); value != "" {
+		from, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from time, expected RFC 3339"})
+			return
+		}
+	}
+	if !from.Before(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return
+	}
+
+	// Pick a resolution that keeps charts readable if none was given
+	resolution := c.Query("resolution")
+	if resolution == "" {
+		switch span := to.Sub(from); {
+		case span <= 6*time.Hour:
+			resolution = models.ResolutionMinute
+		case span <= 14*24*time.Hour:
+			resolution = models.ResolutionHour
+		default:
+			resolution = models.ResolutionDay
+		}
+	}
+
+	var result interface{}
+	switch resolution {
+	case models.ResolutionRaw:
+		limit := defaultCheckPageSize
+		if value := c.Query("limit"); value != "" {
+			limit, err = strconv.Atoi(value)
+			if err != nil || limit < 1 || limit > maxCheckPageSize {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit, expected 1 to " + strconv.Itoa(maxCheckPageSize)})
+				return
+			}
+		}
+		result, err = s.monitoringService.GetChecks(siteID, from, to, c.Query("cursor"), limit)
+	case models.ResolutionMinute, models.ResolutionHour, models.ResolutionDay:
+		if to.Sub(from)/models.ResolutionBucketSize(resolution) > maxSeriesPoints {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Too many points, use a coarser resolution or a shorter period"})
+			return
+		}
+		result, err = s.monitoringService.GetCheckSeries(siteID, from, to, resolution)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid resolution, expected raw, minute, hour or day"})
+		return
+	}
+	if errors.Is(err, monitoring.ErrSiteNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Site not found"})
+		return
+	}
+	if errors.Is(err, monitoring.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get check history"})
+		return
+	}
+
+	// Return history
+	c.JSON(http.StatusOK, result)
+}
+
+// getDailyUptime handles getting the daily uptime bars of a site. The
+// optional days query parameter defaults to 90.
+func (s *Server) getDailyUptime(c *gin.Context) {
+	// Get site ID from URL
+	siteID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid site ID"})
+		return
+	}
+
+	// Get number of days from query
+	days := monitoring.DailyUptimeDays
+	if value := c.Query("days"); value != "" {
+		days, err = strconv.Atoi(value)
+		if err != nil || days < 1 || days > 366 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid number of days, expected 1 to 366"})
+			return
+		}
+	}
+
+	// Get daily uptime
+	dailyUptime, err := s.monitoringService.GetDailyUptime(siteID, days)
+	if errors.Is(err, monitoring.ErrSiteNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Site not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get daily uptime"})
+		return
+	}
+
+	// Return daily uptime
+	c.JSON(http.StatusOK, dailyUptime)
+}
+
+// siteSummaries adds the current status and daily uptime bars to sites shown
+// on status pages, from the precomputed site snapshots
+func (s *Server) siteSummaries(sites []models.Site) ([]models.SiteWithDailyUptime, error) {
+	result := make([]models.SiteWithDailyUptime, 0, len(sites))
+	for _, site := range sites {
+		summary, err := s.monitoringService.GetSiteSummary(site)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, summary)
+	}
+	return result, nil
+}
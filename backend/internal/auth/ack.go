@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/abstractmelon/is-site-live/internal/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// AckClaims represents the claims of a signed incident acknowledgement link
+type AckClaims struct {
+	IncidentID int `json:"incident_id"`
+	UserID     int `json:"user_id"`
+	jwt.RegisteredClaims
+}
+
+// ackKey derives the signing key for acknowledgement tokens. A separate key
+// keeps ack links from being accepted as login tokens and vice versa.
+func ackKey(cfg config.JWTConfig) []byte {
+	return []byte(cfg.Secret + ":incident-ack")
+}
+
+// GenerateAckToken generates a token allowing a user to acknowledge an incident
+func GenerateAckToken(incidentID, userID int, cfg config.JWTConfig) (string, error) {
+	// Ack links stay valid for a week
+	expirationTime := time.Now().Add(7 * 24 * time.Hour)
+
+	// Create claims
+	claims := &AckClaims{
+		IncidentID: incidentID,
+		UserID:     userID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expirationTime),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Subject:   fmt.Sprintf("%d", userID),
+		},
+	}
+
+	// Create and sign token
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(ackKey(cfg))
+}
+
+// ValidateAckToken validates an incident acknowledgement token
+func ValidateAckToken(tokenString string, cfg config.JWTConfig) (*AckClaims, error) {
+	// Parse token
+	token, err := jwt.ParseWithClaims(tokenString, &AckClaims{}, func(token *jwt.Token) (interface{}, error) {
+		// Validate signing method
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+
+		return ackKey(cfg), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Get claims
+	claims, ok := token.Claims.(*AckClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	return claims, nil
+}
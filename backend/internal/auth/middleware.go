@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"crypto/subtle"
 	"net/http"
 	"strings"
 
@@ -45,3 +46,44 @@ func AuthMiddleware(cfg config.JWTConfig) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// AdminMiddleware creates a middleware restricting routes to the configured
+// admin users. It must run after AuthMiddleware.
+func AdminMiddleware(cfg config.ServerConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Get username from context
+		username := c.GetString("username")
+
+		// Check if the user is an admin
+		for _, admin := range cfg.AdminUsernames {
+			if username != "" && username == admin {
+				c.Next()
+				return
+			}
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{"error": "admin access required"})
+		c.Abort()
+	}
+}
+
+// MetricsMiddleware creates a middleware requiring the configured metrics
+// token as a bearer token. Requests are let through when no token is set.
+func MetricsMiddleware(cfg config.ServerConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if cfg.MetricsToken == "" {
+			c.Next()
+			return
+		}
+
+		// Compare in constant time so the token can't be guessed byte by byte
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(cfg.MetricsToken)) != 1 {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid metrics token"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
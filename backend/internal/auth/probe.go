@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/abstractmelon/is-site-live/internal/config"
+	"github.com/abstractmelon/is-site-live/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// probeSeenInterval is how often the last time a probe was seen is recorded,
+// so busy probes don't write to the database on every request
+const probeSeenInterval = time.Minute
+
+// HashToken hashes a probe token for storage. Tokens are random, so a plain
+// hash is enough to keep a database leak from revealing them.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// AgentMiddleware creates a middleware requiring the configured agent token
+// as a bearer token, for probes registering. Probes are disabled when no
+// token is set.
+func AgentMiddleware(cfg config.ServerConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if cfg.ProbeToken == "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "probes are disabled"})
+			c.Abort()
+			return
+		}
+
+		// Compare in constant time so the token can't be guessed byte by byte
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(cfg.ProbeToken)) != 1 {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid agent token"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// ProbeMiddleware creates a middleware authenticating registered probes by
+// the bearer token they got when registering
+func ProbeMiddleware(probes storage.ProbeRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if token == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "authorization header is required"})
+			c.Abort()
+			return
+		}
+
+		// Look the probe up by the hash of its token
+		probe, err := probes.GetByTokenHash(c.Request.Context(), HashToken(token))
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid probe token"})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to authenticate probe"})
+			c.Abort()
+			return
+		}
+
+		// Keep track of when the probe was last heard from
+		if probe.LastSeenAt == nil || time.Since(*probe.LastSeenAt) >= probeSeenInterval {
+			if err := probes.MarkSeen(c.Request.Context(), probe.ID); err != nil {
+				slog.ErrorContext(c.Request.Context(), "Error recording probe activity", "probe_id", probe.ID, "error", err)
+			}
+		}
+
+		// Set the probe in context
+		c.Set("probe", *probe)
+
+		c.Next()
+	}
+}
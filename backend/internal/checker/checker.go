@@ -0,0 +1,138 @@
+// Package checker checks sites over HTTP. The server and the remote probes
+// share it, so a site is checked the same way from every location.
+package checker
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Result is the outcome of a check
+type Result struct {
+	StatusCode    int
+	ResponseTime  int // in milliseconds
+	IsUp          bool
+	ErrorMessage  string
+	CertExpiresAt *time.Time // when the site's certificate expires, nil without TLS
+}
+
+// NewClient creates the HTTP client checks are sent with. It refuses to
+// connect to private IPs, so sites can't be used to reach the network the
+// checks run from.
+func NewClient() *http.Client {
+	// Create HTTP client with timeout
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				// Parse the address to get the host
+				host, _, err := net.SplitHostPort(addr)
+				if err != nil {
+					// If SplitHostPort fails, assume the address is just a host
+					host = addr
+				}
+
+				// Check if the host is a private IP
+				ip := net.ParseIP(host)
+				if ip != nil && (ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast()) {
+					return nil, fmt.Errorf("connection to private IP %s is not allowed", host)
+				}
+
+				// Use the default dialer
+				dialer := &net.Dialer{
+					Timeout:   5 * time.Second,
+					KeepAlive: 30 * time.Second,
+				}
+				return dialer.DialContext(ctx, network, addr)
+			},
+		},
+	}
+}
+
+// Check requests a site, which is up if it answers with a 2xx or 3xx status.
+// The phases of the request are traced as child spans of the span in ctx,
+// which gets the result too. With propagateTrace, the trace context is sent
+// to the site in a traceparent header.
+func Check(ctx context.Context, client *http.Client, siteURL string, propagateTrace bool) Result {
+	result := check(ctx, client, siteURL, propagateTrace)
+
+	// Record the result on the span
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.Bool("check.up", result.IsUp))
+	if result.StatusCode != 0 {
+		span.SetAttributes(semconv.HTTPResponseStatusCode(result.StatusCode))
+	}
+	if !result.IsUp && result.ErrorMessage != "" {
+		span.SetStatus(codes.Error, result.ErrorMessage)
+	} else if !result.IsUp {
+		span.SetStatus(codes.Error, fmt.Sprintf("HTTP status %d", result.StatusCode))
+	}
+
+	return result
+}
+
+// check runs the request of a check
+func check(ctx context.Context, client *http.Client, siteURL string, propagateTrace bool) Result {
+	// Parse the URL
+	parsedURL, err := url.Parse(siteURL)
+	if err != nil {
+		return Result{ErrorMessage: fmt.Sprintf("Invalid URL: %v", err)}
+	}
+
+	// Ensure the URL has a scheme
+	if parsedURL.Scheme == "" {
+		parsedURL.Scheme = "http"
+	}
+
+	// Create a new request, tracing its phases
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, newPhaseTrace(ctx)), http.MethodGet, parsedURL.String(), nil)
+	if err != nil {
+		return Result{ErrorMessage: fmt.Sprintf("Failed to create request: %v", err)}
+	}
+
+	// Set a user agent
+	req.Header.Set("User-Agent", "IsItLive Monitoring/1.0")
+
+	// Send the trace context to sites that opted in
+	if propagateTrace {
+		otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	}
+
+	// Start the timer
+	startTime := time.Now()
+
+	// Send the request
+	resp, err := client.Do(req)
+	if err != nil {
+		return Result{ErrorMessage: fmt.Sprintf("Request failed: %v", err)}
+	}
+	defer resp.Body.Close()
+
+	result := Result{
+		StatusCode: resp.StatusCode,
+		// Calculate response time
+		ResponseTime: int(time.Since(startTime).Milliseconds()),
+		// Determine if the site is up (2xx or 3xx status codes)
+		IsUp: resp.StatusCode >= 200 && resp.StatusCode < 400,
+	}
+
+	// Keep track of when the site's certificate expires
+	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		expiresAt := resp.TLS.PeerCertificates[0].NotAfter
+		result.CertExpiresAt = &expiresAt
+	}
+
+	return result
+}
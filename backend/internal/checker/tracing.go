@@ -0,0 +1,90 @@
+package checker
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates the spans of the request phases
+var tracer = otel.Tracer("github.com/abstractmelon/is-site-live/internal/checker")
+
+// phaseTracer records the phases of a check request, DNS lookup, connect,
+// TLS handshake and waiting for the response, as child spans of the check
+type phaseTracer struct {
+	ctx context.Context
+
+	mu       sync.Mutex
+	dnsStart time.Time
+	connects map[string]time.Time // start of each dial, several may race
+	tlsStart time.Time
+	wroteAt  time.Time
+}
+
+// newPhaseTrace creates the client trace recording the phases of a check
+// request under the span in ctx
+func newPhaseTrace(ctx context.Context) *httptrace.ClientTrace {
+	t := &phaseTracer{ctx: ctx, connects: make(map[string]time.Time)}
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.mu.Lock()
+			t.dnsStart = time.Now()
+			t.mu.Unlock()
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.record("dns", t.dnsStart, info.Err)
+		},
+		ConnectStart: func(network, addr string) {
+			t.mu.Lock()
+			t.connects[network+" "+addr] = time.Now()
+			t.mu.Unlock()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.record("connect", t.connects[network+" "+addr], err, attribute.String("net.peer.address", addr))
+		},
+		TLSHandshakeStart: func() {
+			t.mu.Lock()
+			t.tlsStart = time.Now()
+			t.mu.Unlock()
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.record("tls", t.tlsStart, err)
+		},
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			t.mu.Lock()
+			t.wroteAt = time.Now()
+			t.mu.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.record("wait", t.wroteAt, nil)
+		},
+	}
+}
+
+// record adds a finished phase as a child span. Callers hold the lock.
+func (t *phaseTracer) record(name string, start time.Time, err error, attrs ...attribute.KeyValue) {
+	if start.IsZero() {
+		return
+	}
+	_, span := tracer.Start(t.ctx, name, trace.WithTimestamp(start), trace.WithAttributes(attrs...))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
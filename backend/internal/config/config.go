@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -15,20 +16,30 @@ type Config struct {
 	JWT        JWTConfig
 	SMTP       SMTPConfig
 	Monitoring MonitoringConfig
+	Alerts     AlertsConfig
+	Outbox     OutboxConfig
+	Tracing    TracingConfig
+	Logging    LoggingConfig
 }
 
 // ServerConfig holds the server configuration
 type ServerConfig struct {
-	Address string
+	Address        string
+	PublicURL      string   // base URL used in links sent to users, e.g. in emails
+	AdminUsernames []string // users allowed to use the admin endpoints
+	MetricsToken   string   // bearer token required by /metrics, empty leaves it open
+	ProbeToken     string   // agent token probes register with, empty disables probes
 }
 
 // DatabaseConfig holds the database configuration
 type DatabaseConfig struct {
-	Host     string
-	Port     string
-	User     string
-	Password string
-	Name     string
+	Driver     string // postgres or sqlite
+	SQLitePath string // database file used by the sqlite driver
+	Host       string
+	Port       string
+	User       string
+	Password   string
+	Name       string
 }
 
 // JWTConfig holds the JWT configuration
@@ -38,17 +49,55 @@ type JWTConfig struct {
 
 // SMTPConfig holds the SMTP configuration
 type SMTPConfig struct {
-	Host     string
-	Port     int
-	User     string
-	Password string
-	From     string
+	Host        string
+	Port        int
+	User        string
+	Password    string
+	From        string
+	TemplateDir string // optional directory with email templates overriding the defaults
 }
 
 // MonitoringConfig holds the monitoring configuration
 type MonitoringConfig struct {
-	Interval time.Duration
-	Workers  int
+	Interval  time.Duration
+	Workers   int
+	Retention time.Duration // how long raw checks are kept, 0 keeps them forever
+	Location  string        // location of the server's own checks
+}
+
+// MaxCheckGap is how long the result of a check is assumed to hold when no
+// newer check follows. Longer gaps, e.g. while the server was down, count as
+// having no data.
+func (c MonitoringConfig) MaxCheckGap() time.Duration {
+	return 2 * c.Interval
+}
+
+// AlertsConfig holds the alert flapping and rate limiting configuration
+type AlertsConfig struct {
+	FlapWindow          int     // number of recent checks used to detect flapping
+	FlapHighThreshold   float64 // state change percentage above which a site starts flapping
+	FlapLowThreshold    float64 // state change percentage below which a site stops flapping
+	RateLimitPerUser    int     // maximum alerts per user per window, 0 disables the limit
+	RateLimitPerChannel int     // maximum alerts per channel per window, 0 disables the limit
+	RateLimitWindow     time.Duration
+}
+
+// OutboxConfig holds the notification outbox configuration
+type OutboxConfig struct {
+	MaxAttempts   int           // attempts before a notification is dead-lettered
+	RetryDelay    time.Duration // delay before the first retry, doubled on every attempt
+	MaxRetryDelay time.Duration
+}
+
+// TracingConfig holds the OpenTelemetry tracing configuration
+type TracingConfig struct {
+	Endpoint string // OTLP/HTTP endpoint spans are exported to, empty disables tracing
+}
+
+// LoggingConfig holds the logging configuration
+type LoggingConfig struct {
+	Format string // text or json
+	Level  string // debug, info, warn or error
 }
 
 // Load loads the configuration from environment variables
@@ -58,8 +107,14 @@ func Load() (*Config, error) {
 
 	// Server config
 	serverAddress := getEnv("SERVER_ADDRESS", ":8080")
+	publicURL := getEnv("PUBLIC_URL", "http://localhost:8080")
+	adminUsernames := splitList(getEnv("ADMIN_USERNAMES", ""))
+	metricsToken := getEnv("METRICS_TOKEN", "")
+	probeToken := getEnv("PROBE_AGENT_TOKEN", "")
 
 	// Database config
+	dbDriver := getEnv("DB_DRIVER", "postgres")
+	sqlitePath := getEnv("SQLITE_PATH", "isitlive.db")
 	dbHost := getEnv("DB_HOST", "localhost")
 	dbPort := getEnv("DB_PORT", "5432")
 	dbUser := getEnv("DB_USER", "isitlive")
@@ -76,41 +131,104 @@ func Load() (*Config, error) {
 	smtpUser := getEnv("SMTP_USER", "")
 	smtpPassword := getEnv("SMTP_PASSWORD", "")
 	smtpFrom := getEnv("SMTP_FROM", "")
+	emailTemplateDir := getEnv("EMAIL_TEMPLATE_DIR", "")
 
 	// Monitoring config
 	monitoringIntervalStr := getEnv("MONITORING_INTERVAL", "60")
 	monitoringInterval, _ := strconv.Atoi(monitoringIntervalStr)
 	monitoringWorkersStr := getEnv("MONITORING_WORKERS", "10")
 	monitoringWorkers, _ := strconv.Atoi(monitoringWorkersStr)
+	checkRetentionDays, _ := strconv.Atoi(getEnv("CHECK_RETENTION_DAYS", "0"))
+	monitoringLocation := getEnv("MONITORING_LOCATION", "server")
+
+	// Alerts config
+	flapWindow, _ := strconv.Atoi(getEnv("FLAP_WINDOW", "21"))
+	flapHighThreshold, _ := strconv.ParseFloat(getEnv("FLAP_HIGH_THRESHOLD", "50"), 64)
+	flapLowThreshold, _ := strconv.ParseFloat(getEnv("FLAP_LOW_THRESHOLD", "25"), 64)
+	rateLimitPerUser, _ := strconv.Atoi(getEnv("ALERT_RATE_LIMIT_PER_USER", "20"))
+	rateLimitPerChannel, _ := strconv.Atoi(getEnv("ALERT_RATE_LIMIT_PER_CHANNEL", "200"))
+	rateLimitWindow, _ := strconv.Atoi(getEnv("ALERT_RATE_LIMIT_WINDOW", "3600"))
+
+	// Tracing config
+	otlpEndpoint := getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", getEnv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", ""))
+
+	// Logging config
+	logFormat := getEnv("LOG_FORMAT", "text")
+	logLevel := getEnv("LOG_LEVEL", "info")
+
+	// Outbox config
+	outboxMaxAttempts, _ := strconv.Atoi(getEnv("NOTIFICATION_MAX_ATTEMPTS", "8"))
+	outboxRetryDelay, _ := strconv.Atoi(getEnv("NOTIFICATION_RETRY_DELAY", "30"))
+	outboxMaxRetryDelay, _ := strconv.Atoi(getEnv("NOTIFICATION_MAX_RETRY_DELAY", "3600"))
 
 	return &Config{
 		Server: ServerConfig{
-			Address: serverAddress,
+			Address:        serverAddress,
+			PublicURL:      publicURL,
+			AdminUsernames: adminUsernames,
+			MetricsToken:   metricsToken,
+			ProbeToken:     probeToken,
 		},
 		Database: DatabaseConfig{
-			Host:     dbHost,
-			Port:     dbPort,
-			User:     dbUser,
-			Password: dbPassword,
-			Name:     dbName,
+			Driver:     dbDriver,
+			SQLitePath: sqlitePath,
+			Host:       dbHost,
+			Port:       dbPort,
+			User:       dbUser,
+			Password:   dbPassword,
+			Name:       dbName,
 		},
 		JWT: JWTConfig{
 			Secret: jwtSecret,
 		},
 		SMTP: SMTPConfig{
-			Host:     smtpHost,
-			Port:     smtpPort,
-			User:     smtpUser,
-			Password: smtpPassword,
-			From:     smtpFrom,
+			Host:        smtpHost,
+			Port:        smtpPort,
+			User:        smtpUser,
+			Password:    smtpPassword,
+			From:        smtpFrom,
+			TemplateDir: emailTemplateDir,
 		},
 		Monitoring: MonitoringConfig{
-			Interval: time.Duration(monitoringInterval) * time.Second,
-			Workers:  monitoringWorkers,
+			Interval:  time.Duration(monitoringInterval) * time.Second,
+			Workers:   monitoringWorkers,
+			Retention: time.Duration(checkRetentionDays) * 24 * time.Hour,
+			Location:  monitoringLocation,
+		},
+		Alerts: AlertsConfig{
+			FlapWindow:          flapWindow,
+			FlapHighThreshold:   flapHighThreshold,
+			FlapLowThreshold:    flapLowThreshold,
+			RateLimitPerUser:    rateLimitPerUser,
+			RateLimitPerChannel: rateLimitPerChannel,
+			RateLimitWindow:     time.Duration(rateLimitWindow) * time.Second,
+		},
+		Outbox: OutboxConfig{
+			MaxAttempts:   outboxMaxAttempts,
+			RetryDelay:    time.Duration(outboxRetryDelay) * time.Second,
+			MaxRetryDelay: time.Duration(outboxMaxRetryDelay) * time.Second,
+		},
+		Tracing: TracingConfig{
+			Endpoint: otlpEndpoint,
+		},
+		Logging: LoggingConfig{
+			Format: logFormat,
+			Level:  logLevel,
 		},
 	}, nil
 }
 
+// splitList splits a comma-separated list, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 // getEnv gets an environment variable or returns a default value
 func getEnv(key, defaultValue string) string {
 	value := os.Getenv(key)
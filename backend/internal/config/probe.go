@@ -0,0 +1,58 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"strconv"
+
+	"github.com/joho/godotenv"
+)
+
+// ProbeConfig holds the configuration of a remote probe agent
+type ProbeConfig struct {
+	ServerURL  string // base URL of the backend the probe reports to
+	AgentToken string // agent token the probe registers with
+	Name       string // unique name of the probe, the hostname by default
+	Location   string // where the probe runs, e.g. eu-west
+	Workers    int    // sites checked at once
+	TokenFile  string // file the probe keeps its token in across restarts
+	Logging    LoggingConfig
+}
+
+// LoadProbe loads the probe configuration from environment variables
+func LoadProbe() (*ProbeConfig, error) {
+	// Load .env file if it exists
+	_ = godotenv.Load()
+
+	hostname, _ := os.Hostname()
+	workers, _ := strconv.Atoi(getEnv("PROBE_WORKERS", "10"))
+
+	cfg := &ProbeConfig{
+		ServerURL:  getEnv("PROBE_SERVER_URL", ""),
+		AgentToken: getEnv("PROBE_AGENT_TOKEN", ""),
+		Name:       getEnv("PROBE_NAME", hostname),
+		Location:   getEnv("PROBE_LOCATION", ""),
+		Workers:    workers,
+		TokenFile:  getEnv("PROBE_TOKEN_FILE", "probe.token"),
+		Logging: LoggingConfig{
+			Format: getEnv("LOG_FORMAT", "text"),
+			Level:  getEnv("LOG_LEVEL", "info"),
+		},
+	}
+
+	switch {
+	case cfg.ServerURL == "":
+		return nil, errors.New("PROBE_SERVER_URL is required")
+	case cfg.AgentToken == "":
+		return nil, errors.New("PROBE_AGENT_TOKEN is required")
+	case cfg.Location == "":
+		return nil, errors.New("PROBE_LOCATION is required")
+	case cfg.Name == "":
+		return nil, errors.New("PROBE_NAME is required")
+	case cfg.Workers < 1:
+		return nil, errors.New("PROBE_WORKERS must be at least 1")
+	case cfg.TokenFile == "":
+		return nil, errors.New("PROBE_TOKEN_FILE is required")
+	}
+	return cfg, nil
+}
@@ -0,0 +1,274 @@
+package database
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID is the advisory lock held while migrating, so that several
+// instances starting at once don't run the same migration
+const migrationLockID = 4738120951
+
+// Migration is a numbered schema change with the SQL to apply and revert it
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus reports whether a migration has been applied
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+// loadMigrations reads the embedded migrations, named
+// <version>_<name>.up.sql and <version>_<name>.down.sql, sorted by version
+func loadMigrations() ([]Migration, error) {
+	files, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %v", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, file := range files {
+		base, direction, ok := strings.Cut(strings.TrimSuffix(file.Name(), ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("invalid migration file name %s", file.Name())
+		}
+		versionText, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("invalid migration file name %s", file.Name())
+		}
+		version, err := strconv.Atoi(versionText)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration version in %s", file.Name())
+		}
+
+		source, err := migrationFiles.ReadFile(path.Join("migrations", file.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %v", file.Name(), err)
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		} else if migration.Name != name {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, migration.Name, name)
+		}
+		if direction == "up" {
+			migration.Up = string(source)
+		} else {
+			migration.Down = string(source)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Migrate applies every migration that hasn't been applied yet
+func Migrate(db *DB) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	return withMigrationLock(db, func(conn *pgxpool.Conn) error {
+		applied, err := appliedMigrations(conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+
+			err := runMigration(conn, migration.Up, `
+				INSERT INTO schema_migrations (version, name) VALUES ($1, $2)
+			`, migration.Version, migration.Name)
+			if err != nil {
+				return fmt.Errorf("failed to apply migration %d_%s: %v", migration.Version, migration.Name, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// MigrateDown reverts the given number of most recently applied migrations
+func MigrateDown(db *DB, steps int) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	return withMigrationLock(db, func(conn *pgxpool.Conn) error {
+		applied, err := appliedMigrations(conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+			migration := migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+
+			err := runMigration(conn, migration.Down, `
+				DELETE FROM schema_migrations WHERE version = $1
+			`, migration.Version)
+			if err != nil {
+				return fmt.Errorf("failed to revert migration %d_%s: %v", migration.Version, migration.Name, err)
+			}
+			steps--
+		}
+
+		return nil
+	})
+}
+
+// GetMigrationStatus lists every migration and when it was applied
+func GetMigrationStatus(db *DB) ([]MigrationStatus, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []MigrationStatus
+	err = withMigrationLock(db, func(conn *pgxpool.Conn) error {
+		applied, err := appliedMigrations(conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range migrations {
+			status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+			if appliedAt, ok := applied[migration.Version]; ok {
+				status.AppliedAt = &appliedAt
+			}
+			statuses = append(statuses, status)
+		}
+		return nil
+	})
+
+	return statuses, err
+}
+
+// GetSchemaVersion gets the highest applied migration and the highest
+// migration this build knows. Unlike GetMigrationStatus it doesn't wait for
+// running migrations, so it can be used by health checks.
+func GetSchemaVersion(ctx context.Context, db *DB) (current, latest int, err error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(migrations) > 0 {
+		latest = migrations[len(migrations)-1].Version
+	}
+
+	err = db.Pool.QueryRow(ctx, `
+		SELECT COALESCE(MAX(version), 0) FROM schema_migrations
+	`).Scan(&current)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get schema version: %v", err)
+	}
+	return current, latest, nil
+}
+
+// withMigrationLock runs fn on a single connection holding the migration
+// advisory lock, creating the schema_migrations table if needed
+func withMigrationLock(db *DB, fn func(conn *pgxpool.Conn) error) error {
+	conn, err := db.Pool.Acquire(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %v", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(context.Background(), `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %v", err)
+	}
+	defer conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockID)
+
+	_, err = conn.Exec(context.Background(), `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %v", err)
+	}
+
+	return fn(conn)
+}
+
+// appliedMigrations returns when each applied migration was applied
+func appliedMigrations(conn *pgxpool.Conn) (map[int]time.Time, error) {
+	rows, err := conn.Query(context.Background(), `
+		SELECT version, applied_at FROM schema_migrations
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get applied migrations: %v", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+// runMigration runs migration SQL and the matching schema_migrations update
+// in one transaction
+func runMigration(conn *pgxpool.Conn, sql, record string, args ...any) error {
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	// Without arguments Exec uses the simple protocol, which allows several
+	// statements in one call
+	if _, err := tx.Exec(context.Background(), sql); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(context.Background(), record, args...); err != nil {
+		return err
+	}
+
+	return tx.Commit(context.Background())
+}
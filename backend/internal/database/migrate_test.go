@@ -0,0 +1,180 @@
+package database
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// scratchDB connects to the scratch PostgreSQL database in TEST_DATABASE_URL
+// and empties it, skipping the test when the variable is not set. Everything
+// in the database's public schema is dropped.
+func scratchDB(t *testing.T) *DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	pool, err := pgxpool.New(context.Background(), dsn)
+	if err != nil {
+		t.Fatalf("connecting to the scratch database: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	_, err = pool.Exec(context.Background(), `DROP SCHEMA public CASCADE; CREATE SCHEMA public`)
+	if err != nil {
+		t.Fatalf("emptying the scratch database: %v", err)
+	}
+	return &DB{Pool: pool}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatalf("loading migrations: %v", err)
+	}
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			t.Errorf("migration %d_%s should be version %d", migration.Version, migration.Name, i+1)
+		}
+	}
+}
+
+func TestMigrateUpDownUp(t *testing.T) {
+	db := scratchDB(t)
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatalf("loading migrations: %v", err)
+	}
+
+	if err := Migrate(db); err != nil {
+		t.Fatalf("migrating up: %v", err)
+	}
+	checkAppliedMigrations(t, db, migrations)
+
+	if err := MigrateDown(db, len(migrations)); err != nil {
+		t.Fatalf("migrating down: %v", err)
+	}
+	checkAppliedMigrations(t, db, nil)
+
+	// The down migrations must remove everything the up migrations created
+	var tables []string
+	rows, err := db.Pool.Query(context.Background(), `
+		SELECT table_name FROM information_schema.tables
+		WHERE table_schema = 'public' AND table_name <> 'schema_migrations'
+	`)
+	if err != nil {
+		t.Fatalf("listing tables: %v", err)
+	}
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			t.Fatalf("scanning table: %v", err)
+		}
+		tables = append(tables, table)
+	}
+	rows.Close()
+	if len(tables) > 0 {
+		t.Errorf("tables left after migrating down: %v", tables)
+	}
+
+	if err := Migrate(db); err != nil {
+		t.Fatalf("migrating up again: %v", err)
+	}
+	checkAppliedMigrations(t, db, migrations)
+}
+
+func TestMigrateConcurrently(t *testing.T) {
+	db := scratchDB(t)
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatalf("loading migrations: %v", err)
+	}
+
+	// Both calls applying the same migrations at once would fail on the
+	// duplicate schema_migrations rows
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() { errs <- Migrate(db) }()
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("concurrent migration: %v", err)
+		}
+	}
+	checkAppliedMigrations(t, db, migrations)
+}
+
+func TestMigrateWaitsForLock(t *testing.T) {
+	db := scratchDB(t)
+
+	conn, err := db.Pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("acquiring connection: %v", err)
+	}
+	defer conn.Release()
+	if _, err := conn.Exec(context.Background(), `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+		t.Fatalf("taking the migration lock: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- Migrate(db) }()
+
+	select {
+	case err := <-done:
+		t.Fatalf("Migrate returned while another session held the lock: %v", err)
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	if _, err := conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockID); err != nil {
+		t.Fatalf("releasing the migration lock: %v", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("migrating after the lock was released: %v", err)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("Migrate did not finish after the lock was released")
+	}
+}
+
+// checkAppliedMigrations compares schema_migrations with the migrations that
+// should have been applied
+func checkAppliedMigrations(t *testing.T, db *DB, want []Migration) {
+	t.Helper()
+
+	rows, err := db.Pool.Query(context.Background(), `
+		SELECT version, name FROM schema_migrations ORDER BY version
+	`)
+	if err != nil {
+		t.Fatalf("getting applied migrations: %v", err)
+	}
+	defer rows.Close()
+
+	var got []Migration
+	for rows.Next() {
+		var migration Migration
+		if err := rows.Scan(&migration.Version, &migration.Name); err != nil {
+			t.Fatalf("scanning applied migration: %v", err)
+		}
+		got = append(got, migration)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("getting applied migrations: %v", err)
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("%d migrations applied, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Version != want[i].Version || got[i].Name != want[i].Name {
+			t.Errorf("applied migration %d_%s, want %d_%s", got[i].Version, got[i].Name, want[i].Version, want[i].Name)
+		}
+	}
+}
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS custom_domains;
+DROP TABLE IF EXISTS checks;
+DROP TABLE IF EXISTS sites;
+DROP TABLE IF EXISTS users;
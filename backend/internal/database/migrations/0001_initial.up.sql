@@ -0,0 +1,49 @@
+CREATE TABLE IF NOT EXISTS users (
+	id SERIAL PRIMARY KEY,
+	username VARCHAR(50) UNIQUE NOT NULL,
+	password_hash VARCHAR(255) NOT NULL,
+	email VARCHAR(255),
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS sites (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+	name VARCHAR(100) NOT NULL,
+	url VARCHAR(255) NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	UNIQUE(user_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS checks (
+	id SERIAL,
+	site_id INTEGER REFERENCES sites(id) ON DELETE CASCADE,
+	status_code INTEGER,
+	response_time INTEGER, -- in milliseconds
+	is_up BOOLEAN NOT NULL,
+	error_message TEXT,
+	checked_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	PRIMARY KEY (id, checked_at)
+);
+
+CREATE TABLE IF NOT EXISTS custom_domains (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+	domain VARCHAR(255) UNIQUE NOT NULL,
+	verified BOOLEAN DEFAULT FALSE,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Turn checks into a hypertable if the TimescaleDB extension is available
+DO $$
+BEGIN
+	IF EXISTS (
+		SELECT 1 FROM pg_extension WHERE extname = 'timescaledb'
+	) THEN
+		PERFORM create_hypertable('checks', 'checked_at', if_not_exists => TRUE);
+	END IF;
+END
+$$;
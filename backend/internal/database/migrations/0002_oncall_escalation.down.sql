@@ -0,0 +1,7 @@
+ALTER TABLE sites DROP COLUMN IF EXISTS escalation_policy_id;
+DROP TABLE IF EXISTS escalation_steps;
+DROP TABLE IF EXISTS escalation_policies;
+DROP TABLE IF EXISTS oncall_overrides;
+DROP TABLE IF EXISTS oncall_schedule_members;
+DROP TABLE IF EXISTS oncall_schedules;
+DROP TABLE IF EXISTS oncall_consents;
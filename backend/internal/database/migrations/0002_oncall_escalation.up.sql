@@ -0,0 +1,58 @@
+-- Users who agreed to be paged by another user through that user's on-call
+-- schedules, overrides and escalation policies
+CREATE TABLE IF NOT EXISTS oncall_consents (
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE, -- user who may be paged
+	pager_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE, -- user allowed to page them
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	PRIMARY KEY (user_id, pager_id)
+);
+
+CREATE TABLE IF NOT EXISTS oncall_schedules (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+	name VARCHAR(100) NOT NULL,
+	timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+	rotation VARCHAR(10) NOT NULL,
+	handoff_time VARCHAR(5) NOT NULL DEFAULT '09:00',
+	start_date DATE NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	UNIQUE(user_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS oncall_schedule_members (
+	schedule_id INTEGER REFERENCES oncall_schedules(id) ON DELETE CASCADE,
+	position INTEGER NOT NULL,
+	user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+	PRIMARY KEY (schedule_id, position)
+);
+
+CREATE TABLE IF NOT EXISTS oncall_overrides (
+	id SERIAL PRIMARY KEY,
+	schedule_id INTEGER REFERENCES oncall_schedules(id) ON DELETE CASCADE,
+	user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+	starts_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	ends_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS escalation_policies (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+	name VARCHAR(100) NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	UNIQUE(user_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS escalation_steps (
+	policy_id INTEGER REFERENCES escalation_policies(id) ON DELETE CASCADE,
+	position INTEGER NOT NULL,
+	delay_minutes INTEGER NOT NULL DEFAULT 0,
+	target_type VARCHAR(10) NOT NULL,
+	target_id INTEGER NOT NULL,
+	PRIMARY KEY (policy_id, position)
+);
+
+ALTER TABLE sites ADD COLUMN IF NOT EXISTS escalation_policy_id INTEGER
+	REFERENCES escalation_policies(id) ON DELETE SET NULL;
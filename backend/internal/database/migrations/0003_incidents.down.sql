@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS incident_notifications;
+DROP TABLE IF EXISTS incidents;
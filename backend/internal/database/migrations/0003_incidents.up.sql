@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS incidents (
+	id SERIAL PRIMARY KEY,
+	site_id INTEGER REFERENCES sites(id) ON DELETE CASCADE,
+	started_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	resolved_at TIMESTAMP WITH TIME ZONE,
+	acknowledged_at TIMESTAMP WITH TIME ZONE,
+	acknowledged_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+	status_code INTEGER,
+	error_message TEXT,
+	escalation_step INTEGER NOT NULL DEFAULT 0,
+	last_escalated_at TIMESTAMP WITH TIME ZONE
+);
+
+-- A site can only have one open incident at a time
+CREATE UNIQUE INDEX IF NOT EXISTS incidents_open_site_idx
+	ON incidents(site_id) WHERE resolved_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS incident_notifications (
+	id SERIAL PRIMARY KEY,
+	incident_id INTEGER REFERENCES incidents(id) ON DELETE CASCADE,
+	user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+	step INTEGER NOT NULL,
+	notified_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
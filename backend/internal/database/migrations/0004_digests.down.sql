@@ -0,0 +1,4 @@
+ALTER TABLE sites DROP COLUMN IF EXISTS cert_expires_at;
+ALTER TABLE users DROP COLUMN IF EXISTS digest_last_sent_at;
+ALTER TABLE users DROP COLUMN IF EXISTS digest_unsubscribe_token;
+ALTER TABLE users DROP COLUMN IF EXISTS digest_frequency;
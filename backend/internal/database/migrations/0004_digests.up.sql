@@ -0,0 +1,4 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS digest_frequency VARCHAR(10) NOT NULL DEFAULT 'none';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS digest_unsubscribe_token VARCHAR(64) UNIQUE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS digest_last_sent_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE sites ADD COLUMN IF NOT EXISTS cert_expires_at TIMESTAMP WITH TIME ZONE;
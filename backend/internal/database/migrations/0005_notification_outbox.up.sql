@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS notification_outbox (
+	id BIGSERIAL PRIMARY KEY,
+	user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+	channel VARCHAR(20) NOT NULL,
+	template VARCHAR(50) NOT NULL,
+	recipient VARCHAR(255) NOT NULL,
+	payload JSONB NOT NULL,
+	headers JSONB,
+	status VARCHAR(10) NOT NULL DEFAULT 'pending',
+	attempts INTEGER NOT NULL DEFAULT 0,
+	next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	last_error TEXT,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	sent_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS notification_outbox_pending_idx
+	ON notification_outbox(next_attempt_at) WHERE status = 'pending';
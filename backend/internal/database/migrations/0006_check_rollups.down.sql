@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS checks_site_checked_at_idx;
+DROP TABLE IF EXISTS check_rollups_daily;
+DROP TABLE IF EXISTS check_rollups_hourly;
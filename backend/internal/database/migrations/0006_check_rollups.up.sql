@@ -0,0 +1,30 @@
+-- Hourly and daily summaries of the checks, so stats over long periods don't
+-- scan raw checks and raw checks can be deleted after the retention period.
+-- Latency columns only cover successful checks, like the uptime stats.
+CREATE TABLE IF NOT EXISTS check_rollups_hourly (
+	site_id INTEGER REFERENCES sites(id) ON DELETE CASCADE,
+	bucket TIMESTAMP WITH TIME ZONE NOT NULL,
+	total_checks INTEGER NOT NULL,
+	successful_checks INTEGER NOT NULL,
+	response_time_sum BIGINT NOT NULL, -- in milliseconds, to average across buckets
+	min_response_time INTEGER,
+	avg_response_time INTEGER,
+	p95_response_time INTEGER,
+	max_response_time INTEGER,
+	PRIMARY KEY (site_id, bucket)
+);
+
+CREATE TABLE IF NOT EXISTS check_rollups_daily (
+	site_id INTEGER REFERENCES sites(id) ON DELETE CASCADE,
+	bucket TIMESTAMP WITH TIME ZONE NOT NULL,
+	total_checks INTEGER NOT NULL,
+	successful_checks INTEGER NOT NULL,
+	response_time_sum BIGINT NOT NULL,
+	min_response_time INTEGER,
+	avg_response_time INTEGER,
+	p95_response_time INTEGER,
+	max_response_time INTEGER,
+	PRIMARY KEY (site_id, bucket)
+);
+
+CREATE INDEX IF NOT EXISTS checks_site_checked_at_idx ON checks(site_id, checked_at);
@@ -0,0 +1,4 @@
+ALTER TABLE check_rollups_daily DROP COLUMN IF EXISTS latency_histogram;
+ALTER TABLE check_rollups_daily DROP COLUMN IF EXISTS response_time_sq_sum;
+ALTER TABLE check_rollups_hourly DROP COLUMN IF EXISTS latency_histogram;
+ALTER TABLE check_rollups_hourly DROP COLUMN IF EXISTS response_time_sq_sum;
@@ -0,0 +1,7 @@
+-- Sum of squares for the standard deviation and a histogram for percentiles,
+-- both of which can be combined across buckets. Rollups computed before this
+-- migration have no histogram and are left out of percentile estimates.
+ALTER TABLE check_rollups_hourly ADD COLUMN IF NOT EXISTS response_time_sq_sum DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE check_rollups_hourly ADD COLUMN IF NOT EXISTS latency_histogram BIGINT[];
+ALTER TABLE check_rollups_daily ADD COLUMN IF NOT EXISTS response_time_sq_sum DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE check_rollups_daily ADD COLUMN IF NOT EXISTS latency_histogram BIGINT[];
@@ -0,0 +1,3 @@
+ALTER TABLE sites DROP COLUMN IF EXISTS slo_burn_rate_alert;
+ALTER TABLE sites DROP COLUMN IF EXISTS slo_window;
+ALTER TABLE sites DROP COLUMN IF EXISTS slo_target;
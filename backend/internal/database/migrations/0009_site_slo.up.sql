@@ -0,0 +1,5 @@
+-- Per-site SLO targets, the window they apply to and the burn rate that
+-- triggers an error budget alert
+ALTER TABLE sites ADD COLUMN IF NOT EXISTS slo_target DOUBLE PRECISION;
+ALTER TABLE sites ADD COLUMN IF NOT EXISTS slo_window VARCHAR(20) NOT NULL DEFAULT 'rolling_30d';
+ALTER TABLE sites ADD COLUMN IF NOT EXISTS slo_burn_rate_alert DOUBLE PRECISION;
@@ -0,0 +1,4 @@
+ALTER TABLE check_rollups_daily DROP COLUMN IF EXISTS down_seconds;
+ALTER TABLE check_rollups_daily DROP COLUMN IF EXISTS up_seconds;
+ALTER TABLE check_rollups_hourly DROP COLUMN IF EXISTS down_seconds;
+ALTER TABLE check_rollups_hourly DROP COLUMN IF EXISTS up_seconds;
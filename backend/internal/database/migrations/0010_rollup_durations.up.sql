@@ -0,0 +1,7 @@
+-- How long the checks of each bucket covered the site being up and down, for
+-- time-weighted uptime. Rollups computed before this migration have no
+-- durations and count as having no data.
+ALTER TABLE check_rollups_hourly ADD COLUMN IF NOT EXISTS up_seconds DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE check_rollups_hourly ADD COLUMN IF NOT EXISTS down_seconds DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE check_rollups_daily ADD COLUMN IF NOT EXISTS up_seconds DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE check_rollups_daily ADD COLUMN IF NOT EXISTS down_seconds DOUBLE PRECISION NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+-- Whether checks send a W3C traceparent header to the site
+ALTER TABLE sites ADD COLUMN IF NOT EXISTS trace_propagation BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,14 @@
+-- Remote probe agents checking sites from other locations. Each probe
+-- authenticates with a token of its own, of which only the hash is stored.
+CREATE TABLE IF NOT EXISTS probes (
+	id SERIAL PRIMARY KEY,
+	name VARCHAR(100) UNIQUE NOT NULL,
+	location VARCHAR(100) NOT NULL,
+	token_hash VARCHAR(64) UNIQUE NOT NULL,
+	last_seen_at TIMESTAMP WITH TIME ZONE,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Where a check ran from, empty for checks of the server itself
+ALTER TABLE checks ADD COLUMN IF NOT EXISTS location VARCHAR(100) NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+ALTER TABLE sites DROP COLUMN IF EXISTS location_quorum;
+DROP TABLE IF EXISTS location_checks;
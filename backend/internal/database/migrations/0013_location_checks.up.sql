@@ -0,0 +1,18 @@
+-- Results of every location, the server's included, kept apart from the
+-- checks, which record the state the locations agree on
+CREATE TABLE IF NOT EXISTS location_checks (
+	id BIGSERIAL PRIMARY KEY,
+	site_id INTEGER NOT NULL REFERENCES sites(id) ON DELETE CASCADE,
+	location VARCHAR(100) NOT NULL,
+	status_code INTEGER NOT NULL DEFAULT 0,
+	response_time INTEGER NOT NULL DEFAULT 0, -- in milliseconds
+	is_up BOOLEAN NOT NULL,
+	error_message TEXT NOT NULL DEFAULT '',
+	checked_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS location_checks_site_checked_at_idx ON location_checks (site_id, checked_at);
+CREATE INDEX IF NOT EXISTS location_checks_checked_at_idx ON location_checks (checked_at);
+
+-- Number of locations that must fail for a site to be down, 0 for a majority
+ALTER TABLE sites ADD COLUMN IF NOT EXISTS location_quorum INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS alert_drops;
+DROP TABLE IF EXISTS alert_sends;
@@ -0,0 +1,17 @@
+-- Alerts sent and dropped by the rate limits, kept in the database so that
+-- rolled back alerts don't count and all instances share the limits
+CREATE TABLE IF NOT EXISTS alert_sends (
+	id BIGSERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	channel VARCHAR(20) NOT NULL,
+	sent_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS alert_sends_user_idx ON alert_sends(user_id, sent_at);
+CREATE INDEX IF NOT EXISTS alert_sends_channel_idx ON alert_sends(channel, sent_at);
+
+CREATE TABLE IF NOT EXISTS alert_drops (
+	user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+	dropped INTEGER NOT NULL,
+	since TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
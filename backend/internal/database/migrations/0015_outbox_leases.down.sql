@@ -0,0 +1,4 @@
+UPDATE notification_outbox SET status = 'pending' WHERE status = 'sending';
+DROP INDEX IF EXISTS notification_outbox_due_idx;
+CREATE INDEX IF NOT EXISTS notification_outbox_pending_idx
+	ON notification_outbox(next_attempt_at) WHERE status = 'pending';
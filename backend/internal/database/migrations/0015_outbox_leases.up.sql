@@ -0,0 +1,5 @@
+-- Dispatchers claim notifications by marking them as being sent, so the
+-- index of due notifications covers those too
+DROP INDEX IF EXISTS notification_outbox_pending_idx;
+CREATE INDEX IF NOT EXISTS notification_outbox_due_idx
+	ON notification_outbox(next_attempt_at) WHERE status IN ('pending', 'sending');
@@ -0,0 +1,8 @@
+-- The highest check ID summarised into the rollups. Rollups are recomputed
+-- for the buckets of newer checks, so checks arriving late aren't missed.
+-- Starting from 0 recomputes every bucket of the existing checks once.
+CREATE TABLE IF NOT EXISTS rollup_watermark (
+	last_check_id BIGINT NOT NULL
+);
+
+INSERT INTO rollup_watermark (last_check_id) VALUES (0);
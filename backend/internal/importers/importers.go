@@ -0,0 +1,55 @@
+// Package importers reads the monitors exported by other uptime monitoring
+// tools and maps them onto sites
+package importers
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Monitor is a monitor of another tool mapped onto a site
+type Monitor struct {
+	Name   string
+	URL    string
+	Type   string // type of the monitor in the other tool
+	Paused bool
+
+	// Unsupported explains why the monitor can't be imported, empty if it can
+	Unsupported string
+	// Notes lists the settings of the monitor that can't be carried over
+	Notes []string
+}
+
+// flexBool decodes JSON booleans that some exports write as 0 or 1
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	switch string(bytes.Trim(data, `"`)) {
+	case "true", "1":
+		*b = true
+	case "false", "0", "null", "":
+		*b = false
+	default:
+		return fmt.Errorf("invalid boolean %s", data)
+	}
+	return nil
+}
+
+// intervalNote notes when a monitor was checked at a different interval
+func intervalNote(seconds int, interval time.Duration) []string {
+	if seconds <= 0 || time.Duration(seconds)*time.Second == interval {
+		return nil
+	}
+	return []string{fmt.Sprintf("checked every %ds, sites are checked every %s", seconds, interval)}
+}
+
+// methodNote notes when a monitor used an HTTP method other than GET or HEAD
+func methodNote(method string) []string {
+	method = strings.ToUpper(method)
+	if method == "" || method == "GET" || method == "HEAD" {
+		return nil
+	}
+	return []string{fmt.Sprintf("used %s requests, sites are checked with GET", method)}
+}
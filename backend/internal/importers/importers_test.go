@@ -0,0 +1,141 @@
+package importers
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// interval is the check interval the fixtures are imported with
+const interval = time.Minute
+
+func TestParseUptimeKuma(t *testing.T) {
+	want := []Monitor{
+		{Name: "Website", URL: "https://example.com", Type: "http"},
+		{
+			Name: "Shop",
+			URL:  "https://shop.example.com",
+			Type: "keyword",
+			Notes: []string{
+				`keyword "Add to cart" is not checked, only the status code`,
+				"checked every 300s, sites are checked every 1m0s",
+			},
+		},
+		{
+			Name:   "API",
+			URL:    "https://api.example.com/health",
+			Type:   "json-query",
+			Paused: true,
+			Notes: []string{
+				"the JSON query is not checked, only the status code",
+				"used POST requests, sites are checked with GET",
+				"accepted status codes 200-299, 404, sites are up on 2xx and 3xx",
+			},
+		},
+		{Name: "Router", Type: "ping", Unsupported: "ping monitors are not supported, only HTTP"},
+		{
+			Name:        "Maintenance page",
+			URL:         "https://example.com/maintenance",
+			Type:        "http",
+			Unsupported: "upside down monitors are not supported",
+		},
+	}
+
+	monitors, err := ParseUptimeKuma(readFixture(t, "uptimekuma.json"), interval)
+	if err != nil {
+		t.Fatalf("parsing: %v", err)
+	}
+	checkMonitors(t, monitors, want)
+}
+
+func TestParseUptimeRobot(t *testing.T) {
+	want := []Monitor{
+		{Name: "Website", URL: "https://example.com", Type: "http"},
+		{
+			Name: "Shop",
+			URL:  "https://shop.example.com",
+			Type: "keyword",
+			Notes: []string{
+				`keyword "Add to cart" is not checked, only the status code`,
+				"checked every 300s, sites are checked every 1m0s",
+			},
+		},
+		{
+			Name:   "API",
+			URL:    "https://api.example.com/health",
+			Type:   "http",
+			Paused: true,
+			Notes: []string{
+				"used POST requests, sites are checked with GET",
+				"custom HTTP statuses 404:1_500:0, sites are up on 2xx and 3xx",
+			},
+		},
+		{Name: "Router", URL: "192.0.2.1", Type: "ping", Unsupported: "ping monitors are not supported, only HTTP"},
+		{
+			Name:        "Backups",
+			Type:        "type 9",
+			Unsupported: "type 9 monitors are not supported, only HTTP",
+			Notes:       []string{"checked every 86400s, sites are checked every 1m0s"},
+		},
+	}
+
+	monitors, err := ParseUptimeRobot(readFixture(t, "uptimerobot.json"), interval)
+	if err != nil {
+		t.Fatalf("parsing: %v", err)
+	}
+	checkMonitors(t, monitors, want)
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		parse func([]byte, time.Duration) ([]Monitor, error)
+		data  string
+		err   string
+	}{
+		{"Uptime Kuma not JSON", ParseUptimeKuma, `monitorList:`, "invalid Uptime Kuma backup"},
+		{"Uptime Kuma without monitors", ParseUptimeKuma, `{"version": "1.23.11"}`, "no monitorList"},
+		{"Uptime Kuma invalid boolean", ParseUptimeKuma, `{"monitorList": [{"name": "Website", "active": "yes"}]}`, "invalid boolean"},
+		{"UptimeRobot not JSON", ParseUptimeRobot, `<monitors/>`, "invalid UptimeRobot export"},
+		{"UptimeRobot without monitors", ParseUptimeRobot, `{"stat": "fail"}`, "no monitors"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.parse([]byte(tt.data), interval)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+// readFixture reads a file from testdata
+func readFixture(t *testing.T, file string) []byte {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join("testdata", file))
+	if err != nil {
+		t.Fatalf("reading %s: %v", file, err)
+	}
+	return data
+}
+
+// checkMonitors compares parsed monitors with the wanted ones, in order
+func checkMonitors(t *testing.T, monitors, want []Monitor) {
+	t.Helper()
+
+	if len(monitors) != len(want) {
+		t.Fatalf("got %d monitors, want %d", len(monitors), len(want))
+	}
+	for i, monitor := range monitors {
+		t.Run(want[i].Name, func(t *testing.T) {
+			if !reflect.DeepEqual(monitor, want[i]) {
+				t.Errorf("got %+v\nwant %+v", monitor, want[i])
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package importers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// uptimeKumaBackup is the part of an Uptime Kuma backup file that describes
+// the monitors
+type uptimeKumaBackup struct {
+	MonitorList []struct {
+		Name                string   `json:"name"`
+		Type                string   `json:"type"`
+		URL                 string   `json:"url"`
+		Method              string   `json:"method"`
+		Interval            int      `json:"interval"`
+		Keyword             string   `json:"keyword"`
+		Active              flexBool `json:"active"`
+		UpsideDown          flexBool `json:"upsideDown"`
+		AcceptedStatusCodes []string `json:"accepted_statuscodes"`
+	} `json:"monitorList"`
+}
+
+// ParseUptimeKuma reads the monitors of an Uptime Kuma backup file. Sites
+// are checked every interval.
+func ParseUptimeKuma(data []byte, interval time.Duration) ([]Monitor, error) {
+	var backup uptimeKumaBackup
+	if err := json.Unmarshal(data, &backup); err != nil {
+		return nil, fmt.Errorf("invalid Uptime Kuma backup: %v", err)
+	}
+	if backup.MonitorList == nil {
+		return nil, fmt.Errorf("invalid Uptime Kuma backup: no monitorList")
+	}
+
+	monitors := make([]Monitor, 0, len(backup.MonitorList))
+	for _, kuma := range backup.MonitorList {
+		monitor := Monitor{
+			Name:   kuma.Name,
+			URL:    kuma.URL,
+			Type:   kuma.Type,
+			Paused: !bool(kuma.Active),
+		}
+
+		switch kuma.Type {
+		case "http":
+		case "keyword":
+			monitor.Notes = append(monitor.Notes, fmt.Sprintf("keyword %q is not checked, only the status code", kuma.Keyword))
+		case "json-query":
+			monitor.Notes = append(monitor.Notes, "the JSON query is not checked, only the status code")
+		default:
+			monitor.Unsupported = fmt.Sprintf("%s monitors are not supported, only HTTP", kuma.Type)
+		}
+		if kuma.UpsideDown {
+			monitor.Unsupported = "upside down monitors are not supported"
+		}
+
+		monitor.Notes = append(monitor.Notes, intervalNote(kuma.Interval, interval)...)
+		monitor.Notes = append(monitor.Notes, methodNote(kuma.Method)...)
+		if codes := strings.Join(kuma.AcceptedStatusCodes, ", "); codes != "" && codes != "200-299" && codes != "200-299, 300-399" {
+			monitor.Notes = append(monitor.Notes, fmt.Sprintf("accepted status codes %s, sites are up on 2xx and 3xx", codes))
+		}
+
+		monitors = append(monitors, monitor)
+	}
+
+	return monitors, nil
+}
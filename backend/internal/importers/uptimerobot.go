@@ -0,0 +1,85 @@
+package importers
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// UptimeRobot monitor types
+var uptimeRobotTypes = map[int]string{
+	1: "http",
+	2: "keyword",
+	3: "ping",
+	4: "port",
+	5: "heartbeat",
+}
+
+// UptimeRobot HTTP methods
+var uptimeRobotMethods = map[int]string{
+	1: "HEAD",
+	2: "GET",
+	3: "POST",
+	4: "PUT",
+	5: "PATCH",
+	6: "DELETE",
+	7: "OPTIONS",
+}
+
+// uptimeRobotMonitors is a getMonitors response of the UptimeRobot API
+type uptimeRobotMonitors struct {
+	Monitors []struct {
+		FriendlyName       string `json:"friendly_name"`
+		URL                string `json:"url"`
+		Type               int    `json:"type"`
+		Interval           int    `json:"interval"`
+		Status             int    `json:"status"`
+		KeywordValue       string `json:"keyword_value"`
+		HTTPMethod         int    `json:"http_method"`
+		CustomHTTPStatuses string `json:"custom_http_statuses"`
+	} `json:"monitors"`
+}
+
+// ParseUptimeRobot reads the monitors of an UptimeRobot getMonitors
+// response. Sites are checked every interval.
+func ParseUptimeRobot(data []byte, interval time.Duration) ([]Monitor, error) {
+	var response uptimeRobotMonitors
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("invalid UptimeRobot export: %v", err)
+	}
+	if response.Monitors == nil {
+		return nil, fmt.Errorf("invalid UptimeRobot export: no monitors")
+	}
+
+	monitors := make([]Monitor, 0, len(response.Monitors))
+	for _, robot := range response.Monitors {
+		monitorType, ok := uptimeRobotTypes[robot.Type]
+		if !ok {
+			monitorType = fmt.Sprintf("type %d", robot.Type)
+		}
+		monitor := Monitor{
+			Name:   robot.FriendlyName,
+			URL:    robot.URL,
+			Type:   monitorType,
+			Paused: robot.Status == 0,
+		}
+
+		switch robot.Type {
+		case 1:
+		case 2:
+			monitor.Notes = append(monitor.Notes, fmt.Sprintf("keyword %q is not checked, only the status code", robot.KeywordValue))
+		default:
+			monitor.Unsupported = fmt.Sprintf("%s monitors are not supported, only HTTP", monitorType)
+		}
+
+		monitor.Notes = append(monitor.Notes, intervalNote(robot.Interval, interval)...)
+		monitor.Notes = append(monitor.Notes, methodNote(uptimeRobotMethods[robot.HTTPMethod])...)
+		if robot.CustomHTTPStatuses != "" {
+			monitor.Notes = append(monitor.Notes, fmt.Sprintf("custom HTTP statuses %s, sites are up on 2xx and 3xx", robot.CustomHTTPStatuses))
+		}
+
+		monitors = append(monitors, monitor)
+	}
+
+	return monitors, nil
+}
@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace prefixes the names of all metrics
+const namespace = "isitlive"
+
+// Registry holds the metrics exposed at /metrics, along with the Go runtime
+// and process metrics
+var Registry = prometheus.NewRegistry()
+
+var (
+	// ChecksTotal counts the site checks executed, by result
+	ChecksTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "checks_total",
+		Help:      "Site checks executed, by result.",
+	}, []string{"result"})
+
+	// CheckDuration observes how long site checks take, including failed ones
+	CheckDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "check_duration_seconds",
+		Help:      "Duration of site checks, including failed ones.",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	})
+
+	// SchedulerLag is how long after its round was scheduled the latest
+	// check started
+	SchedulerLag = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "scheduler_lag_seconds",
+		Help:      "Time between the start of a check round and the start of the latest check.",
+	})
+
+	// CheckQueueDepth is how many sites of the current round are still
+	// waiting to be checked
+	CheckQueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "check_queue_depth",
+		Help:      "Sites of the current check round waiting to be checked.",
+	})
+
+	// SchedulerLeader is 1 on the instance that checks the sites, see
+	// monitoring.Service
+	SchedulerLeader = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "scheduler_leader",
+		Help:      "Whether this instance checks the sites and runs the background jobs.",
+	})
+
+	// DBErrors counts the database errors of the background jobs, by
+	// operation
+	DBErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "db_errors_total",
+		Help:      "Database errors in the background jobs, by operation.",
+	}, []string{"operation"})
+
+	// NotificationFailures counts failed notification deliveries, by channel
+	NotificationFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notification_failures_total",
+		Help:      "Failed notification delivery attempts, by channel.",
+	}, []string{"channel"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		ChecksTotal,
+		CheckDuration,
+		SchedulerLag,
+		CheckQueueDepth,
+		SchedulerLeader,
+		DBErrors,
+		NotificationFailures,
+	)
+}
+
+// Handler serves the metrics of the registry in the Prometheus format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+)
+
+// SiteDailyUptime represents the uptime of a site per calendar day in the
+// timezone of its owner, oldest day first
+type SiteDailyUptime struct {
+	SiteID   int           `json:"site_id"`
+	Timezone string        `json:"timezone"`
+	Days     []DailyUptime `json:"days"`
+}
+
+// DailyUptime represents the uptime of a site on a single day. The uptime
+// percentage is nil on days without checks.
+type DailyUptime struct {
+	Date             string        `json:"date"` // YYYY-MM-DD
+	TotalChecks      int           `json:"total_checks"`
+	UptimePercentage *float64      `json:"uptime_percentage"`
+	DowntimeMinutes  int           `json:"downtime_minutes"`
+	Incidents        []IncidentRef `json:"incidents"`
+}
+
+// IncidentRef references an incident that overlapped a day
+type IncidentRef struct {
+	ID         int        `json:"id"`
+	StartedAt  time.Time  `json:"started_at"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+}
+
+// SiteWithDailyUptime represents a site with its current status and daily
+// uptime bars, as shown on status pages. The status is nil until the site
+// has been checked.
+type SiteWithDailyUptime struct {
+	Site
+	Status      *SiteStatus   `json:"status"`
+	DailyUptime []DailyUptime `json:"daily_uptime,omitempty"`
+}
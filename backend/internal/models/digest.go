@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+)
+
+// Digest frequencies a user can opt in to
+const (
+	DigestNone   = "none"
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+// Digest represents a summary of a user's sites over a period
+type Digest struct {
+	Username  string       `json:"username"`
+	Frequency string       `json:"frequency"`
+	From      time.Time    `json:"from"`
+	To        time.Time    `json:"to"`
+	Sites     []SiteDigest `json:"sites"`
+}
+
+// SiteDigest represents the summary of a single site in a digest
+type SiteDigest struct {
+	Name           string       `json:"name"`
+	URL            string       `json:"url"`
+	Stats          UptimeStats  `json:"stats"`
+	Incidents      []Incident   `json:"incidents"`
+	SlowestPeriods []SlowPeriod `json:"slowest_periods"`
+	CertExpiresAt  *time.Time   `json:"cert_expires_at,omitempty"`
+}
+
+// SlowPeriod represents an hour with a high average response time
+type SlowPeriod struct {
+	Start               time.Time `json:"start"`
+	AverageResponseTime int       `json:"average_response_time"` // in milliseconds
+}
+
+// DigestPeriod returns how far back a digest of the given frequency looks
+func DigestPeriod(frequency string) time.Duration {
+	switch frequency {
+	case DigestDaily:
+		return 24 * time.Hour
+	case DigestWeekly:
+		return 7 * 24 * time.Hour
+	default:
+		return 0
+	}
+}
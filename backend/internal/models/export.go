@@ -0,0 +1,94 @@
+package models
+
+import (
+	"time"
+)
+
+// ExportVersion is the current version of the configuration export format
+const ExportVersion = 1
+
+// Export represents a user's configuration, used for backups and to move
+// monitors between instances
+type Export struct {
+	Version       int            `json:"version" yaml:"version" binding:"required"`
+	ExportedAt    time.Time      `json:"exported_at" yaml:"exported_at"`
+	Settings      ExportSettings `json:"settings" yaml:"settings"`
+	Sites         []ExportSite   `json:"sites" yaml:"sites" binding:"dive"`
+	CustomDomains []string       `json:"custom_domains" yaml:"custom_domains" binding:"dive,fqdn"`
+}
+
+// ExportSettings represents a user's notification settings. Settings left
+// out of an import are not changed.
+type ExportSettings struct {
+	Email           *string `json:"email,omitempty" yaml:"email,omitempty"`
+	DigestFrequency *string `json:"digest_frequency,omitempty" yaml:"digest_frequency,omitempty" binding:"omitempty,oneof=none daily weekly"`
+	Timezone        *string `json:"timezone,omitempty" yaml:"timezone,omitempty"`
+}
+
+// ExportSite represents a monitored site and its check settings. The
+// escalation policy is referenced by name, as IDs differ between instances.
+type ExportSite struct {
+	Name             string   `json:"name" yaml:"name" binding:"required,min=1,max=100"`
+	URL              string   `json:"url" yaml:"url" binding:"required,url"`
+	EscalationPolicy string   `json:"escalation_policy,omitempty" yaml:"escalation_policy,omitempty"`
+	SLOTarget        *float64 `json:"slo_target,omitempty" yaml:"slo_target,omitempty" binding:"omitempty,gt=0,lt=100"`
+	SLOWindow        string   `json:"slo_window,omitempty" yaml:"slo_window,omitempty" binding:"omitempty,oneof=rolling_30d calendar_month"`
+	SLOBurnRateAlert *float64 `json:"slo_burn_rate_alert,omitempty" yaml:"slo_burn_rate_alert,omitempty" binding:"omitempty,gt=0"`
+	TracePropagation bool     `json:"trace_propagation,omitempty" yaml:"trace_propagation,omitempty"`
+	LocationQuorum   int      `json:"location_quorum,omitempty" yaml:"location_quorum,omitempty" binding:"omitempty,min=1,max=100"`
+}
+
+// Import conflict modes, deciding what happens to an imported site with the
+// same name as an existing one
+const (
+	ImportModeSkip      = "skip"
+	ImportModeOverwrite = "overwrite"
+	ImportModeRename    = "rename"
+)
+
+// Import actions
+const (
+	ImportCreated   = "created"
+	ImportUpdated   = "updated"
+	ImportRenamed   = "renamed"
+	ImportUnchanged = "unchanged"
+	ImportSkipped   = "skipped"
+)
+
+// ImportResult represents what an import did, or would do on a dry run
+type ImportResult struct {
+	DryRun          bool           `json:"dry_run"`
+	Mode            string         `json:"mode"`
+	SettingsUpdated bool           `json:"settings_updated"`
+	Sites           []ImportAction `json:"sites"`
+	CustomDomains   []ImportAction `json:"custom_domains"`
+}
+
+// ImportAction represents what an import did with a single site or domain
+type ImportAction struct {
+	Name    string   `json:"name"`
+	Action  string   `json:"action"`
+	NewName string   `json:"new_name,omitempty"` // name given to a renamed site
+	Reason  string   `json:"reason,omitempty"`   // why it was skipped
+	Notes   []string `json:"notes,omitempty"`    // settings that weren't carried over
+}
+
+// MonitorImportResult represents what an import of monitors from another
+// tool did, or would do on a dry run
+type MonitorImportResult struct {
+	Source      string          `json:"source"`
+	DryRun      bool            `json:"dry_run"`
+	Imported    []MonitorImport `json:"imported"`
+	Skipped     []MonitorImport `json:"skipped"`
+	Unsupported []MonitorImport `json:"unsupported"`
+}
+
+// MonitorImport represents a single monitor of another tool in an import
+type MonitorImport struct {
+	Name   string   `json:"name"`
+	Type   string   `json:"type"`
+	URL    string   `json:"url,omitempty"`
+	SiteID int      `json:"site_id,omitempty"` // site created for the monitor
+	Reason string   `json:"reason,omitempty"`  // why it was skipped or is unsupported
+	Notes  []string `json:"notes,omitempty"`   // settings that weren't carried over
+}
@@ -0,0 +1,62 @@
+package models
+
+import "time"
+
+// Health statuses
+const (
+	HealthOK        = "ok"
+	HealthUnhealthy = "unhealthy"
+)
+
+// HealthReport is the status of the server and its dependencies. Status is
+// unhealthy when any of the parts reported is.
+type HealthReport struct {
+	Status        string              `json:"status"`
+	Database      *DatabaseHealth     `json:"database,omitempty"`
+	Migrations    *MigrationHealth    `json:"migrations,omitempty"`
+	Scheduler     *SchedulerHealth    `json:"scheduler,omitempty"`
+	Workers       *WorkerHealth       `json:"workers,omitempty"`
+	Notifications *NotificationHealth `json:"notifications,omitempty"` // PostgreSQL only
+}
+
+// DatabaseHealth reports whether the database answers pings
+type DatabaseHealth struct {
+	Status    string  `json:"status"`
+	Error     string  `json:"error,omitempty"`
+	LatencyMS float64 `json:"latency_ms"`
+}
+
+// MigrationHealth reports whether the database schema is up to date
+type MigrationHealth struct {
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+	Version int    `json:"version"`
+	Latest  int    `json:"latest"`
+}
+
+// SchedulerHealth reports whether the check scheduler is still ticking
+type SchedulerHealth struct {
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	LastTickAt time.Time `json:"last_tick_at"` // latest tick, or heartbeat during a round
+	Interval   int       `json:"interval_seconds"`
+	Leader     bool      `json:"leader"`
+}
+
+// WorkerHealth reports whether the checks keep up with the check interval.
+// Utilization is the share of time spent checking sites between the latest
+// two scheduler ticks.
+type WorkerHealth struct {
+	Status      string  `json:"status"`
+	Error       string  `json:"error,omitempty"`
+	Utilization float64 `json:"utilization"`
+	Sites       int     `json:"sites"` // sites in the latest round
+}
+
+// NotificationHealth reports whether due notifications are being sent
+type NotificationHealth struct {
+	Status      string     `json:"status"`
+	Error       string     `json:"error,omitempty"`
+	Backlog     int        `json:"backlog"` // notifications due but not sent yet
+	OldestDueAt *time.Time `json:"oldest_due_at,omitempty"`
+}
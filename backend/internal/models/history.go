@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+)
+
+// Check history resolutions
+const (
+	ResolutionRaw    = "raw"
+	ResolutionMinute = "minute"
+	ResolutionHour   = "hour"
+	ResolutionDay    = "day"
+)
+
+// ResolutionBucketSize returns the length of the buckets of a resolution, or
+// 0 for raw checks and unknown resolutions
+func ResolutionBucketSize(resolution string) time.Duration {
+	switch resolution {
+	case ResolutionMinute:
+		return time.Minute
+	case ResolutionHour:
+		return time.Hour
+	case ResolutionDay:
+		return 24 * time.Hour
+	default:
+		return 0
+	}
+}
+
+// CheckSeries represents the checks of a site summarised into time buckets
+type CheckSeries struct {
+	SiteID     int                `json:"site_id"`
+	From       time.Time          `json:"from"`
+	To         time.Time          `json:"to"`
+	Resolution string             `json:"resolution"`
+	Points     []CheckSeriesPoint `json:"points"`
+}
+
+// CheckSeriesPoint represents the checks in a single time bucket. Latencies
+// only cover successful checks and are nil if there were none.
+type CheckSeriesPoint struct {
+	Time                time.Time `json:"time"`
+	TotalChecks         int       `json:"total_checks"`
+	SuccessfulChecks    int       `json:"successful_checks"`
+	UptimePercentage    float64   `json:"uptime_percentage"`
+	AverageResponseTime *int      `json:"average_response_time"` // in milliseconds
+	P95ResponseTime     *int      `json:"p95_response_time"`     // in milliseconds
+}
+
+// CheckPage represents a page of raw checks of a site
+type CheckPage struct {
+	SiteID     int       `json:"site_id"`
+	From       time.Time `json:"from"`
+	To         time.Time `json:"to"`
+	Resolution string    `json:"resolution"`
+	Checks     []Check   `json:"checks"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
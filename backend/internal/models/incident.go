@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+)
+
+// Incident represents a period during which a site was down
+type Incident struct {
+	ID              int        `json:"id"`
+	SiteID          int        `json:"site_id"`
+	StartedAt       time.Time  `json:"started_at"`
+	ResolvedAt      *time.Time `json:"resolved_at,omitempty"`
+	AcknowledgedAt  *time.Time `json:"acknowledged_at,omitempty"`
+	AcknowledgedBy  *int       `json:"acknowledged_by,omitempty"`
+	StatusCode      int        `json:"status_code"`
+	ErrorMessage    string     `json:"error_message,omitempty"`
+	EscalationStep  int        `json:"escalation_step"` // number of escalation steps already notified
+	LastEscalatedAt *time.Time `json:"last_escalated_at,omitempty"`
+}
+
+// IsOpen reports whether the incident has not been resolved yet
+func (i *Incident) IsOpen() bool {
+	return i.ResolvedAt == nil
+}
+
+// IsAcknowledged reports whether someone has acknowledged the incident
+func (i *Incident) IsAcknowledged() bool {
+	return i.AcknowledgedAt != nil
+}
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"math"
+	"time"
+)
+
+// LatencyBucketBounds are the upper bounds, in milliseconds, of the response
+// time histogram buckets. A last bucket counts everything slower. The rollups
+// store their counts in this order, so the bounds must not change.
+var LatencyBucketBounds = []int{
+	25, 50, 75, 100, 150, 200, 250, 300, 400, 500, 750,
+	1000, 1500, 2000, 3000, 5000, 7500, 10000, 15000, 30000,
+}
+
+// LatencyHistogram represents the response time distribution of a site
+type LatencyHistogram struct {
+	SiteID  int               `json:"site_id"`
+	From    *time.Time        `json:"from,omitempty"`
+	To      time.Time         `json:"to"`
+	Buckets []HistogramBucket `json:"buckets"`
+}
+
+// HistogramBucket represents the number of successful checks with a response
+// time in [LowerBound, UpperBound) milliseconds. The last bucket has no
+// upper bound.
+type HistogramBucket struct {
+	LowerBound int   `json:"lower_bound"`
+	UpperBound *int  `json:"upper_bound"`
+	Count      int64 `json:"count"`
+}
+
+// NewHistogramBuckets pairs histogram counts with their bucket bounds
+func NewHistogramBuckets(counts []int64) []HistogramBucket {
+	buckets := make([]HistogramBucket, len(LatencyBucketBounds)+1)
+	lower := 0
+	for i := range buckets {
+		buckets[i].LowerBound = lower
+		if i < len(LatencyBucketBounds) {
+			upper := LatencyBucketBounds[i]
+			buckets[i].UpperBound = &upper
+			lower = upper
+		}
+		if i < len(counts) {
+			buckets[i].Count = counts[i]
+		}
+	}
+	return buckets
+}
+
+// EstimatePercentile estimates the p-th percentile (0-100) of the response
+// times in a histogram by interpolating linearly within the bucket it falls
+// in. The estimate is clamped to the observed minimum and maximum.
+func EstimatePercentile(counts []int64, p float64, min, max int) int {
+	var total int64
+	for _, count := range counts {
+		total += count
+	}
+	if total == 0 {
+		return 0
+	}
+
+	rank := p / 100 * float64(total)
+	var seen int64
+	for i, count := range counts {
+		if count == 0 || float64(seen+count) < rank {
+			seen += count
+			continue
+		}
+
+		lower, upper := float64(0), float64(max)
+		if i > 0 && i-1 < len(LatencyBucketBounds) {
+			lower = float64(LatencyBucketBounds[i-1])
+		}
+		if i < len(LatencyBucketBounds) {
+			upper = float64(LatencyBucketBounds[i])
+		}
+		lower = math.Max(lower, float64(min))
+		upper = math.Min(upper, float64(max))
+		if upper < lower {
+			upper = lower
+		}
+
+		fraction := (rank - float64(seen)) / float64(count)
+		return int(math.Round(lower + fraction*(upper-lower)))
+	}
+
+	return max
+}
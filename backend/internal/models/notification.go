@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+)
+
+// Notification outbox statuses
+const (
+	OutboxPending = "pending"
+	OutboxSending = "sending" // claimed by a dispatcher until next_attempt_at
+	OutboxSent    = "sent"
+	OutboxDead    = "dead"
+)
+
+// OutboxMessage represents a notification waiting in, or delivered from, the outbox
+type OutboxMessage struct {
+	ID            int64      `json:"id"`
+	UserID        *int       `json:"user_id,omitempty"`
+	Channel       string     `json:"channel"`
+	Template      string     `json:"template"`
+	Recipient     string     `json:"recipient"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	LastError     string     `json:"last_error,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	SentAt        *time.Time `json:"sent_at,omitempty"`
+}
+
+// OutboxStatus summarises the state of the notification outbox
+type OutboxStatus struct {
+	Pending         int             `json:"pending"` // including notifications being sent
+	Sent            int             `json:"sent"`
+	Dead            int             `json:"dead"`
+	OldestPendingAt *time.Time      `json:"oldest_pending_at,omitempty"`
+	RecentDead      []OutboxMessage `json:"recent_dead"`
+}
@@ -0,0 +1,192 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Rotation types for on-call schedules
+const (
+	RotationDaily  = "daily"
+	RotationWeekly = "weekly"
+)
+
+// Escalation step target types
+const (
+	TargetTypeUser     = "user"
+	TargetTypeSchedule = "schedule"
+)
+
+// ErrNoOnCall is returned when a schedule has nobody on call
+var ErrNoOnCall = errors.New("nobody is on call")
+
+// OnCallSchedule represents a rotation of users who take turns being on call
+type OnCallSchedule struct {
+	ID          int              `json:"id"`
+	UserID      int              `json:"user_id"`
+	Name        string           `json:"name"`
+	Timezone    string           `json:"timezone"`
+	Rotation    string           `json:"rotation"`
+	HandoffTime string           `json:"handoff_time"` // HH:MM in the schedule's timezone
+	StartDate   time.Time        `json:"start_date"`
+	Members     []OnCallMember   `json:"members"`
+	Overrides   []OnCallOverride `json:"overrides"`
+	CreatedAt   time.Time        `json:"created_at"`
+	UpdatedAt   time.Time        `json:"updated_at"`
+}
+
+// OnCallMember represents a user taking part in a rotation
+type OnCallMember struct {
+	UserID   int    `json:"user_id"`
+	Username string `json:"username"`
+}
+
+// OnCallOverride temporarily replaces whoever is on call in a schedule
+type OnCallOverride struct {
+	ID         int       `json:"id"`
+	ScheduleID int       `json:"schedule_id"`
+	UserID     int       `json:"user_id"`
+	Username   string    `json:"username"`
+	StartsAt   time.Time `json:"starts_at"`
+	EndsAt     time.Time `json:"ends_at"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// OnCallScheduleCreation represents the data needed to create a new on-call schedule
+type OnCallScheduleCreation struct {
+	Name        string   `json:"name" binding:"required,min=1,max=100"`
+	Timezone    string   `json:"timezone"`
+	Rotation    string   `json:"rotation" binding:"required,oneof=daily weekly"`
+	HandoffTime string   `json:"handoff_time"`
+	StartDate   string   `json:"start_date" binding:"required"` // YYYY-MM-DD
+	Members     []string `json:"members" binding:"required,min=1"`
+}
+
+// OnCallOverrideCreation represents the data needed to create an on-call override
+type OnCallOverrideCreation struct {
+	Username string    `json:"username" binding:"required"`
+	StartsAt time.Time `json:"starts_at" binding:"required"`
+	EndsAt   time.Time `json:"ends_at" binding:"required"`
+}
+
+// OnCallConsent represents a user allowed to page the current user through
+// their on-call schedules, overrides and escalation policies
+type OnCallConsent struct {
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OnCallConsentCreation represents the data needed to let a user page the
+// current user
+type OnCallConsentCreation struct {
+	Username string `json:"username" binding:"required"`
+}
+
+// EscalationPolicy represents an ordered list of escalation steps
+type EscalationPolicy struct {
+	ID        int              `json:"id"`
+	UserID    int              `json:"user_id"`
+	Name      string           `json:"name"`
+	Steps     []EscalationStep `json:"steps"`
+	CreatedAt time.Time        `json:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at"`
+}
+
+// EscalationStep represents a single step of an escalation policy. The step
+// is notified DelayMinutes after the previous step (or after the incident
+// started, for the first step) if the incident is still unacknowledged.
+type EscalationStep struct {
+	Position     int    `json:"position"`
+	DelayMinutes int    `json:"delay_minutes"`
+	TargetType   string `json:"target_type"`
+	TargetID     int    `json:"target_id"`
+}
+
+// EscalationPolicyCreation represents the data needed to create a new escalation policy
+type EscalationPolicyCreation struct {
+	Name  string                   `json:"name" binding:"required,min=1,max=100"`
+	Steps []EscalationStepCreation `json:"steps" binding:"required,min=1,dive"`
+}
+
+// EscalationStepCreation represents the data needed to create an escalation step
+type EscalationStepCreation struct {
+	DelayMinutes int    `json:"delay_minutes" binding:"min=0"`
+	TargetType   string `json:"target_type" binding:"required,oneof=user schedule"`
+	Username     string `json:"username"`
+	ScheduleID   int    `json:"schedule_id"`
+}
+
+// ParseHandoffTime parses a HH:MM handoff time into hours and minutes
+func ParseHandoffTime(handoff string) (int, int, error) {
+	t, err := time.Parse("15:04", handoff)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid handoff time %q: expected HH:MM", handoff)
+	}
+	return t.Hour(), t.Minute(), nil
+}
+
+// OnCallAt returns the user ID of whoever is on call at the given time.
+// Overrides take precedence over the rotation; when several overrides
+// cover the same instant, the most recently created one wins.
+func (s *OnCallSchedule) OnCallAt(t time.Time) (int, error) {
+	// Check overrides first
+	var override *OnCallOverride
+	for i := range s.Overrides {
+		o := &s.Overrides[i]
+		if t.Before(o.StartsAt) || !t.Before(o.EndsAt) {
+			continue
+		}
+		if override == nil || o.CreatedAt.After(override.CreatedAt) {
+			override = o
+		}
+	}
+	if override != nil {
+		return override.UserID, nil
+	}
+
+	if len(s.Members) == 0 {
+		return 0, ErrNoOnCall
+	}
+
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timezone %q: %v", s.Timezone, err)
+	}
+
+	hour, minute, err := ParseHandoffTime(s.HandoffTime)
+	if err != nil {
+		return 0, err
+	}
+
+	// Work out which rotation day we are in. Days are counted on the
+	// calendar in the schedule's timezone so DST changes don't shift the
+	// handoff, and a day only starts at the handoff time.
+	local := t.In(loc)
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC)
+	if local.Hour()*60+local.Minute() < hour*60+minute {
+		day = day.AddDate(0, 0, -1)
+	}
+	start := time.Date(s.StartDate.Year(), s.StartDate.Month(), s.StartDate.Day(), 0, 0, 0, 0, time.UTC)
+	period := int(day.Sub(start).Hours() / 24)
+
+	if s.Rotation == RotationWeekly {
+		period = floorDiv(period, 7)
+	}
+
+	index := period % len(s.Members)
+	if index < 0 {
+		index += len(s.Members)
+	}
+
+	return s.Members[index].UserID, nil
+}
+
+// floorDiv divides a by b rounding towards negative infinity
+func floorDiv(a, b int) int {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
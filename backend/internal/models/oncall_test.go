@@ -0,0 +1,85 @@
+package models
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata" // the schedules use a non-UTC timezone
+)
+
+func TestOnCallAt(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("loading timezone: %v", err)
+	}
+	members := []OnCallMember{{UserID: 1}, {UserID: 2}, {UserID: 3}}
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	schedule := func(rotation string, overrides ...OnCallOverride) OnCallSchedule {
+		return OnCallSchedule{
+			Timezone:    "America/New_York",
+			Rotation:    rotation,
+			HandoffTime: "09:00",
+			StartDate:   start,
+			Members:     members,
+			Overrides:   overrides,
+		}
+	}
+
+	// Two overlapping overrides on March 2nd (UTC), the later one created last
+	overrides := []OnCallOverride{
+		{
+			UserID:    9,
+			StartsAt:  time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC),
+			EndsAt:    time.Date(2024, 3, 3, 0, 0, 0, 0, time.UTC),
+			CreatedAt: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			UserID:    8,
+			StartsAt:  time.Date(2024, 3, 2, 12, 0, 0, 0, time.UTC),
+			EndsAt:    time.Date(2024, 3, 2, 18, 0, 0, 0, time.UTC),
+			CreatedAt: time.Date(2024, 2, 2, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	tests := []struct {
+		name     string
+		schedule OnCallSchedule
+		at       time.Time
+		want     int
+	}{
+		{"daily first handoff", schedule(RotationDaily), time.Date(2024, 3, 1, 9, 0, 0, 0, newYork), 1},
+		{"daily before first handoff", schedule(RotationDaily), time.Date(2024, 3, 1, 8, 59, 0, 0, newYork), 3},
+		{"daily late evening", schedule(RotationDaily), time.Date(2024, 3, 1, 23, 30, 0, 0, newYork), 1},
+		{"daily next handoff", schedule(RotationDaily), time.Date(2024, 3, 2, 9, 0, 0, 0, newYork), 2},
+		{"daily wraps around", schedule(RotationDaily), time.Date(2024, 3, 4, 9, 0, 0, 0, newYork), 1},
+		{"weekly end of first week", schedule(RotationWeekly), time.Date(2024, 3, 8, 8, 59, 0, 0, newYork), 1},
+		{"weekly second week", schedule(RotationWeekly), time.Date(2024, 3, 8, 9, 0, 0, 0, newYork), 2},
+		{"weekly wraps around", schedule(RotationWeekly), time.Date(2024, 3, 22, 9, 0, 0, 0, newYork), 1},
+		// Clocks go forward on March 10th, the handoff stays at 09:00 local time
+		{"before handoff on DST day", schedule(RotationDaily), time.Date(2024, 3, 10, 12, 59, 0, 0, time.UTC), 3},
+		{"handoff on DST day", schedule(RotationDaily), time.Date(2024, 3, 10, 13, 0, 0, 0, time.UTC), 1},
+		{"handoff after DST day", schedule(RotationDaily), time.Date(2024, 3, 11, 9, 0, 0, 0, newYork), 2},
+		{"weekly handoff after DST", schedule(RotationWeekly), time.Date(2024, 3, 15, 13, 0, 0, 0, time.UTC), 3},
+		{"override", schedule(RotationDaily, overrides...), time.Date(2024, 3, 2, 6, 0, 0, 0, time.UTC), 9},
+		{"latest override", schedule(RotationDaily, overrides...), time.Date(2024, 3, 2, 12, 0, 0, 0, time.UTC), 8},
+		{"override ended", schedule(RotationDaily, overrides...), time.Date(2024, 3, 3, 0, 0, 0, 0, time.UTC), 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.schedule.OnCallAt(tt.at)
+			if err != nil {
+				t.Fatalf("getting on-call user: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got user %d on call at %s, want %d", got, tt.at.In(newYork), tt.want)
+			}
+		})
+	}
+}
+
+func TestOnCallAtWithoutMembers(t *testing.T) {
+	schedule := OnCallSchedule{Timezone: "UTC", Rotation: RotationDaily, HandoffTime: "09:00"}
+	if _, err := schedule.OnCallAt(time.Now()); err != ErrNoOnCall {
+		t.Errorf("got error %v, want %v", err, ErrNoOnCall)
+	}
+}
@@ -0,0 +1,62 @@
+package models
+
+import "time"
+
+// Probe is a remote agent checking sites from its location
+type Probe struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Location   string     `json:"location"`
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// ProbeRegistration represents the data a probe registers with
+type ProbeRegistration struct {
+	Name     string `json:"name" binding:"required,max=100"`
+	Location string `json:"location" binding:"required,max=100"`
+}
+
+// RegisteredProbe is returned when a probe registers, with the token it
+// authenticates with from then on. The token is only shown once.
+type RegisteredProbe struct {
+	Probe
+	Token string `json:"token"`
+}
+
+// ProbeCheck is a site a probe is assigned to check
+type ProbeCheck struct {
+	SiteID           int    `json:"site_id"`
+	URL              string `json:"url"`
+	TracePropagation bool   `json:"trace_propagation,omitempty"`
+}
+
+// ProbeAssignment lists the sites a probe checks and how often
+type ProbeAssignment struct {
+	Interval int          `json:"interval_seconds"`
+	Checks   []ProbeCheck `json:"checks"`
+}
+
+// ProbeResult is the result of a check run by a probe
+type ProbeResult struct {
+	SiteID        int        `json:"site_id" binding:"required"`
+	StatusCode    int        `json:"status_code"`
+	ResponseTime  int        `json:"response_time"` // in milliseconds
+	IsUp          bool       `json:"is_up"`
+	ErrorMessage  string     `json:"error_message,omitempty"`
+	CheckedAt     time.Time  `json:"checked_at" binding:"required"`
+	CertExpiresAt *time.Time `json:"cert_expires_at,omitempty"`
+}
+
+// ProbeResults is a batch of results pushed by a probe
+type ProbeResults struct {
+	Results []ProbeResult `json:"results" binding:"required,max=1000,dive"`
+}
+
+// ProbeResultsAccepted reports how many results of a batch were recorded.
+// Results of deleted sites and results too old or in the future are dropped.
+type ProbeResultsAccepted struct {
+	Accepted int `json:"accepted"`
+	Dropped  int `json:"dropped"`
+}
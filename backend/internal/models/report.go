@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+)
+
+// SLAReport represents the uptime of a site over a calendar month, in the
+// timezone of its owner, as evidence for service level agreements
+type SLAReport struct {
+	SiteID              int            `json:"site_id"`
+	SiteName            string         `json:"site_name"`
+	URL                 string         `json:"url"`
+	Month               string         `json:"month"` // YYYY-MM
+	Timezone            string         `json:"timezone"`
+	GeneratedAt         time.Time      `json:"generated_at"`
+	TotalChecks         int            `json:"total_checks"`
+	SuccessfulChecks    int            `json:"successful_checks"`
+	UptimePercentage    *float64       `json:"uptime_percentage"`     // nil without checks
+	AverageResponseTime int            `json:"average_response_time"` // in milliseconds
+	TimeWeightedUptime  *float64       `json:"time_weighted_uptime_percentage"`
+	DownSeconds         int64          `json:"down_seconds"`
+	NoDataSeconds       int64          `json:"no_data_seconds"`
+	Days                []SLAReportDay `json:"days"`
+}
+
+// SLAReportDay represents the uptime of a site on a single day of an SLA
+// report
+type SLAReportDay struct {
+	Date                string   `json:"date"` // YYYY-MM-DD
+	TotalChecks         int      `json:"total_checks"`
+	SuccessfulChecks    int      `json:"successful_checks"`
+	UptimePercentage    *float64 `json:"uptime_percentage"`     // nil without checks
+	AverageResponseTime int      `json:"average_response_time"` // in milliseconds
+	TimeWeightedUptime  *float64 `json:"time_weighted_uptime_percentage"`
+	DownSeconds         int64    `json:"down_seconds"`
+	NoDataSeconds       int64    `json:"no_data_seconds"`
+}
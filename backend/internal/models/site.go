@@ -6,18 +6,40 @@ import (
 
 // Site represents a monitored website
 type Site struct {
-	ID        int       `json:"id"`
-	UserID    int       `json:"user_id"`
-	Name      string    `json:"name"`
-	URL       string    `json:"url"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID                 int        `json:"id"`
+	UserID             int        `json:"user_id"`
+	Name               string     `json:"name"`
+	URL                string     `json:"url"`
+	EscalationPolicyID *int       `json:"escalation_policy_id,omitempty"`
+	CertExpiresAt      *time.Time `json:"cert_expires_at,omitempty"`
+	SLOTarget          *float64   `json:"slo_target,omitempty"` // uptime percentage, nil without an SLO
+	SLOWindow          string     `json:"slo_window"`
+	SLOBurnRateAlert   *float64   `json:"slo_burn_rate_alert,omitempty"` // burn rate that triggers an alert
+	TracePropagation   bool       `json:"trace_propagation"`             // send a traceparent header with checks
+	LocationQuorum     int        `json:"location_quorum"`               // failing locations needed for the site to be down, 0 for a majority
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
 }
 
 // SiteCreation represents the data needed to create a new site
 type SiteCreation struct {
-	Name string `json:"name" binding:"required,min=1,max=100"`
-	URL  string `json:"url" binding:"required,url"`
+	Name               string   `json:"name" binding:"required,min=1,max=100"`
+	URL                string   `json:"url" binding:"required,url"`
+	EscalationPolicyID *int     `json:"escalation_policy_id"`
+	SLOTarget          *float64 `json:"slo_target" binding:"omitempty,gt=0,lt=100"`
+	SLOWindow          string   `json:"slo_window" binding:"omitempty,oneof=rolling_30d calendar_month"`
+	SLOBurnRateAlert   *float64 `json:"slo_burn_rate_alert" binding:"omitempty,gt=0"`
+	TracePropagation   bool     `json:"trace_propagation"`
+	LocationQuorum     int      `json:"location_quorum" binding:"omitempty,min=1,max=100"`
+}
+
+// SLOWindowOrDefault returns the SLO window of a site, a rolling 30 days if
+// none was given
+func (s SiteCreation) SLOWindowOrDefault() string {
+	if s.SLOWindow == "" {
+		return SLOWindowRolling30d
+	}
+	return s.SLOWindow
 }
 
 // Check represents a single uptime check for a site
@@ -29,6 +51,7 @@ type Check struct {
 	IsUp         bool      `json:"is_up"`
 	ErrorMessage string    `json:"error_message,omitempty"`
 	CheckedAt    time.Time `json:"checked_at"`
+	Location     string    `json:"location,omitempty"` // where the check ran, see Service.checkSite
 }
 
 // UptimeStats represents uptime statistics for a site
@@ -37,16 +60,77 @@ type UptimeStats struct {
 	SuccessfulChecks int     `json:"successful_checks"`
 	UptimePercentage float64 `json:"uptime_percentage"`
 	AverageResponseTime int  `json:"average_response_time"` // in milliseconds
+	ResponseTimeSum  int64   `json:"-"` // of successful checks, the average is derived from it
+
+	// Response time distribution of successful checks, in milliseconds.
+	// Percentiles are estimated from the latency histogram.
+	MinResponseTime    int     `json:"min_response_time"`
+	MaxResponseTime    int     `json:"max_response_time"`
+	P50ResponseTime    int     `json:"p50_response_time"`
+	P90ResponseTime    int     `json:"p90_response_time"`
+	P95ResponseTime    int     `json:"p95_response_time"`
+	P99ResponseTime    int     `json:"p99_response_time"`
+	ResponseTimeStdDev float64 `json:"response_time_stddev"`
+
+	// Time-weighted uptime, unlike UptimePercentage not skewed by interval
+	// changes, missed checks or retries. Each check's result holds until the
+	// next check, for at most two check intervals; the rest of the period
+	// has no data and is left out of the percentage.
+	TimeWeightedUptime float64 `json:"time_weighted_uptime_percentage"`
+	UpSeconds          int64   `json:"up_seconds"`
+	DownSeconds        int64   `json:"down_seconds"`
+	NoDataSeconds      int64   `json:"no_data_seconds"`
+}
+
+// SetDurations fills in the time-weighted uptime from how long a site was up
+// and down during a period
+func (s *UptimeStats) SetDurations(up, down, period time.Duration) {
+	s.UpSeconds = int64(up.Seconds())
+	s.DownSeconds = int64(down.Seconds())
+	if noData := period - up - down; noData > 0 {
+		s.NoDataSeconds = int64(noData.Seconds())
+	}
+	if up+down > 0 {
+		s.TimeWeightedUptime = float64(up) / float64(up+down) * 100
+	}
 }
 
 // SiteWithStats represents a site with its uptime statistics
 type SiteWithStats struct {
 	Site        Site        `json:"site"`
 	CurrentStatus *Check     `json:"current_status"`
+	Status        *SiteStatus `json:"status"`
 	LifetimeStats UptimeStats `json:"lifetime_stats"`
 	Last7DaysStats UptimeStats `json:"last_7_days_stats"`
 	Last30DaysStats UptimeStats `json:"last_30_days_stats"`
 	Last90DaysStats UptimeStats `json:"last_90_days_stats"`
+	SLO             *SLOStatus  `json:"slo,omitempty"`
+
+	// Results of each location, while the status and stats above are what
+	// the locations agree on. Nil for sites only checked by the server.
+	Locations []LocationStats `json:"locations,omitempty"`
+}
+
+// LocationStats summarises the results of a site from one location over the
+// last 7 days
+type LocationStats struct {
+	Location            string  `json:"location"`
+	Current             *Check  `json:"current,omitempty"` // latest result, nil if the location stopped reporting
+	TotalChecks         int     `json:"total_checks"`
+	SuccessfulChecks    int     `json:"successful_checks"`
+	UptimePercentage    float64 `json:"uptime_percentage"`
+	AverageResponseTime int     `json:"average_response_time"` // of successful checks, in milliseconds
+	MinResponseTime     int     `json:"min_response_time"`
+	MaxResponseTime     int     `json:"max_response_time"`
+}
+
+// SiteStatus summarises the current state of a site
+type SiteStatus struct {
+	IsUp             bool      `json:"is_up"`
+	Since            time.Time `json:"since"` // when the site entered its current state
+	LastCheckedAt    time.Time `json:"last_checked_at"`
+	LastStatusCode   int       `json:"last_status_code"`
+	LastResponseTime int       `json:"last_response_time"` // in milliseconds
 }
 
 // CustomDomain represents a custom domain for a user's dashboard
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+)
+
+// SLO windows, the period an SLO target applies to
+const (
+	SLOWindowRolling30d    = "rolling_30d"
+	SLOWindowCalendarMonth = "calendar_month"
+)
+
+// SLOStatus represents how a site is doing against its SLO. The error budget
+// is the downtime the target allows over the window, measured like the
+// time-weighted uptime.
+type SLOStatus struct {
+	Target           float64   `json:"target"`
+	Window           string    `json:"window"`
+	WindowStart      time.Time `json:"window_start"`
+	WindowEnd        time.Time `json:"window_end"`
+	TotalChecks      int       `json:"total_checks"`
+	FailedChecks     int       `json:"failed_checks"`
+	UptimePercentage *float64  `json:"uptime_percentage"` // nil without checks
+
+	ErrorBudget          float64 `json:"error_budget"`           // allowed downtime, in seconds
+	ErrorBudgetUsed      float64 `json:"error_budget_used"`      // downtime so far, in seconds
+	ErrorBudgetRemaining float64 `json:"error_budget_remaining"` // percentage left, negative once exceeded
+
+	// BurnRate is how fast the budget was used over the last hour, relative
+	// to using it up exactly over the window
+	BurnRate float64 `json:"burn_rate"`
+	// ProjectedBreachAt is when the budget runs out at the current burn
+	// rate, nil if that isn't within the window
+	ProjectedBreachAt *time.Time `json:"projected_breach_at"`
+	Breached          bool       `json:"breached"`
+	ComputedAt        time.Time  `json:"computed_at"`
+}
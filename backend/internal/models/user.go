@@ -8,12 +8,14 @@ import (
 
 // User represents a user in the system
 type User struct {
-	ID           int       `json:"id"`
-	Username     string    `json:"username"`
-	PasswordHash string    `json:"-"`
-	Email        string    `json:"email,omitempty"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID              int       `json:"id"`
+	Username        string    `json:"username"`
+	PasswordHash    string    `json:"-"`
+	Email           string    `json:"email,omitempty"`
+	DigestFrequency string    `json:"digest_frequency,omitempty"`
+	Timezone        string    `json:"timezone,omitempty"` // IANA name, used for calendar days on status pages
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
 }
 
 // UserRegistration represents the data needed to register a new user
@@ -31,10 +33,12 @@ type UserLogin struct {
 
 // UserResponse represents the user data returned to the client
 type UserResponse struct {
-	ID        int       `json:"id"`
-	Username  string    `json:"username"`
-	Email     string    `json:"email,omitempty"`
-	CreatedAt time.Time `json:"created_at"`
+	ID              int       `json:"id"`
+	Username        string    `json:"username"`
+	Email           string    `json:"email,omitempty"`
+	DigestFrequency string    `json:"digest_frequency,omitempty"`
+	Timezone        string    `json:"timezone,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
 }
 
 // HashPassword hashes a password using bcrypt
@@ -52,9 +56,11 @@ func CheckPassword(password, hash string) bool {
 // ToResponse converts a User to a UserResponse
 func (u *User) ToResponse() UserResponse {
 	return UserResponse{
-		ID:        u.ID,
-		Username:  u.Username,
-		Email:     u.Email,
-		CreatedAt: u.CreatedAt,
+		ID:              u.ID,
+		Username:        u.Username,
+		Email:           u.Email,
+		DigestFrequency: u.DigestFrequency,
+		Timezone:        u.Timezone,
+		CreatedAt:       u.CreatedAt,
 	}
 }
@@ -0,0 +1,144 @@
+package monitoring
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/abstractmelon/is-site-live/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// DailyUptimeDays is the number of days shown on status pages
+const DailyUptimeDays = 90
+
+// GetDailyUptime gets the uptime of a site for each of the last number of
+// calendar days, including today, in the timezone of the site's owner
+func (s *Service) GetDailyUptime(siteID, days int) (*models.SiteDailyUptime, error) {
+	var timezone string
+	err := s.db.Pool.QueryRow(context.Background(), `
+		SELECT u.timezone
+		FROM sites s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.id = $1
+	`, siteID).Scan(&timezone)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrSiteNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		timezone, loc = "UTC", time.UTC
+	}
+
+	// Day boundaries in the owner's timezone, which may be 23 or 25 hours apart
+	now := time.Now().In(loc)
+	boundaries := make([]time.Time, days+1)
+	for i := range boundaries {
+		boundaries[i] = time.Date(now.Year(), now.Month(), now.Day()-days+1+i, 0, 0, 0, 0, loc)
+	}
+	from := boundaries[0]
+
+	result := &models.SiteDailyUptime{
+		SiteID:   siteID,
+		Timezone: timezone,
+		Days:     make([]models.DailyUptime, days),
+	}
+	index := make(map[string]int, days)
+	for i := range result.Days {
+		date := boundaries[i].Format("2006-01-02")
+		result.Days[i] = models.DailyUptime{Date: date, Incidents: []models.IncidentRef{}}
+		index[date] = i
+	}
+
+	// Count the checks per day. Whole hours come from the hourly rollups, so
+	// timezones with a half-hour offset attribute some checks to the
+	// neighbouring day.
+	rows, err := s.db.Pool.Query(context.Background(), `
+		SELECT to_char(bucket AT TIME ZONE @timezone, 'YYYY-MM-DD') AS day,
+			SUM(total_checks), SUM(successful_checks)
+		FROM (
+			SELECT bucket, total_checks, successful_checks
+			FROM check_rollups_hourly
+			WHERE site_id = @siteID AND bucket >= @from AND bucket < @rollupTo
+			UNION ALL
+			SELECT checked_at, 1, CASE WHEN is_up THEN 1 ELSE 0 END
+			FROM checks
+			WHERE site_id = @siteID AND checked_at >= GREATEST(@from::timestamptz, @rollupTo::timestamptz)
+		) AS buckets
+		GROUP BY day
+	`, pgx.NamedArgs{
+		"siteID":   siteID,
+		"timezone": timezone,
+		"from":     from,
+		"rollupTo": time.Now().Truncate(time.Hour).Add(-time.Hour),
+	})
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var date string
+		var totalChecks, successfulChecks int
+		if err := rows.Scan(&date, &totalChecks, &successfulChecks); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		i, ok := index[date]
+		if !ok || totalChecks == 0 {
+			continue
+		}
+		uptime := float64(successfulChecks) / float64(totalChecks) * 100
+		result.Days[i].TotalChecks = totalChecks
+		result.Days[i].UptimePercentage = &uptime
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Spread the incidents over the days they overlap
+	rows, err = s.db.Pool.Query(context.Background(), `
+		SELECT id, started_at, resolved_at
+		FROM incidents
+		WHERE site_id = $1 AND (resolved_at IS NULL OR resolved_at > $2)
+		ORDER BY started_at
+	`, siteID, from)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var incident models.IncidentRef
+		if err := rows.Scan(&incident.ID, &incident.StartedAt, &incident.ResolvedAt); err != nil {
+			return nil, err
+		}
+		end := now
+		if incident.ResolvedAt != nil {
+			end = *incident.ResolvedAt
+		}
+
+		for i := range result.Days {
+			start := maxTime(incident.StartedAt, boundaries[i])
+			stop := minTime(end, boundaries[i+1])
+			if !start.Before(stop) {
+				continue
+			}
+			result.Days[i].DowntimeMinutes += int(stop.Sub(start).Round(time.Minute) / time.Minute)
+			result.Days[i].Incidents = append(result.Days[i].Incidents, incident)
+		}
+	}
+
+	return result, rows.Err()
+}
+
+// maxTime returns the later of two times
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
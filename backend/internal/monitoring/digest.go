@@ -0,0 +1,251 @@
+package monitoring
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"github.com/abstractmelon/is-site-live/internal/auth"
+	"github.com/abstractmelon/is-site-live/internal/database"
+	"github.com/abstractmelon/is-site-live/internal/metrics"
+	"github.com/abstractmelon/is-site-live/internal/models"
+	"github.com/abstractmelon/is-site-live/internal/utils"
+)
+
+// digestInterval is how often the digest scheduler looks for digests to send
+const digestInterval = 15 * time.Minute
+
+// digestSlowestPeriods is how many of the slowest hours a digest lists per site
+const digestSlowestPeriods = 3
+
+// digestScheduler periodically sends uptime digests to users who opted in
+func (s *Service) digestScheduler(interval time.Duration) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case <-ticker.C:
+			if s.isLeader() {
+				s.sendDueDigests()
+			}
+		}
+	}
+}
+
+// sendDueDigests sends a digest to every opted-in user whose last digest's
+// period ended at least one period ago
+func (s *Service) sendDueDigests() {
+	rows, err := s.db.Pool.Query(context.Background(), `
+		SELECT id, username, email, digest_frequency, digest_unsubscribe_token, digest_last_sent_at
+		FROM users
+		WHERE digest_frequency <> $1 AND email IS NOT NULL AND email <> ''
+	`, models.DigestNone)
+	if err != nil {
+		metrics.DBErrors.WithLabelValues("digest").Inc()
+		slog.Error("Error getting digest subscribers", "error", err)
+		return
+	}
+
+	type subscriber struct {
+		id         int
+		username   string
+		email      string
+		frequency  string
+		token      *string
+		lastSentAt *time.Time
+	}
+	var subscribers []subscriber
+	for rows.Next() {
+		var sub subscriber
+		err := rows.Scan(&sub.id, &sub.username, &sub.email, &sub.frequency, &sub.token, &sub.lastSentAt)
+		if err != nil {
+			rows.Close()
+			metrics.DBErrors.WithLabelValues("digest").Inc()
+			slog.Error("Error scanning digest subscriber", "error", err)
+			return
+		}
+		subscribers = append(subscribers, sub)
+	}
+	rows.Close()
+
+	now := time.Now()
+	for _, sub := range subscribers {
+		period := models.DigestPeriod(sub.frequency)
+		if period == 0 || (sub.lastSentAt != nil && now.Sub(*sub.lastSentAt) < period) {
+			continue
+		}
+
+		// Digests cover whole periods following the previous one, so the
+		// scheduler interval doesn't make them drift later each time. After
+		// an outage, the latest period that has ended is sent.
+		to := now
+		if sub.lastSentAt != nil {
+			to = sub.lastSentAt.Add(period)
+			to = to.Add(now.Sub(to) / period * period)
+		}
+
+		if err := s.sendDigest(sub.id, sub.username, sub.email, sub.frequency, sub.token, to.Add(-period), to); err != nil {
+			slog.Error("Error sending digest", "user_id", sub.id, "error", err)
+		}
+	}
+}
+
+// sendDigest builds and queues a digest for a user and records the end of its
+// period, which the next digest starts from
+func (s *Service) sendDigest(userID int, username, email, frequency string, token *string, from, to time.Time) error {
+	digest, err := s.BuildDigest(userID, from, to)
+	if err != nil {
+		return err
+	}
+	digest.Username = username
+	digest.Frequency = frequency
+
+	return s.withTx(func(q database.Querier) error {
+		// Make sure the user has an unsubscribe token
+		if token == nil {
+			newToken, err := auth.GenerateRandomToken()
+			if err != nil {
+				return err
+			}
+			err = q.QueryRow(context.Background(), `
+				UPDATE users
+				SET digest_unsubscribe_token = COALESCE(digest_unsubscribe_token, $1)
+				WHERE id = $2
+				RETURNING digest_unsubscribe_token
+			`, newToken, userID).Scan(&token)
+			if err != nil {
+				return err
+			}
+		}
+
+		unsubscribeURL := fmt.Sprintf("%s/digest/unsubscribe?token=%s", s.config.Server.PublicURL, url.QueryEscape(*token))
+		data := utils.DigestData{Digest: digest, UnsubscribeURL: unsubscribeURL}
+		headers := map[string]string{
+			// One-click unsubscribe, see RFC 8058
+			"List-Unsubscribe":      "<" + unsubscribeURL + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		}
+		if err := s.enqueueEmail(q, &userID, email, utils.TemplateDigest, data, headers); err != nil {
+			return err
+		}
+
+		_, err := q.Exec(context.Background(), `
+			UPDATE users SET digest_last_sent_at = $1 WHERE id = $2
+		`, to, userID)
+		return err
+	})
+}
+
+// BuildDigest summarises every site of a user between two times
+func (s *Service) BuildDigest(userID int, from, to time.Time) (*models.Digest, error) {
+	rows, err := s.db.Pool.Query(context.Background(), `
+		SELECT id, name, url, cert_expires_at
+		FROM sites
+		WHERE user_id = $1
+		ORDER BY name
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	type digestSite struct {
+		id     int
+		digest models.SiteDigest
+	}
+	var sites []digestSite
+	for rows.Next() {
+		var site digestSite
+		err := rows.Scan(&site.id, &site.digest.Name, &site.digest.URL, &site.digest.CertExpiresAt)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		sites = append(sites, site)
+	}
+	rows.Close()
+
+	digest := &models.Digest{
+		From:  from,
+		To:    to,
+		Sites: []models.SiteDigest{},
+	}
+	for _, site := range sites {
+		site.digest.Stats, err = s.getUptimeStatsBetween(site.id, from, to)
+		if err != nil {
+			return nil, err
+		}
+
+		site.digest.Incidents, err = s.getIncidentsBetween(site.id, from, to)
+		if err != nil {
+			return nil, err
+		}
+
+		site.digest.SlowestPeriods, err = s.getSlowestPeriods(site.id, from, to, digestSlowestPeriods)
+		if err != nil {
+			return nil, err
+		}
+
+		digest.Sites = append(digest.Sites, site.digest)
+	}
+
+	return digest, nil
+}
+
+// getIncidentsBetween gets the incidents of a site that overlap two times
+func (s *Service) getIncidentsBetween(siteID int, from, to time.Time) ([]models.Incident, error) {
+	rows, err := s.db.Pool.Query(context.Background(), `
+		SELECT `+incidentColumns+`
+		FROM incidents
+		WHERE site_id = $1 AND started_at < $3 AND (resolved_at IS NULL OR resolved_at >= $2)
+		ORDER BY started_at
+	`, siteID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	incidents := []models.Incident{}
+	for rows.Next() {
+		incident, err := scanIncident(rows)
+		if err != nil {
+			return nil, err
+		}
+		incidents = append(incidents, *incident)
+	}
+
+	return incidents, rows.Err()
+}
+
+// getSlowestPeriods gets the hours with the highest average response time of
+// a site between two times
+func (s *Service) getSlowestPeriods(siteID int, from, to time.Time, limit int) ([]models.SlowPeriod, error) {
+	rows, err := s.db.Pool.Query(context.Background(), `
+		SELECT bucket, avg_response_time
+		FROM check_rollups_hourly
+		WHERE site_id = $1 AND bucket >= $2 AND bucket < $3 AND avg_response_time IS NOT NULL
+		ORDER BY avg_response_time DESC
+		LIMIT $4
+	`, siteID, from.Truncate(time.Hour), to, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	periods := []models.SlowPeriod{}
+	for rows.Next() {
+		var period models.SlowPeriod
+		if err := rows.Scan(&period.Start, &period.AverageResponseTime); err != nil {
+			return nil, err
+		}
+		periods = append(periods, period)
+	}
+
+	return periods, rows.Err()
+}
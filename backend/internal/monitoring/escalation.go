@@ -0,0 +1,346 @@
+package monitoring
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/abstractmelon/is-site-live/internal/database"
+	"github.com/abstractmelon/is-site-live/internal/metrics"
+	"github.com/abstractmelon/is-site-live/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// escalationInterval is how often the escalator looks for incidents to escalate
+const escalationInterval = 30 * time.Second
+
+// ErrScheduleNotFound is returned when an on-call schedule does not exist
+var ErrScheduleNotFound = errors.New("on-call schedule not found")
+
+// ErrPolicyNotFound is returned when an escalation policy does not exist
+var ErrPolicyNotFound = errors.New("escalation policy not found")
+
+// escalator periodically escalates unacknowledged incidents and sends the
+// summaries of alerts dropped by rate limiting
+func (s *Service) escalator(interval time.Duration) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case <-ticker.C:
+			if s.isLeader() {
+				s.runEscalations()
+				s.sendRateLimitSummaries()
+			}
+		}
+	}
+}
+
+// runEscalations escalates every open, unacknowledged incident of a site with
+// an escalation policy
+func (s *Service) runEscalations() {
+	rows, err := s.db.Pool.Query(context.Background(), `
+		SELECT st.id, st.user_id, st.name, st.url, st.escalation_policy_id, st.created_at, st.updated_at,
+			i.id, i.site_id, i.started_at, i.resolved_at, i.acknowledged_at, i.acknowledged_by,
+			i.status_code, COALESCE(i.error_message, ''), i.escalation_step, i.last_escalated_at
+		FROM incidents i
+		JOIN sites st ON st.id = i.site_id
+		WHERE i.resolved_at IS NULL
+			AND i.acknowledged_at IS NULL
+			AND st.escalation_policy_id IS NOT NULL
+	`)
+	if err != nil {
+		metrics.DBErrors.WithLabelValues("escalation").Inc()
+		slog.Error("Error getting incidents to escalate", "error", err)
+		return
+	}
+
+	type pending struct {
+		site     models.Site
+		incident models.Incident
+	}
+	var incidents []pending
+	for rows.Next() {
+		var p pending
+		err := rows.Scan(
+			&p.site.ID,
+			&p.site.UserID,
+			&p.site.Name,
+			&p.site.URL,
+			&p.site.EscalationPolicyID,
+			&p.site.CreatedAt,
+			&p.site.UpdatedAt,
+			&p.incident.ID,
+			&p.incident.SiteID,
+			&p.incident.StartedAt,
+			&p.incident.ResolvedAt,
+			&p.incident.AcknowledgedAt,
+			&p.incident.AcknowledgedBy,
+			&p.incident.StatusCode,
+			&p.incident.ErrorMessage,
+			&p.incident.EscalationStep,
+			&p.incident.LastEscalatedAt,
+		)
+		if err != nil {
+			rows.Close()
+			metrics.DBErrors.WithLabelValues("escalation").Inc()
+			slog.Error("Error scanning incident to escalate", "error", err)
+			return
+		}
+		incidents = append(incidents, p)
+	}
+	rows.Close()
+
+	for i := range incidents {
+		// Flapping sites get a single notice instead of escalations
+		if s.flapDetector.isFlapping(incidents[i].site.ID) {
+			continue
+		}
+
+		// Claim and notify each incident's steps in their own transaction
+		err := s.withTx(func(q database.Querier) error {
+			return s.escalateIncident(q, incidents[i].site, &incidents[i].incident)
+		})
+		if err != nil {
+			metrics.DBErrors.WithLabelValues("escalation").Inc()
+			slog.Error("Error escalating incident", "incident_id", incidents[i].incident.ID, "site_id", incidents[i].site.ID, "error", err)
+		}
+	}
+}
+
+// escalateIncident notifies every escalation step that is due for an incident
+func (s *Service) escalateIncident(q database.Querier, site models.Site, incident *models.Incident) error {
+	if site.EscalationPolicyID == nil || incident.IsAcknowledged() || !incident.IsOpen() {
+		return nil
+	}
+
+	policy, err := s.GetEscalationPolicy(*site.EscalationPolicyID)
+	if err != nil {
+		return fmt.Errorf("failed to get escalation policy %d: %v", *site.EscalationPolicyID, err)
+	}
+
+	now := time.Now()
+	for incident.EscalationStep < len(policy.Steps) {
+		step := policy.Steps[incident.EscalationStep]
+
+		// Each step waits for its delay after the previous one
+		since := incident.StartedAt
+		if incident.LastEscalatedAt != nil {
+			since = *incident.LastEscalatedAt
+		}
+		if now.Before(since.Add(time.Duration(step.DelayMinutes) * time.Minute)) {
+			return nil
+		}
+
+		// Claim the step so it is only notified once
+		result, err := q.Exec(context.Background(), `
+			UPDATE incidents
+			SET escalation_step = $2, last_escalated_at = $3
+			WHERE id = $1 AND escalation_step = $4 AND acknowledged_at IS NULL AND resolved_at IS NULL
+		`, incident.ID, incident.EscalationStep+1, now, incident.EscalationStep)
+		if err != nil {
+			return err
+		}
+		if result.RowsAffected() == 0 {
+			return nil
+		}
+
+		userIDs, err := s.resolveStepTargets(step, now)
+		if err != nil {
+			slog.Error("Error resolving targets of escalation step", "step", step.Position, "incident_id", incident.ID, "site_id", site.ID, "error", err)
+		}
+		for _, userID := range userIDs {
+			pageable, err := canPage(q, site.UserID, userID)
+			if err != nil {
+				return err
+			}
+			if !pageable {
+				slog.Warn("Skipping user who no longer agrees to be paged by the site owner", "user_id", userID, "incident_id", incident.ID, "site_id", site.ID)
+				continue
+			}
+			if err := s.notifyUserOfIncident(q, userID, site, incident, step.Position); err != nil {
+				return err
+			}
+		}
+
+		incident.EscalationStep++
+		incident.LastEscalatedAt = &now
+	}
+
+	return nil
+}
+
+// canPage reports whether a user may be paged by a site owner: the owner
+// themselves, or a user who agreed to it and hasn't withdrawn since
+func canPage(q database.Querier, ownerID, userID int) (bool, error) {
+	if userID == ownerID {
+		return true, nil
+	}
+	var consents bool
+	err := q.QueryRow(context.Background(), `
+		SELECT EXISTS (SELECT 1 FROM oncall_consents WHERE user_id = $1 AND pager_id = $2)
+	`, userID, ownerID).Scan(&consents)
+	return consents, err
+}
+
+// resolveStepTargets returns the users an escalation step notifies at a given time
+func (s *Service) resolveStepTargets(step models.EscalationStep, at time.Time) ([]int, error) {
+	switch step.TargetType {
+	case models.TargetTypeUser:
+		return []int{step.TargetID}, nil
+	case models.TargetTypeSchedule:
+		schedule, err := s.GetOnCallSchedule(step.TargetID)
+		if err != nil {
+			return nil, err
+		}
+		userID, err := schedule.OnCallAt(at)
+		if err != nil {
+			return nil, err
+		}
+		return []int{userID}, nil
+	default:
+		return nil, fmt.Errorf("unknown target type %q", step.TargetType)
+	}
+}
+
+// GetEscalationPolicy gets an escalation policy with its steps
+func (s *Service) GetEscalationPolicy(policyID int) (*models.EscalationPolicy, error) {
+	var policy models.EscalationPolicy
+	err := s.db.Pool.QueryRow(context.Background(), `
+		SELECT id, user_id, name, created_at, updated_at
+		FROM escalation_policies
+		WHERE id = $1
+	`, policyID).Scan(
+		&policy.ID,
+		&policy.UserID,
+		&policy.Name,
+		&policy.CreatedAt,
+		&policy.UpdatedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrPolicyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Get the policy's steps
+	rows, err := s.db.Pool.Query(context.Background(), `
+		SELECT position, delay_minutes, target_type, target_id
+		FROM escalation_steps
+		WHERE policy_id = $1
+		ORDER BY position
+	`, policyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	policy.Steps = []models.EscalationStep{}
+	for rows.Next() {
+		var step models.EscalationStep
+		err := rows.Scan(
+			&step.Position,
+			&step.DelayMinutes,
+			&step.TargetType,
+			&step.TargetID,
+		)
+		if err != nil {
+			return nil, err
+		}
+		policy.Steps = append(policy.Steps, step)
+	}
+
+	return &policy, rows.Err()
+}
+
+// GetOnCallSchedule gets an on-call schedule with its members and overrides
+func (s *Service) GetOnCallSchedule(scheduleID int) (*models.OnCallSchedule, error) {
+	var schedule models.OnCallSchedule
+	err := s.db.Pool.QueryRow(context.Background(), `
+		SELECT id, user_id, name, timezone, rotation, handoff_time, start_date, created_at, updated_at
+		FROM oncall_schedules
+		WHERE id = $1
+	`, scheduleID).Scan(
+		&schedule.ID,
+		&schedule.UserID,
+		&schedule.Name,
+		&schedule.Timezone,
+		&schedule.Rotation,
+		&schedule.HandoffTime,
+		&schedule.StartDate,
+		&schedule.CreatedAt,
+		&schedule.UpdatedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrScheduleNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Get the rotation members in order
+	rows, err := s.db.Pool.Query(context.Background(), `
+		SELECT m.user_id, u.username
+		FROM oncall_schedule_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.schedule_id = $1
+		ORDER BY m.position
+	`, scheduleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schedule.Members = []models.OnCallMember{}
+	for rows.Next() {
+		var member models.OnCallMember
+		if err := rows.Scan(&member.UserID, &member.Username); err != nil {
+			return nil, err
+		}
+		schedule.Members = append(schedule.Members, member)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Get overrides that haven't ended yet
+	rows, err = s.db.Pool.Query(context.Background(), `
+		SELECT o.id, o.schedule_id, o.user_id, u.username, o.starts_at, o.ends_at, o.created_at
+		FROM oncall_overrides o
+		JOIN users u ON u.id = o.user_id
+		WHERE o.schedule_id = $1 AND o.ends_at > NOW()
+		ORDER BY o.starts_at
+	`, scheduleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schedule.Overrides = []models.OnCallOverride{}
+	for rows.Next() {
+		var override models.OnCallOverride
+		err := rows.Scan(
+			&override.ID,
+			&override.ScheduleID,
+			&override.UserID,
+			&override.Username,
+			&override.StartsAt,
+			&override.EndsAt,
+			&override.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		schedule.Overrides = append(schedule.Overrides, override)
+	}
+
+	return &schedule, rows.Err()
+}
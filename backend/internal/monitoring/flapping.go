@@ -0,0 +1,174 @@
+package monitoring
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/abstractmelon/is-site-live/internal/config"
+	"github.com/abstractmelon/is-site-live/internal/models"
+)
+
+// flapState holds the recent check history of a site
+type flapState struct {
+	history  []bool // oldest first
+	flapping bool
+	percent  float64
+}
+
+// flapDetector detects sites that keep switching between up and down, using
+// the weighted state change percentage over the recent checks like Nagios
+type flapDetector struct {
+	mu     sync.Mutex
+	window int
+	high   float64
+	low    float64
+	sites  map[int]*flapState
+}
+
+// newFlapDetector creates a new flap detector
+func newFlapDetector(cfg config.AlertsConfig) *flapDetector {
+	window := cfg.FlapWindow
+	if window < 3 {
+		window = 3
+	}
+
+	return &flapDetector{
+		window: window,
+		high:   cfg.FlapHighThreshold,
+		low:    cfg.FlapLowThreshold,
+		sites:  make(map[int]*flapState),
+	}
+}
+
+// record adds a check result to a site's history. seed loads the previous
+// results the first time a site is seen. It returns whether the site is
+// flapping, whether that just changed, and the current state change percentage.
+func (d *flapDetector) record(siteID int, isUp bool, seed func(limit int) ([]bool, error)) (bool, bool, float64) {
+	d.mu.Lock()
+	state, ok := d.sites[siteID]
+	d.mu.Unlock()
+
+	if !ok {
+		// Load the history outside the lock; a failed load just starts empty
+		history, _ := seed(d.window - 1)
+		state = &flapState{history: history}
+		state.percent = stateChangePercent(state.history)
+		state.flapping = state.percent > d.high
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// Another check may have seeded the site in the meantime
+	if existing, ok := d.sites[siteID]; ok {
+		state = existing
+	} else {
+		d.sites[siteID] = state
+	}
+
+	state.history = append(state.history, isUp)
+	if len(state.history) > d.window {
+		state.history = state.history[len(state.history)-d.window:]
+	}
+	state.percent = stateChangePercent(state.history)
+
+	// Use separate start and stop thresholds so the flapping state itself doesn't flap
+	wasFlapping := state.flapping
+	if !state.flapping && state.percent > d.high {
+		state.flapping = true
+	} else if state.flapping && state.percent < d.low {
+		state.flapping = false
+	}
+
+	return state.flapping, state.flapping != wasFlapping, state.percent
+}
+
+// isFlapping reports whether a site is currently flapping
+func (d *flapDetector) isFlapping(siteID int) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	state, ok := d.sites[siteID]
+	return ok && state.flapping
+}
+
+// stateChangePercent computes the percentage of state changes in a history.
+// Changes are weighted from 0.8 for the oldest to 1.2 for the newest so that
+// recent changes count more.
+func stateChangePercent(history []bool) float64 {
+	transitions := len(history) - 1
+	if transitions < 1 {
+		return 0
+	}
+
+	var weighted float64
+	for i := 1; i < len(history); i++ {
+		if history[i] == history[i-1] {
+			continue
+		}
+		weight := 1.0
+		if transitions > 1 {
+			weight = 0.8 + 0.4*float64(i-1)/float64(transitions-1)
+		}
+		weighted += weight
+	}
+
+	return weighted / float64(transitions) * 100
+}
+
+// recentCheckStates gets the up/down state of the latest checks of a site
+// before a given time, oldest first. Checks still buffered in the check
+// writer are included, as they aren't in the database yet.
+func (s *Service) recentCheckStates(siteID int, before time.Time, limit int) ([]bool, error) {
+	// Read the buffered checks first, so a batch written meanwhile is found
+	// in both rather than in neither
+	buffered := s.checkWriter.buffered(siteID, before)
+
+	rows, err := s.db.Pool.Query(context.Background(), `
+		SELECT is_up, checked_at
+		FROM checks
+		WHERE site_id = $1 AND checked_at < $2
+		ORDER BY checked_at DESC
+		LIMIT $3
+	`, siteID, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var checks []models.Check
+	written := make(map[time.Time]bool)
+	for rows.Next() {
+		var check models.Check
+		if err := rows.Scan(&check.IsUp, &check.CheckedAt); err != nil {
+			return nil, err
+		}
+		checks = append(checks, check)
+		written[check.CheckedAt.UTC()] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// The database stores microseconds
+	for _, check := range buffered {
+		if !written[check.CheckedAt.Truncate(time.Microsecond).UTC()] {
+			checks = append(checks, check)
+		}
+	}
+
+	sort.Slice(checks, func(i, j int) bool {
+		return checks[i].CheckedAt.Before(checks[j].CheckedAt)
+	})
+	if len(checks) > limit {
+		checks = checks[len(checks)-limit:]
+	}
+
+	states := make([]bool, len(checks))
+	for i, check := range checks {
+		states[i] = check.IsUp
+	}
+	return states, nil
+}
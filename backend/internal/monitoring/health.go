@@ -0,0 +1,146 @@
+package monitoring
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/abstractmelon/is-site-live/internal/models"
+)
+
+// Health check limits
+const (
+	healthTimeout          = 2 * time.Second // timeout of each dependency check
+	maxMissedTicks         = 3               // scheduler ticks missed before it counts as stuck
+	maxWorkerUtilization   = 0.9             // share of the interval spent checking before workers count as overloaded
+	maxNotificationBacklog = 5 * time.Minute // how long a due notification may wait to be sent
+)
+
+// GetLiveness reports whether the scheduler is still ticking. A stuck
+// scheduler doesn't recover on its own, so the server should be restarted.
+func (s *Service) GetLiveness() models.HealthReport {
+	report := models.HealthReport{Scheduler: s.schedulerHealth()}
+	report.Status = overallHealth(report.Scheduler.Status)
+	return report
+}
+
+// GetReadiness reports whether the server and its dependencies work: the
+// database, its schema, the scheduler, the check workers and, on PostgreSQL,
+// the notification outbox
+func (s *Service) GetReadiness(ctx context.Context) models.HealthReport {
+	ctx, cancel := context.WithTimeout(ctx, healthTimeout)
+	defer cancel()
+
+	report := models.HealthReport{
+		Database:   s.databaseHealth(ctx),
+		Migrations: s.migrationHealth(ctx),
+		Scheduler:  s.schedulerHealth(),
+		Workers:    s.workerHealth(),
+	}
+	statuses := []string{report.Database.Status, report.Migrations.Status, report.Scheduler.Status, report.Workers.Status}
+	if s.db != nil {
+		report.Notifications = s.notificationHealth(ctx)
+		statuses = append(statuses, report.Notifications.Status)
+	}
+	report.Status = overallHealth(statuses...)
+	return report
+}
+
+// overallHealth is unhealthy if any of the statuses is
+func overallHealth(statuses ...string) string {
+	for _, status := range statuses {
+		if status != models.HealthOK {
+			return models.HealthUnhealthy
+		}
+	}
+	return models.HealthOK
+}
+
+// databaseHealth pings the database
+func (s *Service) databaseHealth(ctx context.Context) *models.DatabaseHealth {
+	start := time.Now()
+	err := s.store.Ping(ctx)
+	health := &models.DatabaseHealth{
+		Status:    models.HealthOK,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		health.Status = models.HealthUnhealthy
+		health.Error = err.Error()
+	}
+	return health
+}
+
+// migrationHealth checks that the database schema is not older than the
+// server. A newer schema, e.g. while rolling out an upgrade, is fine.
+func (s *Service) migrationHealth(ctx context.Context) *models.MigrationHealth {
+	current, latest, err := s.store.SchemaVersion(ctx)
+	health := &models.MigrationHealth{Status: models.HealthOK, Version: current, Latest: latest}
+	switch {
+	case err != nil:
+		health.Status = models.HealthUnhealthy
+		health.Error = err.Error()
+	case current < latest:
+		health.Status = models.HealthUnhealthy
+		health.Error = fmt.Sprintf("schema version %d is behind %d", current, latest)
+	}
+	return health
+}
+
+// schedulerHealth checks that the scheduler ticked recently, or is still
+// beating while a slow round waits for the workers
+func (s *Service) schedulerHealth() *models.SchedulerHealth {
+	lastTick := time.Unix(0, s.lastTick.Load())
+	health := &models.SchedulerHealth{
+		Status:     models.HealthOK,
+		LastTickAt: lastTick.UTC(),
+		Interval:   int(s.checkInterval.Seconds()),
+		Leader:     s.isLeader(),
+	}
+	if s.lastTick.Load() == 0 {
+		health.Status = models.HealthUnhealthy
+		health.Error = "scheduler not started"
+	} else if since := time.Since(lastTick); since > maxMissedTicks*s.checkInterval {
+		health.Status = models.HealthUnhealthy
+		health.Error = fmt.Sprintf("no tick for %s", since.Round(time.Second))
+	}
+	return health
+}
+
+// workerHealth checks that checking the sites takes less time than the check
+// interval allows
+func (s *Service) workerHealth() *models.WorkerHealth {
+	utilization := math.Float64frombits(s.utilization.Load())
+	health := &models.WorkerHealth{
+		Status:      models.HealthOK,
+		Utilization: math.Round(utilization*1000) / 1000,
+		Sites:       int(s.lastRoundSize.Load()),
+	}
+	if utilization > maxWorkerUtilization {
+		health.Status = models.HealthUnhealthy
+		health.Error = "checks are falling behind the check interval"
+	}
+	return health
+}
+
+// notificationHealth checks that due notifications are being sent. Messages
+// waiting for a retry or being sent don't count, unless their dispatcher died
+// while sending them.
+func (s *Service) notificationHealth(ctx context.Context) *models.NotificationHealth {
+	health := &models.NotificationHealth{Status: models.HealthOK}
+	err := s.db.Pool.QueryRow(ctx, `
+		SELECT COUNT(*), MIN(next_attempt_at)
+		FROM notification_outbox
+		WHERE status IN ($1, $2) AND next_attempt_at <= NOW()
+	`, models.OutboxPending, models.OutboxSending).Scan(&health.Backlog, &health.OldestDueAt)
+	switch {
+	case err != nil:
+		health.Status = models.HealthUnhealthy
+		health.Error = err.Error()
+	case health.OldestDueAt != nil && time.Since(*health.OldestDueAt) > maxNotificationBacklog:
+		health.Status = models.HealthUnhealthy
+		health.Error = fmt.Sprintf("notifications waiting for %s", time.Since(*health.OldestDueAt).Round(time.Second))
+	}
+	return health
+}
@@ -0,0 +1,219 @@
+package monitoring
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abstractmelon/is-site-live/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrInvalidCursor is returned when a check history cursor can't be decoded
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// seriesQuery summarises raw checks into buckets of a date_trunc unit
+const seriesQuery = `
+	SELECT
+		date_trunc('%s', checked_at, 'UTC') AS bucket,
+		COUNT(*) AS total_checks,
+		COUNT(*) FILTER (WHERE is_up) AS successful_checks,
+		AVG(response_time) FILTER (WHERE is_up)::int AS avg_response_time,
+		(percentile_cont(0.95) WITHIN GROUP (ORDER BY response_time) FILTER (WHERE is_up))::int AS p95_response_time
+	FROM checks
+	WHERE site_id = @siteID AND checked_at >= @rawFrom AND checked_at < @to
+	GROUP BY bucket
+`
+
+// GetCheckSeries gets the checks of a site between two times summarised at
+// a resolution. From is rounded down to the resolution. Hourly and daily
+// series are read from the rollups, except for the buckets the rollup job
+// may not have summarised yet.
+func (s *Service) GetCheckSeries(siteID int, from, to time.Time, resolution string) (*models.CheckSeries, error) {
+	bucketSize := models.ResolutionBucketSize(resolution)
+	if bucketSize == 0 {
+		return nil, fmt.Errorf("unsupported resolution %q", resolution)
+	}
+	var rollupTable string
+	switch resolution {
+	case models.ResolutionHour:
+		rollupTable = "check_rollups_hourly"
+	case models.ResolutionDay:
+		rollupTable = "check_rollups_daily"
+	}
+	from = from.Truncate(bucketSize)
+
+	args := pgx.NamedArgs{
+		"siteID":  siteID,
+		"from":    from,
+		"to":      to,
+		"rawFrom": from,
+	}
+	query := fmt.Sprintf(seriesQuery, resolution)
+	if rollupTable != "" {
+		// Same boundary as the uptime stats, see postgres.CheckBucketsQuery
+		rollupTo := time.Now().Truncate(time.Hour).Add(-time.Hour).Truncate(bucketSize)
+		if rollupTo.After(from) {
+			args["rollupTo"] = rollupTo
+			args["rawFrom"] = rollupTo
+			query = `
+				SELECT bucket, total_checks, successful_checks, avg_response_time, p95_response_time
+				FROM ` + rollupTable + `
+				WHERE site_id = @siteID AND bucket >= @from AND bucket < @rollupTo AND bucket < @to
+				UNION ALL
+			` + query
+		}
+	}
+
+	if err := s.checkSiteExists(siteID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Pool.Query(context.Background(), `
+		SELECT * FROM (`+query+`) AS series ORDER BY bucket
+	`, args)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	series := &models.CheckSeries{
+		SiteID:     siteID,
+		From:       from,
+		To:         to,
+		Resolution: resolution,
+		Points:     []models.CheckSeriesPoint{},
+	}
+	for rows.Next() {
+		var point models.CheckSeriesPoint
+		err := rows.Scan(
+			&point.Time,
+			&point.TotalChecks,
+			&point.SuccessfulChecks,
+			&point.AverageResponseTime,
+			&point.P95ResponseTime,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if point.TotalChecks > 0 {
+			point.UptimePercentage = float64(point.SuccessfulChecks) / float64(point.TotalChecks) * 100
+		}
+		series.Points = append(series.Points, point)
+	}
+
+	return series, rows.Err()
+}
+
+// GetChecks gets a page of the raw checks of a site between two times, oldest
+// first. The cursor is the NextCursor of the previous page, or empty for the
+// first page.
+func (s *Service) GetChecks(siteID int, from, to time.Time, cursor string, limit int) (*models.CheckPage, error) {
+	afterTime, afterID := from, 0
+	if cursor != "" {
+		var err error
+		afterTime, afterID, err = decodeCheckCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.checkSiteExists(siteID); err != nil {
+		return nil, err
+	}
+
+	// Fetch one extra check to know whether there is a next page
+	rows, err := s.db.Pool.Query(context.Background(), `
+		SELECT id, site_id, COALESCE(status_code, 0), COALESCE(response_time, 0), is_up,
+			COALESCE(error_message, ''), checked_at, location
+		FROM checks
+		WHERE site_id = $1 AND checked_at >= $2 AND checked_at < $3 AND (checked_at, id) > ($4, $5)
+		ORDER BY checked_at, id
+		LIMIT $6
+	`, siteID, from, to, afterTime, afterID, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &models.CheckPage{
+		SiteID:     siteID,
+		From:       from,
+		To:         to,
+		Resolution: models.ResolutionRaw,
+		Checks:     []models.Check{},
+	}
+	for rows.Next() {
+		var check models.Check
+		err := rows.Scan(
+			&check.ID,
+			&check.SiteID,
+			&check.StatusCode,
+			&check.ResponseTime,
+			&check.IsUp,
+			&check.ErrorMessage,
+			&check.CheckedAt,
+			&check.Location,
+		)
+		if err != nil {
+			return nil, err
+		}
+		page.Checks = append(page.Checks, check)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(page.Checks) > limit {
+		page.Checks = page.Checks[:limit]
+		last := page.Checks[limit-1]
+		page.NextCursor = encodeCheckCursor(last.CheckedAt, last.ID)
+	}
+
+	return page, nil
+}
+
+// checkSiteExists returns ErrSiteNotFound if a site does not exist
+func (s *Service) checkSiteExists(siteID int) error {
+	var exists bool
+	err := s.db.Pool.QueryRow(context.Background(), `
+		SELECT EXISTS (SELECT 1 FROM sites WHERE id = $1)
+	`, siteID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrSiteNotFound
+	}
+	return nil
+}
+
+// encodeCheckCursor encodes the position of a check in the history
+func encodeCheckCursor(checkedAt time.Time, id int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(checkedAt.UTC().Format(time.RFC3339Nano) + "," + strconv.Itoa(id)))
+}
+
+// decodeCheckCursor decodes a cursor made by encodeCheckCursor
+func decodeCheckCursor(cursor string) (time.Time, int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	timeText, idText, ok := strings.Cut(string(raw), ",")
+	if !ok {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	checkedAt, err := time.Parse(time.RFC3339Nano, timeText)
+	if err != nil {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	id, err := strconv.Atoi(idText)
+	if err != nil {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	return checkedAt, id, nil
+}
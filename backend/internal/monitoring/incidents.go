@@ -0,0 +1,204 @@
+package monitoring
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/abstractmelon/is-site-live/internal/database"
+	"github.com/abstractmelon/is-site-live/internal/metrics"
+	"github.com/abstractmelon/is-site-live/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrIncidentNotFound is returned when an incident does not exist
+var ErrIncidentNotFound = errors.New("incident not found")
+
+// ErrIncidentClosed is returned when acknowledging an incident that is
+// already resolved or acknowledged
+var ErrIncidentClosed = errors.New("incident is already resolved or acknowledged")
+
+// incidentColumns lists the columns scanned by scanIncident
+const incidentColumns = `id, site_id, started_at, resolved_at, acknowledged_at, acknowledged_by,
+	status_code, error_message, escalation_step, last_escalated_at`
+
+// scanIncident scans a row selected with incidentColumns
+func scanIncident(row pgx.Row) (*models.Incident, error) {
+	var incident models.Incident
+	var errorMessage *string
+	err := row.Scan(
+		&incident.ID,
+		&incident.SiteID,
+		&incident.StartedAt,
+		&incident.ResolvedAt,
+		&incident.AcknowledgedAt,
+		&incident.AcknowledgedBy,
+		&incident.StatusCode,
+		&errorMessage,
+		&incident.EscalationStep,
+		&incident.LastEscalatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if errorMessage != nil {
+		incident.ErrorMessage = *errorMessage
+	}
+	return &incident, nil
+}
+
+// handleStateChange opens an incident when a site goes down and resolves it
+// when the site comes back up. While a site is flapping, per-transition
+// notifications are replaced by a single flapping notice. The notifications
+// are queued in the same transaction as the incident change, so they are
+// never lost. changed tells whether the site's state differs from the
+// previous check, or is unknown; other checks only update the flap history
+// unless they start or stop the flapping, sparing the database a
+// transaction per check.
+func (s *Service) handleStateChange(site models.Site, statusCode int, isUp, changed bool, errorMessage string, checkedAt time.Time) {
+	flapping, flappingChanged, percent := s.flapDetector.record(site.ID, isUp, func(limit int) ([]bool, error) {
+		return s.recentCheckStates(site.ID, checkedAt, limit)
+	})
+	if !changed && !flappingChanged {
+		return
+	}
+
+	err := s.withTx(func(q database.Querier) error {
+		if flappingChanged {
+			if err := s.notifyFlapping(q, site, flapping, isUp, percent); err != nil {
+				return err
+			}
+		}
+
+		incident, err := s.getOpenIncident(q, site.ID)
+		if err != nil {
+			return fmt.Errorf("failed to get open incident: %v", err)
+		}
+
+		switch {
+		case !isUp && incident == nil:
+			incident, err = s.openIncident(q, site.ID, statusCode, errorMessage)
+			if err != nil {
+				return fmt.Errorf("failed to open incident: %v", err)
+			}
+			if incident != nil && !flapping {
+				return s.notifyIncidentOpened(q, site, incident)
+			}
+		case isUp && incident != nil:
+			if err := s.resolveIncident(q, incident); err != nil {
+				return fmt.Errorf("failed to resolve incident %d: %v", incident.ID, err)
+			}
+			if !flapping {
+				return s.notifyIncidentResolved(q, site, incident, statusCode)
+			}
+		case !isUp && incident != nil && flappingChanged && !flapping:
+			// The site settled down while an incident is open, alert as usual
+			return s.notifyIncidentOpened(q, site, incident)
+		}
+		return nil
+	})
+	if err != nil {
+		metrics.DBErrors.WithLabelValues("incidents").Inc()
+		slog.Error("Error handling state change", "site_id", site.ID, "error", err)
+	}
+}
+
+// getOpenIncident gets the open incident for a site, or nil if the site has none
+func (s *Service) getOpenIncident(q database.Querier, siteID int) (*models.Incident, error) {
+	incident, err := scanIncident(q.QueryRow(context.Background(), `
+		SELECT `+incidentColumns+`
+		FROM incidents
+		WHERE site_id = $1 AND resolved_at IS NULL
+	`, siteID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return incident, err
+}
+
+// openIncident creates a new incident for a site. It returns nil if another
+// incident was opened concurrently.
+func (s *Service) openIncident(q database.Querier, siteID, statusCode int, errorMessage string) (*models.Incident, error) {
+	incident, err := scanIncident(q.QueryRow(context.Background(), `
+		INSERT INTO incidents (site_id, started_at, status_code, error_message)
+		VALUES ($1, NOW(), $2, $3)
+		ON CONFLICT (site_id) WHERE resolved_at IS NULL DO NOTHING
+		RETURNING `+incidentColumns,
+		siteID, statusCode, errorMessage))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return incident, err
+}
+
+// resolveIncident marks an incident as resolved
+func (s *Service) resolveIncident(q database.Querier, incident *models.Incident) error {
+	return q.QueryRow(context.Background(), `
+		UPDATE incidents
+		SET resolved_at = NOW()
+		WHERE id = $1
+		RETURNING resolved_at
+	`, incident.ID).Scan(&incident.ResolvedAt)
+}
+
+// GetIncident gets an incident by ID
+func (s *Service) GetIncident(incidentID int) (*models.Incident, error) {
+	incident, err := scanIncident(s.db.Pool.QueryRow(context.Background(), `
+		SELECT `+incidentColumns+`
+		FROM incidents
+		WHERE id = $1
+	`, incidentID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrIncidentNotFound
+	}
+	return incident, err
+}
+
+// AcknowledgeIncident acknowledges an open incident on behalf of a user,
+// which stops any further escalation
+func (s *Service) AcknowledgeIncident(incidentID, userID int) (*models.Incident, error) {
+	incident, err := scanIncident(s.db.Pool.QueryRow(context.Background(), `
+		UPDATE incidents
+		SET acknowledged_at = NOW(), acknowledged_by = $2
+		WHERE id = $1 AND resolved_at IS NULL AND acknowledged_at IS NULL
+		RETURNING `+incidentColumns,
+		incidentID, userID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Tell apart a missing incident from one that can't be acknowledged
+		if _, err := s.GetIncident(incidentID); err != nil {
+			return nil, err
+		}
+		return nil, ErrIncidentClosed
+	}
+	return incident, err
+}
+
+// CanAcknowledgeIncident reports whether a user may acknowledge an incident,
+// which is the case for the site owner and anyone who was notified about it
+func (s *Service) CanAcknowledgeIncident(incidentID, userID int) (bool, error) {
+	var allowed bool
+	err := s.db.Pool.QueryRow(context.Background(), `
+		SELECT EXISTS (
+			SELECT 1
+			FROM incidents i
+			JOIN sites s ON s.id = i.site_id
+			WHERE i.id = $1 AND s.user_id = $2
+		) OR EXISTS (
+			SELECT 1
+			FROM incident_notifications
+			WHERE incident_id = $1 AND user_id = $2
+		)
+	`, incidentID, userID).Scan(&allowed)
+	return allowed, err
+}
+
+// incidentDuration returns how long an incident lasted, rounded to the second
+func incidentDuration(incident *models.Incident) time.Duration {
+	end := time.Now()
+	if incident.ResolvedAt != nil {
+		end = *incident.ResolvedAt
+	}
+	return end.Sub(incident.StartedAt).Round(time.Second)
+}
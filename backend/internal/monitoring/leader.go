@@ -0,0 +1,116 @@
+package monitoring
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/abstractmelon/is-site-live/internal/metrics"
+	"github.com/jackc/pgx/v5"
+)
+
+// leaderLockID is the advisory lock held by the instance that checks the
+// sites and runs the background jobs, so replicas sharing a database don't
+// check every site several times
+const leaderLockID = 4738120952
+
+// leaderInterval is how often a follower tries to take over, and how often
+// the leader checks that its session, and so its lock, is still alive
+const leaderInterval = 10 * time.Second
+
+// leaderTimeout is the timeout of each leader election query
+const leaderTimeout = 5 * time.Second
+
+// isLeader reports whether this instance checks the sites and runs the jobs
+// that must only run once. Without PostgreSQL there is a single instance,
+// which always leads.
+func (s *Service) isLeader() bool {
+	return s.db == nil || s.leader.Load()
+}
+
+// setLeader records whether this instance leads
+func (s *Service) setLeader(leader bool) {
+	if leader && !s.leader.Swap(true) {
+		// Followers don't apply every check to the snapshots, so the states
+		// they hold may be stale and would trigger spurious state changes
+		s.resetSnapshots()
+	}
+	s.leader.Store(leader)
+	if leader {
+		metrics.SchedulerLeader.Set(1)
+	} else {
+		metrics.SchedulerLeader.Set(0)
+	}
+}
+
+// leaderElector keeps the leadership or takes it over once the leader is
+// gone. The leader holds a session-level advisory lock on a connection of its
+// own, so PostgreSQL releases the lock as soon as the leader stops or its
+// connection drops, and another instance takes over within leaderInterval.
+func (s *Service) leaderElector(interval time.Duration) {
+	defer s.wg.Done()
+
+	conn := s.elect(nil)
+	defer func() {
+		// Closing the session releases the lock for the other instances
+		if conn != nil {
+			conn.Close(context.Background())
+			s.setLeader(false)
+		}
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case <-ticker.C:
+			conn = s.elect(conn)
+		}
+	}
+}
+
+// elect keeps or tries to take the leadership, returning the connection
+// holding the lock, nil while following
+func (s *Service) elect(conn *pgx.Conn) *pgx.Conn {
+	ctx, cancel := context.WithTimeout(context.Background(), leaderTimeout)
+	defer cancel()
+
+	// Check the session holding the lock is still alive
+	if conn != nil {
+		err := conn.Ping(ctx)
+		if err == nil {
+			return conn
+		}
+		conn.Close(context.Background())
+		s.setLeader(false)
+		slog.Warn("Lost the scheduler leadership", "error", err)
+	}
+
+	pooled, err := s.db.Pool.Acquire(ctx)
+	if err != nil {
+		metrics.DBErrors.WithLabelValues("leader_election").Inc()
+		slog.Error("Error acquiring a connection for leader election", "error", err)
+		return nil
+	}
+
+	var acquired bool
+	if err := pooled.QueryRow(ctx, `SELECT pg_try_advisory_lock($1)`, leaderLockID).Scan(&acquired); err != nil {
+		pooled.Release()
+		metrics.DBErrors.WithLabelValues("leader_election").Inc()
+		slog.Error("Error trying the leader lock", "error", err)
+		return nil
+	}
+	if !acquired {
+		// Another instance leads
+		pooled.Release()
+		return nil
+	}
+
+	// Take the connection out of the pool so the lock stays with it
+	s.setLeader(true)
+	slog.Info("Became the scheduler leader")
+	return pooled.Hijack()
+}
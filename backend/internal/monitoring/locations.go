@@ -0,0 +1,127 @@
+package monitoring
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/abstractmelon/is-site-live/internal/metrics"
+	"github.com/abstractmelon/is-site-live/internal/models"
+)
+
+// locationStatsDays is the period of the per-location stats of a site
+const locationStatsDays = 7
+
+// loadLocationResults loads the latest result of every location that reported
+// recently. Probes may push their results to any instance, so every instance
+// reloads them each round, keeping results it got that aren't written yet.
+func (s *Service) loadLocationResults() {
+	loaded, err := s.store.Checks.LatestByLocation(context.Background(),
+		time.Now().Add(-s.config.Monitoring.MaxCheckGap()))
+	if err != nil {
+		metrics.DBErrors.WithLabelValues("location_results").Inc()
+		slog.Error("Error getting location results", "error", err)
+		return
+	}
+
+	s.locationsMu.Lock()
+	defer s.locationsMu.Unlock()
+
+	for siteID, checks := range s.locationResults {
+		for _, check := range checks {
+			loaded[siteID] = withLocationResult(loaded[siteID], check)
+		}
+	}
+	s.locationResults = loaded
+}
+
+// setLocationResult keeps the latest result of a location
+func (s *Service) setLocationResult(check models.Check) {
+	s.locationsMu.Lock()
+	defer s.locationsMu.Unlock()
+
+	s.locationResults[check.SiteID] = withLocationResult(s.locationResults[check.SiteID], check)
+}
+
+// getLocationResults gets the latest result of every location of a site
+func (s *Service) getLocationResults(siteID int) []models.Check {
+	s.locationsMu.Lock()
+	defer s.locationsMu.Unlock()
+
+	return append([]models.Check(nil), s.locationResults[siteID]...)
+}
+
+// withLocationResult replaces the result of the check's location if the check
+// is newer
+func withLocationResult(checks []models.Check, check models.Check) []models.Check {
+	for i, existing := range checks {
+		if existing.Location == check.Location {
+			if check.CheckedAt.After(existing.CheckedAt) {
+				checks[i] = check
+			}
+			return checks
+		}
+	}
+	return append(checks, check)
+}
+
+// consensus decides the state of a site from the server's own check and the
+// latest results of the other locations within the same window. The site is
+// down once the site's quorum of locations fail, a majority by default, or
+// all of them when fewer locations reported. The reported check is the
+// server's own if it agrees, otherwise the latest result that does.
+func (s *Service) consensus(site models.Site, own models.Check) models.Check {
+	results := []models.Check{own}
+	since := own.CheckedAt.Add(-s.config.Monitoring.MaxCheckGap())
+	for _, check := range s.getLocationResults(site.ID) {
+		if check.Location != own.Location && check.CheckedAt.After(since) {
+			results = append(results, check)
+		}
+	}
+
+	quorum := len(results)/2 + 1
+	if site.LocationQuorum > 0 {
+		quorum = min(site.LocationQuorum, len(results))
+	}
+	down := 0
+	for _, check := range results {
+		if !check.IsUp {
+			down++
+		}
+	}
+	isUp := down < quorum
+	if own.IsUp == isUp {
+		return own
+	}
+
+	var agreeing models.Check
+	for _, check := range results {
+		if check.IsUp == isUp && check.CheckedAt.After(agreeing.CheckedAt) {
+			agreeing = check
+		}
+	}
+	agreeing.ID = 0
+	agreeing.CheckedAt = own.CheckedAt
+	return agreeing
+}
+
+// locationStats completes the per-location stats of a site with the latest
+// result of each location, nil until a location reported
+func (s *Service) locationStats(siteID int, locations []models.LocationStats) []models.LocationStats {
+	if len(locations) == 0 {
+		return nil
+	}
+
+	results := s.getLocationResults(siteID)
+	stats := make([]models.LocationStats, len(locations))
+	copy(stats, locations)
+	for i := range stats {
+		for _, check := range results {
+			if check.Location == stats[i].Location {
+				current := check
+				stats[i].Current = &current
+			}
+		}
+	}
+	return stats
+}
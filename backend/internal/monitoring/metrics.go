@@ -0,0 +1,137 @@
+package monitoring
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"sync"
+
+	"github.com/abstractmelon/is-site-live/internal/metrics"
+	"github.com/abstractmelon/is-site-live/internal/models"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Descriptions of the per-site metrics
+var (
+	siteLabels = []string{"site_id", "site", "owner"}
+
+	siteUpDesc = prometheus.NewDesc("isitlive_site_up",
+		"Whether the latest check of the site succeeded.", siteLabels, nil)
+	siteResponseTimeDesc = prometheus.NewDesc("isitlive_site_response_time_seconds",
+		"Response time of the latest check of the site.", siteLabels, nil)
+	siteCertExpiryDesc = prometheus.NewDesc("isitlive_site_certificate_expiry_timestamp_seconds",
+		"When the certificate of the site expires, as a Unix timestamp.", siteLabels, nil)
+	siteUptimeDesc = prometheus.NewDesc("isitlive_site_uptime_ratio",
+		"Time-weighted uptime of the site over a window, from 0 to 1.", append(siteLabels, "window"), nil)
+	checkWriteQueueDesc = prometheus.NewDesc("isitlive_check_write_queue_depth",
+		"Check results waiting to be written to the database.", nil, nil)
+)
+
+// statsWindowLabels are the window labels of the uptime windows of a snapshot
+var statsWindowLabels = [len(statsWindows)]string{"lifetime", "7d", "30d", "90d"}
+
+// siteCollector exposes the status of every site from the sites cache and
+// the site snapshots
+type siteCollector struct {
+	service *Service
+
+	owners   map[int]string // usernames by user ID, as usernames never change
+	ownersMu sync.Mutex
+}
+
+// MetricsCollector returns a collector exposing the status, certificate
+// expiry and uptime of every site, labelled by site and owner
+func (s *Service) MetricsCollector() prometheus.Collector {
+	return &siteCollector{
+		service: s,
+		owners:  make(map[int]string),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *siteCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- siteUpDesc
+	ch <- siteResponseTimeDesc
+	ch <- siteCertExpiryDesc
+	ch <- siteUptimeDesc
+	ch <- checkWriteQueueDesc
+}
+
+// Collect implements prometheus.Collector
+func (c *siteCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(checkWriteQueueDesc, prometheus.GaugeValue, float64(len(c.service.checkWriter.input)))
+
+	// Get the sites checked in the latest round
+	c.service.sitesCacheMu.RLock()
+	sites := make([]models.Site, 0, len(c.service.sitesCache))
+	for _, site := range c.service.sitesCache {
+		sites = append(sites, site)
+	}
+	c.service.sitesCacheMu.RUnlock()
+
+	for _, site := range sites {
+		// Only export the snapshots in memory, so scrapes never query the
+		// database per site. Sites without one show up once they are checked.
+		snapshot, ok := c.service.cachedSnapshot(site.ID)
+		if !ok {
+			continue
+		}
+
+		owner, err := c.owner(site.UserID)
+		if err != nil {
+			metrics.DBErrors.WithLabelValues("metrics").Inc()
+			slog.Error("Error getting site owner for metrics", "site_id", site.ID, "error", err)
+			continue
+		}
+		labels := []string{strconv.Itoa(site.ID), site.Name, owner}
+
+		if site.CertExpiresAt != nil {
+			ch <- prometheus.MustNewConstMetric(siteCertExpiryDesc, prometheus.GaugeValue, float64(site.CertExpiresAt.Unix()), labels...)
+		}
+
+		if snapshot.current == nil {
+			// Not checked yet
+			continue
+		}
+
+		up := 0.0
+		if snapshot.current.IsUp {
+			up = 1
+		}
+		ch <- prometheus.MustNewConstMetric(siteUpDesc, prometheus.GaugeValue, up, labels...)
+		ch <- prometheus.MustNewConstMetric(siteResponseTimeDesc, prometheus.GaugeValue,
+			float64(snapshot.current.ResponseTime)/1000, labels...)
+
+		if snapshot.statsAt.IsZero() {
+			// The stats are loaded when first requested
+			continue
+		}
+		for i, stats := range snapshot.stats {
+			if stats.UpSeconds+stats.DownSeconds == 0 {
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(siteUptimeDesc, prometheus.GaugeValue,
+				stats.TimeWeightedUptime/100, append(labels, statsWindowLabels[i])...)
+		}
+	}
+}
+
+// owner gets the username of a user, caching it
+func (c *siteCollector) owner(userID int) (string, error) {
+	c.ownersMu.Lock()
+	username, ok := c.owners[userID]
+	c.ownersMu.Unlock()
+	if ok {
+		return username, nil
+	}
+
+	user, err := c.service.store.Users.Get(context.Background(), userID)
+	if err != nil {
+		return "", err
+	}
+
+	c.ownersMu.Lock()
+	c.owners[userID] = user.Username
+	c.ownersMu.Unlock()
+	return user.Username, nil
+}
@@ -0,0 +1,159 @@
+package monitoring
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"github.com/abstractmelon/is-site-live/internal/auth"
+	"github.com/abstractmelon/is-site-live/internal/database"
+	"github.com/abstractmelon/is-site-live/internal/models"
+	"github.com/abstractmelon/is-site-live/internal/utils"
+)
+
+// notifyIncidentOpened notifies the right people that a site went down. Sites
+// with an escalation policy go through the escalator, others alert the owner.
+func (s *Service) notifyIncidentOpened(q database.Querier, site models.Site, incident *models.Incident) error {
+	if site.EscalationPolicyID != nil {
+		return s.escalateIncident(q, site, incident)
+	}
+
+	return s.notifyUserOfIncident(q, site.UserID, site, incident, 0)
+}
+
+// notifyUserOfIncident queues a downtime alert for a user and records that
+// they were notified, so they can acknowledge the incident and receive the
+// recovery alert
+func (s *Service) notifyUserOfIncident(q database.Querier, userID int, site models.Site, incident *models.Incident, step int) error {
+	// Record the notification
+	_, err := q.Exec(context.Background(), `
+		INSERT INTO incident_notifications (incident_id, user_id, step)
+		VALUES ($1, $2, $3)
+	`, incident.ID, userID, step)
+	if err != nil {
+		return fmt.Errorf("failed to record notification for incident %d: %v", incident.ID, err)
+	}
+
+	// Queue the alert with a signed acknowledgement link
+	ackURL, err := s.ackURL(incident.ID, userID)
+	if err != nil {
+		slog.Error("Error generating ack link", "incident_id", incident.ID, "error", err)
+	}
+	return s.queueAlert(q, userID, utils.TemplateDowntime, func(username string) interface{} {
+		return utils.DowntimeData{
+			Username:     username,
+			SiteName:     site.Name,
+			SiteURL:      site.URL,
+			StatusText:   utils.StatusCodeText(incident.StatusCode),
+			ErrorMessage: incident.ErrorMessage,
+			AckURL:       ackURL,
+		}
+	})
+}
+
+// notifyIncidentResolved queues a recovery alert for everyone who was
+// notified about an incident
+func (s *Service) notifyIncidentResolved(q database.Querier, site models.Site, incident *models.Incident, statusCode int) error {
+	rows, err := q.Query(context.Background(), `
+		SELECT DISTINCT user_id
+		FROM incident_notifications
+		WHERE incident_id = $1
+	`, incident.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get notified users for incident %d: %v", incident.ID, err)
+	}
+
+	// Read every row first, the connection is busy until the rows are closed
+	var userIDs []int
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan notified user: %v", err)
+		}
+		userIDs = append(userIDs, userID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	downtime := incidentDuration(incident).String()
+	for _, userID := range userIDs {
+		err := s.queueAlert(q, userID, utils.TemplateRecovery, func(username string) interface{} {
+			return utils.RecoveryData{
+				Username:   username,
+				SiteName:   site.Name,
+				SiteURL:    site.URL,
+				StatusText: utils.StatusCodeText(statusCode),
+				Downtime:   downtime,
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// notifyFlapping tells the site owner, and whoever the site's escalation
+// policy pages first, that the site started or stopped flapping
+func (s *Service) notifyFlapping(q database.Querier, site models.Site, flapping, isUp bool, percent float64) error {
+	for _, userID := range s.alertRecipients(site) {
+		err := s.queueAlert(q, userID, utils.TemplateFlapping, func(username string) interface{} {
+			return utils.FlappingData{
+				Username: username,
+				SiteName: site.Name,
+				SiteURL:  site.URL,
+				Flapping: flapping,
+				IsUp:     isUp,
+				Percent:  percent,
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// alertRecipients gets the users told about site-wide notices: the site
+// owner and whoever the site's escalation policy pages first
+func (s *Service) alertRecipients(site models.Site) []int {
+	userIDs := []int{site.UserID}
+	if site.EscalationPolicyID != nil {
+		policy, err := s.GetEscalationPolicy(*site.EscalationPolicyID)
+		if err == nil && len(policy.Steps) > 0 {
+			targets, err := s.resolveStepTargets(policy.Steps[0], time.Now())
+			if err != nil {
+				slog.Error("Error resolving notice targets", "site_id", site.ID, "error", err)
+			}
+			userIDs = append(userIDs, targets...)
+		}
+	}
+
+	// Notify everyone once
+	recipients := make([]int, 0, len(userIDs))
+	seen := make(map[int]bool)
+	for _, userID := range userIDs {
+		if !seen[userID] {
+			seen[userID] = true
+			recipients = append(recipients, userID)
+		}
+	}
+	return recipients
+}
+
+// ackURL builds the signed link a user can follow to acknowledge an incident
+func (s *Service) ackURL(incidentID, userID int) (string, error) {
+	token, err := auth.GenerateAckToken(incidentID, userID, s.config.JWT)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s/incidents/%d/ack?token=%s", s.config.Server.PublicURL, incidentID, url.QueryEscape(token)), nil
+}
@@ -0,0 +1,301 @@
+package monitoring
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/abstractmelon/is-site-live/internal/database"
+	"github.com/abstractmelon/is-site-live/internal/metrics"
+	"github.com/abstractmelon/is-site-live/internal/models"
+	"github.com/abstractmelon/is-site-live/internal/utils"
+	"github.com/jackc/pgx/v5"
+)
+
+// outboxInterval is how often the dispatcher looks for notifications to send
+const outboxInterval = 5 * time.Second
+
+// outboxBatchSize is how many notifications the dispatcher claims at once
+const outboxBatchSize = 20
+
+// outboxLease is how long a claimed batch is reserved for its dispatcher,
+// longer than sending a batch takes even with slow SMTP servers
+const outboxLease = 5 * time.Minute
+
+// outboxRecentDead is how many dead-lettered notifications the status lists
+const outboxRecentDead = 20
+
+// ErrOutboxMessageNotFound is returned when retrying a notification that does
+// not exist or is not dead-lettered
+var ErrOutboxMessageNotFound = errors.New("dead-lettered notification not found")
+
+// outboxMessageColumns lists the columns scanned by scanOutboxMessage
+const outboxMessageColumns = `id, user_id, channel, template, recipient, status, attempts,
+	next_attempt_at, COALESCE(last_error, ''), created_at, sent_at`
+
+// scanOutboxMessage scans a row selected with outboxMessageColumns
+func scanOutboxMessage(row pgx.Row) (*models.OutboxMessage, error) {
+	var message models.OutboxMessage
+	err := row.Scan(
+		&message.ID,
+		&message.UserID,
+		&message.Channel,
+		&message.Template,
+		&message.Recipient,
+		&message.Status,
+		&message.Attempts,
+		&message.NextAttemptAt,
+		&message.LastError,
+		&message.CreatedAt,
+		&message.SentAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// enqueueEmail adds an email to the notification outbox. Nothing is queued
+// when SMTP is not configured, as the email could never be delivered.
+func (s *Service) enqueueEmail(q database.Querier, userID *int, recipient, templateName string, data interface{}, headers map[string]string) error {
+	if !s.emailSender.Configured() {
+		return nil
+	}
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s data: %v", templateName, err)
+	}
+	headersJSON, err := json.Marshal(headers)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s headers: %v", templateName, err)
+	}
+
+	_, err = q.Exec(context.Background(), `
+		INSERT INTO notification_outbox (user_id, channel, template, recipient, payload, headers)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, userID, channelEmail, templateName, recipient, payload, headersJSON)
+	if err != nil {
+		return fmt.Errorf("failed to queue %s email: %v", templateName, err)
+	}
+
+	return nil
+}
+
+// dispatcher periodically delivers the notifications in the outbox
+func (s *Service) dispatcher(interval time.Duration) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case <-ticker.C:
+			// Keep going while full batches are being delivered
+			for {
+				count, err := s.dispatchOutbox(outboxBatchSize)
+				if err != nil {
+					metrics.DBErrors.WithLabelValues("outbox").Inc()
+					slog.Error("Error dispatching notifications", "error", err)
+				}
+				if err != nil || count < outboxBatchSize {
+					break
+				}
+			}
+		}
+	}
+}
+
+// dispatchOutbox claims a batch of due notifications and tries to deliver
+// them. The batch is claimed in a short transaction that marks it as being
+// sent for outboxLease, locking the rows with SKIP LOCKED so several instances
+// can dispatch concurrently without sending a notification twice. Delivery
+// happens outside the transaction and each result is recorded on its own, so
+// a failure doesn't send the rest of the batch again. Notifications of a
+// dispatcher that died while sending are claimed again once the lease is
+// over. Claiming counts the attempt, so a notification whose delivery keeps
+// stopping the dispatcher is still given up on. It returns how many
+// notifications were claimed.
+func (s *Service) dispatchOutbox(limit int) (int, error) {
+	rows, err := s.db.Pool.Query(context.Background(), `
+		UPDATE notification_outbox
+		SET status = $1, attempts = attempts + 1, next_attempt_at = NOW() + $2 * INTERVAL '1 second'
+		WHERE id IN (
+			SELECT id
+			FROM notification_outbox
+			WHERE status IN ($3, $1) AND next_attempt_at <= NOW()
+			ORDER BY id
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, channel, template, recipient, payload, headers, attempts
+	`, models.OutboxSending, outboxLease.Seconds(), models.OutboxPending, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	type claimed struct {
+		id        int64
+		channel   string
+		template  string
+		recipient string
+		payload   []byte
+		headers   map[string]string
+		attempts  int
+	}
+	var messages []claimed
+	for rows.Next() {
+		var m claimed
+		err := rows.Scan(&m.id, &m.channel, &m.template, &m.recipient, &m.payload, &m.headers, &m.attempts)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		messages = append(messages, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	var recordErr error
+	for _, m := range messages {
+		// The previous dispatcher stopped while sending the last attempt
+		if m.attempts > s.config.Outbox.MaxAttempts {
+			slog.Warn("Giving up on notification", "notification_id", m.id, "channel", m.channel, "attempts", m.attempts-1)
+			_, err := s.db.Pool.Exec(context.Background(), `
+				UPDATE notification_outbox
+				SET status = $2, attempts = attempts - 1, last_error = $3
+				WHERE id = $1
+			`, m.id, models.OutboxDead, "dispatcher stopped while sending")
+			if err != nil {
+				recordErr = err
+				slog.Error("Error recording failed notification", "notification_id", m.id, "error", err)
+			}
+			continue
+		}
+
+		err := s.deliver(m.channel, m.template, m.recipient, m.payload, m.headers)
+		if err == nil {
+			_, err = s.db.Pool.Exec(context.Background(), `
+				UPDATE notification_outbox
+				SET status = $2, last_error = NULL, sent_at = NOW()
+				WHERE id = $1
+			`, m.id, models.OutboxSent)
+			if err != nil {
+				recordErr = err
+				slog.Error("Error recording sent notification", "notification_id", m.id, "error", err)
+			}
+			continue
+		}
+
+		// Retry with exponential backoff, or give up after the last attempt
+		metrics.NotificationFailures.WithLabelValues(m.channel).Inc()
+		status := models.OutboxPending
+		if m.attempts >= s.config.Outbox.MaxAttempts {
+			status = models.OutboxDead
+			slog.Warn("Giving up on notification", "notification_id", m.id, "channel", m.channel, "attempts", m.attempts, "error", err)
+		}
+		_, err = s.db.Pool.Exec(context.Background(), `
+			UPDATE notification_outbox
+			SET status = $2, last_error = $3, next_attempt_at = $4
+			WHERE id = $1
+		`, m.id, status, err.Error(), time.Now().Add(s.retryDelay(m.attempts)))
+		if err != nil {
+			recordErr = err
+			slog.Error("Error recording failed notification", "notification_id", m.id, "error", err)
+		}
+	}
+
+	return len(messages), recordErr
+}
+
+// deliver sends a single notification
+func (s *Service) deliver(channel, templateName, recipient string, payload []byte, headers map[string]string) error {
+	if channel != channelEmail {
+		return fmt.Errorf("unknown notification channel %q", channel)
+	}
+
+	data, err := utils.DecodeTemplateData(templateName, payload)
+	if err != nil {
+		return err
+	}
+	return s.emailSender.Send(recipient, templateName, data, headers)
+}
+
+// retryDelay returns how long to wait before the next attempt, doubling the
+// configured delay on every attempt up to the configured maximum
+func (s *Service) retryDelay(attempts int) time.Duration {
+	delay := min(s.config.Outbox.RetryDelay, s.config.Outbox.MaxRetryDelay)
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= s.config.Outbox.MaxRetryDelay {
+			return s.config.Outbox.MaxRetryDelay
+		}
+	}
+	return delay
+}
+
+// GetOutboxStatus summarises the notification outbox
+func (s *Service) GetOutboxStatus() (*models.OutboxStatus, error) {
+	var status models.OutboxStatus
+	err := s.db.Pool.QueryRow(context.Background(), `
+		SELECT
+			COUNT(*) FILTER (WHERE status IN ($1, $4)),
+			COUNT(*) FILTER (WHERE status = $2),
+			COUNT(*) FILTER (WHERE status = $3),
+			MIN(created_at) FILTER (WHERE status IN ($1, $4))
+		FROM notification_outbox
+	`, models.OutboxPending, models.OutboxSent, models.OutboxDead, models.OutboxSending).Scan(
+		&status.Pending,
+		&status.Sent,
+		&status.Dead,
+		&status.OldestPendingAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Pool.Query(context.Background(), `
+		SELECT `+outboxMessageColumns+`
+		FROM notification_outbox
+		WHERE status = $1
+		ORDER BY id DESC
+		LIMIT $2
+	`, models.OutboxDead, outboxRecentDead)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	status.RecentDead = []models.OutboxMessage{}
+	for rows.Next() {
+		message, err := scanOutboxMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		status.RecentDead = append(status.RecentDead, *message)
+	}
+
+	return &status, rows.Err()
+}
+
+// RetryOutboxMessage puts a dead-lettered notification back in the queue
+func (s *Service) RetryOutboxMessage(id int64) (*models.OutboxMessage, error) {
+	message, err := scanOutboxMessage(s.db.Pool.QueryRow(context.Background(), `
+		UPDATE notification_outbox
+		SET status = $2, attempts = 0, next_attempt_at = NOW()
+		WHERE id = $1 AND status = $3
+		RETURNING `+outboxMessageColumns,
+		id, models.OutboxPending, models.OutboxDead))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrOutboxMessageNotFound
+	}
+	return message, err
+}
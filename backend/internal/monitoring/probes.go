@@ -0,0 +1,85 @@
+package monitoring
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/abstractmelon/is-site-live/internal/models"
+)
+
+// Limits on when the results pushed by probes were checked, so results held
+// back by a probe and clocks that are off don't rewrite the history
+const (
+	maxProbeResultAge = 10 * time.Minute
+	maxProbeClockSkew = time.Minute
+)
+
+// GetProbeAssignment gets the sites a probe checks. Every probe checks every
+// site, at the check interval of the server.
+func (s *Service) GetProbeAssignment(ctx context.Context) (*models.ProbeAssignment, error) {
+	sites, err := s.store.Sites.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(sites, func(i, j int) bool { return sites[i].ID < sites[j].ID })
+
+	assignment := &models.ProbeAssignment{
+		Interval: int(s.config.Monitoring.Interval.Seconds()),
+		Checks:   make([]models.ProbeCheck, 0, len(sites)),
+	}
+	for _, site := range sites {
+		assignment.Checks = append(assignment.Checks, models.ProbeCheck{
+			SiteID:           site.ID,
+			URL:              site.URL,
+			TracePropagation: site.TracePropagation,
+		})
+	}
+	return assignment, nil
+}
+
+// RecordProbeResults records the results pushed by a probe as the results of
+// its location, which count towards the state of the sites on their next check
+// by the server, see consensus. Results of sites that no longer exist or
+// checked outside the accepted period are dropped.
+func (s *Service) RecordProbeResults(ctx context.Context, probe models.Probe, results []models.ProbeResult) (*models.ProbeResultsAccepted, error) {
+	sites, err := s.store.Sites.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sitesByID := make(map[int]models.Site, len(sites))
+	for _, site := range sites {
+		sitesByID[site.ID] = site
+	}
+
+	accepted := &models.ProbeResultsAccepted{}
+	now := time.Now()
+	for _, result := range results {
+		site, ok := sitesByID[result.SiteID]
+		if !ok || result.CheckedAt.Before(now.Add(-maxProbeResultAge)) || result.CheckedAt.After(now.Add(maxProbeClockSkew)) {
+			accepted.Dropped++
+			continue
+		}
+
+		if result.CertExpiresAt != nil {
+			s.recordCertExpiry(site, *result.CertExpiresAt)
+			site.CertExpiresAt = result.CertExpiresAt
+			sitesByID[site.ID] = site
+		}
+
+		check := models.Check{
+			SiteID:       site.ID,
+			StatusCode:   result.StatusCode,
+			ResponseTime: result.ResponseTime,
+			IsUp:         result.IsUp,
+			ErrorMessage: result.ErrorMessage,
+			CheckedAt:    result.CheckedAt,
+			Location:     probe.Location,
+		}
+		s.locationWriter.write(check)
+		s.setLocationResult(check)
+		accepted.Accepted++
+	}
+
+	return accepted, nil
+}
@@ -0,0 +1,192 @@
+package monitoring
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/abstractmelon/is-site-live/internal/config"
+	"github.com/abstractmelon/is-site-live/internal/database"
+	"github.com/abstractmelon/is-site-live/internal/metrics"
+	"github.com/abstractmelon/is-site-live/internal/utils"
+)
+
+// Notification channels
+const (
+	channelEmail = "email"
+)
+
+// alertLimitLockID is the advisory lock taken by transactions queueing
+// alerts, so concurrent alerts, also from other instances, see each other's
+// sends when counting them against the limits
+const alertLimitLockID = 4738120953
+
+// alertLimiter enforces per-user and per-channel alert rate limits over a
+// sliding window. Sends and dropped alerts are recorded in the database in
+// the transaction queueing the alert, so alerts rolled back don't count and
+// the limits hold across instances.
+type alertLimiter struct {
+	perUser    int
+	perChannel int
+	window     time.Duration
+}
+
+// newAlertLimiter creates a new alert limiter
+func newAlertLimiter(cfg config.AlertsConfig) *alertLimiter {
+	window := cfg.RateLimitWindow
+	if window <= 0 {
+		window = time.Hour
+	}
+
+	return &alertLimiter{
+		perUser:    cfg.RateLimitPerUser,
+		perChannel: cfg.RateLimitPerChannel,
+		window:     window,
+	}
+}
+
+// allow reports whether an alert may be sent to a user over a channel, and
+// records it as sent or dropped. q must be a transaction, which holds the
+// limit lock until it ends. A limit of 0 means unlimited.
+func (l *alertLimiter) allow(q database.Querier, userID int, channel string) (bool, error) {
+	if l.perUser <= 0 && l.perChannel <= 0 {
+		return true, nil
+	}
+
+	ctx := context.Background()
+	if _, err := q.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, alertLimitLockID); err != nil {
+		return false, fmt.Errorf("failed to lock alert limits: %v", err)
+	}
+
+	var userSends, channelSends int
+	err := q.QueryRow(ctx, `
+		SELECT
+			COUNT(*) FILTER (WHERE user_id = $1),
+			COUNT(*) FILTER (WHERE channel = $2)
+		FROM alert_sends
+		WHERE sent_at > NOW() - $3 * INTERVAL '1 second'
+	`, userID, channel, l.window.Seconds()).Scan(&userSends, &channelSends)
+	if err != nil {
+		return false, fmt.Errorf("failed to count alerts: %v", err)
+	}
+
+	if (l.perUser > 0 && userSends >= l.perUser) || (l.perChannel > 0 && channelSends >= l.perChannel) {
+		_, err := q.Exec(ctx, `
+			INSERT INTO alert_drops (user_id, dropped) VALUES ($1, 1)
+			ON CONFLICT (user_id) DO UPDATE SET dropped = alert_drops.dropped + 1
+		`, userID)
+		if err != nil {
+			return false, fmt.Errorf("failed to record dropped alert: %v", err)
+		}
+		return false, nil
+	}
+
+	_, err = q.Exec(ctx, `
+		INSERT INTO alert_sends (user_id, channel) VALUES ($1, $2)
+	`, userID, channel)
+	if err != nil {
+		return false, fmt.Errorf("failed to record alert: %v", err)
+	}
+	return true, nil
+}
+
+// dueSummaries returns and clears the dropped alert counts of users whose
+// first dropped alert is at least one window old, and forgets the sends that
+// fell out of the window
+func (l *alertLimiter) dueSummaries(q database.Querier) (map[int]int, error) {
+	ctx := context.Background()
+	_, err := q.Exec(ctx, `
+		DELETE FROM alert_sends WHERE sent_at <= NOW() - $1 * INTERVAL '1 second'
+	`, l.window.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to prune alert sends: %v", err)
+	}
+
+	rows, err := q.Query(ctx, `
+		DELETE FROM alert_drops WHERE since <= NOW() - $1 * INTERVAL '1 second'
+		RETURNING user_id, dropped
+	`, l.window.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dropped alerts: %v", err)
+	}
+	defer rows.Close()
+
+	due := make(map[int]int)
+	for rows.Next() {
+		var userID, dropped int
+		if err := rows.Scan(&userID, &dropped); err != nil {
+			return nil, err
+		}
+		due[userID] = dropped
+	}
+	return due, rows.Err()
+}
+
+// queueAlert queues an email alert for a user unless a rate limit has been
+// reached, in which case the alert is counted for the summary message. Users
+// without an email address are skipped. q must be a transaction, see
+// alertLimiter.allow.
+func (s *Service) queueAlert(q database.Querier, userID int, templateName string, data func(username string) interface{}) error {
+	var username string
+	var email *string
+	err := q.QueryRow(context.Background(), `
+		SELECT username, email FROM users WHERE id = $1
+	`, userID).Scan(&username, &email)
+	if err != nil {
+		return fmt.Errorf("failed to get user %d: %v", userID, err)
+	}
+	if email == nil || *email == "" {
+		return nil
+	}
+
+	allowed, err := s.alertLimiter.allow(q, userID, channelEmail)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		slog.Warn("Dropping alert, rate limit reached", "channel", channelEmail, "user_id", userID)
+		return nil
+	}
+
+	return s.enqueueEmail(q, &userID, *email, templateName, data(username), nil)
+}
+
+// sendRateLimitSummaries tells users how many alerts they missed because of
+// rate limiting
+func (s *Service) sendRateLimitSummaries() {
+	err := s.withTx(func(q database.Querier) error {
+		due, err := s.alertLimiter.dueSummaries(q)
+		if err != nil {
+			return err
+		}
+
+		for userID, count := range due {
+			var username string
+			var email *string
+			err := q.QueryRow(context.Background(), `
+				SELECT username, email FROM users WHERE id = $1
+			`, userID).Scan(&username, &email)
+			if err != nil {
+				return fmt.Errorf("failed to get user %d: %v", userID, err)
+			}
+			if email == nil || *email == "" {
+				continue
+			}
+
+			data := utils.RateLimitSummaryData{
+				Username: username,
+				Dropped:  count,
+				Window:   s.alertLimiter.window,
+			}
+			if err := s.enqueueEmail(q, &userID, *email, utils.TemplateRateLimitSummary, data, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		metrics.DBErrors.WithLabelValues("alert_summary").Inc()
+		slog.Error("Error queueing alert summaries", "error", err)
+	}
+}
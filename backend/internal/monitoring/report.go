@@ -0,0 +1,70 @@
+package monitoring
+
+import (
+	"time"
+
+	"github.com/abstractmelon/is-site-live/internal/models"
+)
+
+// GetSLAReport gets the uptime of a site for each day of a month in the
+// given timezone. Days that haven't started yet are left empty.
+func (s *Service) GetSLAReport(site models.Site, year int, month time.Month, loc *time.Location) (*models.SLAReport, error) {
+	report := &models.SLAReport{
+		SiteID:      site.ID,
+		SiteName:    site.Name,
+		URL:         site.URL,
+		Month:       time.Date(year, month, 1, 0, 0, 0, 0, loc).Format("2006-01"),
+		Timezone:    loc.String(),
+		GeneratedAt: time.Now().UTC(),
+		Days:        []models.SLAReportDay{},
+	}
+
+	// Day boundaries in the timezone, which may be 23 or 25 hours apart
+	now := time.Now()
+	var responseTimeSum int
+	var upSeconds int64
+	for day := time.Date(year, month, 1, 0, 0, 0, 0, loc); day.Month() == month; day = day.AddDate(0, 0, 1) {
+		reportDay := models.SLAReportDay{Date: day.Format("2006-01-02")}
+		if day.Before(now) {
+			stats, err := s.getUptimeStatsBetween(site.ID, day, minTime(day.AddDate(0, 0, 1), now))
+			if err != nil {
+				return nil, err
+			}
+			reportDay.TotalChecks = stats.TotalChecks
+			reportDay.SuccessfulChecks = stats.SuccessfulChecks
+			reportDay.AverageResponseTime = stats.AverageResponseTime
+			reportDay.DownSeconds = stats.DownSeconds
+			reportDay.NoDataSeconds = stats.NoDataSeconds
+			if stats.TotalChecks > 0 {
+				uptime := stats.UptimePercentage
+				reportDay.UptimePercentage = &uptime
+			}
+			if stats.UpSeconds+stats.DownSeconds > 0 {
+				uptime := stats.TimeWeightedUptime
+				reportDay.TimeWeightedUptime = &uptime
+			}
+
+			report.TotalChecks += stats.TotalChecks
+			report.SuccessfulChecks += stats.SuccessfulChecks
+			report.DownSeconds += stats.DownSeconds
+			report.NoDataSeconds += stats.NoDataSeconds
+			responseTimeSum += stats.AverageResponseTime * stats.SuccessfulChecks
+			upSeconds += stats.UpSeconds
+		}
+		report.Days = append(report.Days, reportDay)
+	}
+
+	if report.TotalChecks > 0 {
+		uptime := float64(report.SuccessfulChecks) / float64(report.TotalChecks) * 100
+		report.UptimePercentage = &uptime
+	}
+	if upSeconds+report.DownSeconds > 0 {
+		uptime := float64(upSeconds) / float64(upSeconds+report.DownSeconds) * 100
+		report.TimeWeightedUptime = &uptime
+	}
+	if report.SuccessfulChecks > 0 {
+		report.AverageResponseTime = responseTimeSum / report.SuccessfulChecks
+	}
+
+	return report, nil
+}
@@ -0,0 +1,241 @@
+package monitoring
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/abstractmelon/is-site-live/internal/database"
+	"github.com/abstractmelon/is-site-live/internal/metrics"
+	"github.com/abstractmelon/is-site-live/internal/models"
+	"github.com/abstractmelon/is-site-live/internal/storage/postgres"
+)
+
+// rollupInterval is how often the rollup job summarises new checks
+const rollupInterval = 5 * time.Minute
+
+// minRetention is the shortest raw check retention, so the daily rollups
+// can always be recomputed from raw checks
+const minRetention = 2 * 24 * time.Hour
+
+// rollupQuery recomputes the buckets of a granularity touched by the checks
+// with IDs in ($2, $3]: the buckets of these checks, and of the check before
+// each of them, whose duration they cut short. Checks arriving late, e.g. in
+// a delayed batch, are summarised as well. Buckets are recomputed from
+// scratch, so running it again over the same checks is harmless. Each check
+// covers the time until the next check, at most the maximum check gap ($1, in
+// seconds), counted in the bucket of the check.
+const rollupQuery = `
+	WITH new_checks AS (
+		SELECT site_id, checked_at FROM checks WHERE id > $2 AND id <= $3
+	), touched AS (
+		SELECT site_id, date_trunc('%[2]s', checked_at, 'UTC') AS bucket
+		FROM new_checks
+		UNION
+		SELECT n.site_id, date_trunc('%[2]s', previous.checked_at, 'UTC')
+		FROM new_checks n
+		CROSS JOIN LATERAL (
+			SELECT checked_at FROM checks
+			WHERE site_id = n.site_id AND checked_at < n.checked_at
+			ORDER BY checked_at DESC
+			LIMIT 1
+		) AS previous
+	)
+	INSERT INTO %[1]s (
+		site_id, bucket, total_checks, successful_checks, response_time_sum, response_time_sq_sum,
+		min_response_time, avg_response_time, p95_response_time, max_response_time, latency_histogram,
+		up_seconds, down_seconds
+	)
+	SELECT
+		site_id,
+		date_trunc('%[2]s', checked_at, 'UTC') AS bucket,
+		COUNT(*),
+		COUNT(*) FILTER (WHERE is_up),
+		COALESCE(SUM(response_time) FILTER (WHERE is_up), 0),
+		COALESCE(SUM(response_time::float8 * response_time) FILTER (WHERE is_up), 0),
+		MIN(response_time) FILTER (WHERE is_up),
+		AVG(response_time) FILTER (WHERE is_up)::int,
+		(percentile_cont(0.95) WITHIN GROUP (ORDER BY response_time) FILTER (WHERE is_up))::int,
+		MAX(response_time) FILTER (WHERE is_up),
+		%[3]s,
+		COALESCE(SUM(covered) FILTER (WHERE is_up), 0),
+		COALESCE(SUM(covered) FILTER (WHERE NOT is_up), 0)
+	FROM (
+		-- The checks of the touched buckets, and those right after them that
+		-- end the durations of their last checks
+		SELECT site_id, response_time, is_up, checked_at,
+			EXTRACT(EPOCH FROM LEAST(
+				LEAD(checked_at) OVER (PARTITION BY site_id ORDER BY checked_at),
+				checked_at + make_interval(secs => $1),
+				NOW()
+			) - checked_at) AS covered
+		FROM checks c
+		WHERE EXISTS (
+			SELECT 1 FROM touched t
+			WHERE t.site_id = c.site_id
+				AND c.checked_at >= t.bucket
+				AND c.checked_at < t.bucket + INTERVAL '1 %[2]s' + make_interval(secs => $1)
+		)
+	) AS checks
+	WHERE (site_id, date_trunc('%[2]s', checked_at, 'UTC')) IN (SELECT site_id, bucket FROM touched)
+	GROUP BY site_id, bucket
+	ON CONFLICT (site_id, bucket) DO UPDATE SET
+		total_checks = EXCLUDED.total_checks,
+		successful_checks = EXCLUDED.successful_checks,
+		response_time_sum = EXCLUDED.response_time_sum,
+		response_time_sq_sum = EXCLUDED.response_time_sq_sum,
+		min_response_time = EXCLUDED.min_response_time,
+		avg_response_time = EXCLUDED.avg_response_time,
+		p95_response_time = EXCLUDED.p95_response_time,
+		max_response_time = EXCLUDED.max_response_time,
+		latency_histogram = EXCLUDED.latency_histogram,
+		up_seconds = EXCLUDED.up_seconds,
+		down_seconds = EXCLUDED.down_seconds
+`
+
+// rollupJob periodically summarises checks into the rollup tables and
+// deletes raw checks older than the retention period
+func (s *Service) rollupJob(interval time.Duration) {
+	defer s.wg.Done()
+
+	// Catch up right away, e.g. after an upgrade or downtime
+	if s.isLeader() {
+		s.runRollups()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case <-ticker.C:
+			if s.isLeader() {
+				s.runRollups()
+			}
+		}
+	}
+}
+
+// runRollups updates the rollups, then applies the retention period
+func (s *Service) runRollups() {
+	if err := s.updateRollups(); err != nil {
+		metrics.DBErrors.WithLabelValues("rollups").Inc()
+		slog.Error("Error updating check rollups", "error", err)
+		// Don't delete checks that may not have been summarised yet
+		return
+	}
+
+	if err := s.deleteExpiredChecks(); err != nil {
+		metrics.DBErrors.WithLabelValues("retention").Inc()
+		slog.Error("Error deleting expired checks", "error", err)
+	}
+}
+
+// updateRollups recomputes the hourly and daily buckets touched by the checks
+// written since the last update, tracked by the highest check ID summarised
+func (s *Service) updateRollups() error {
+	return s.withTx(func(q database.Querier) error {
+		var from, to int64
+		err := q.QueryRow(context.Background(), `
+			SELECT
+				COALESCE((SELECT last_check_id FROM rollup_watermark), 0),
+				COALESCE((SELECT MAX(id) FROM checks), 0)
+		`).Scan(&from, &to)
+		if err != nil {
+			return fmt.Errorf("failed to get the rollup watermark: %v", err)
+		}
+		if to <= from {
+			return nil
+		}
+
+		for _, rollup := range []struct{ table, unit string }{
+			{"check_rollups_hourly", "hour"},
+			{"check_rollups_daily", "day"},
+		} {
+			histogram := postgres.LatencyHistogramSQL("COUNT(*) FILTER (WHERE %s)")
+			query := fmt.Sprintf(rollupQuery, rollup.table, rollup.unit, histogram)
+			if _, err := q.Exec(context.Background(), query, s.config.Monitoring.MaxCheckGap().Seconds(), from, to); err != nil {
+				return fmt.Errorf("failed to update %s: %v", rollup.table, err)
+			}
+		}
+
+		_, err = q.Exec(context.Background(), `
+			UPDATE rollup_watermark SET last_check_id = $1
+		`, to)
+		if err != nil {
+			return fmt.Errorf("failed to update the rollup watermark: %v", err)
+		}
+		return nil
+	})
+}
+
+// deleteExpiredChecks deletes raw checks and results of single locations
+// older than the retention period
+func (s *Service) deleteExpiredChecks() error {
+	retention := s.config.Monitoring.Retention
+	if retention <= 0 {
+		return nil
+	}
+	if retention < minRetention {
+		retention = minRetention
+	}
+
+	for _, table := range []string{"checks", "location_checks"} {
+		_, err := s.db.Pool.Exec(context.Background(), `
+			DELETE FROM `+table+` WHERE checked_at < $1
+		`, time.Now().Add(-retention))
+		if err != nil {
+			return fmt.Errorf("failed to delete from %s: %v", table, err)
+		}
+	}
+	return nil
+}
+
+// getUptimeStatsBetween gets the uptime statistics for a site between two
+// times
+func (s *Service) getUptimeStatsBetween(siteID int, from, to time.Time) (models.UptimeStats, error) {
+	return s.store.Checks.UptimeStats(context.Background(), siteID, from, to)
+}
+
+// GetLatencyHistogram gets the response time histogram of a site's successful
+// checks over a period of days. If days is 0, the histogram covers the
+// site's lifetime.
+func (s *Service) GetLatencyHistogram(siteID, days int) (*models.LatencyHistogram, error) {
+	if err := s.checkSiteExists(siteID); err != nil {
+		return nil, err
+	}
+
+	histogram := &models.LatencyHistogram{
+		SiteID: siteID,
+		To:     time.Now(),
+	}
+	var from time.Time
+	if days > 0 {
+		from = histogram.To.AddDate(0, 0, -days)
+		histogram.From = &from
+	}
+
+	query, args := postgres.CheckBucketsQuery(siteID, from, histogram.To, s.config.Monitoring.MaxCheckGap())
+	var counts []int64
+	err := s.db.Pool.QueryRow(context.Background(), `
+		WITH buckets AS (`+query+`)
+		SELECT (`+postgres.HistogramQuery+`)
+	`, args).Scan(&counts)
+	if err != nil {
+		return nil, err
+	}
+
+	histogram.Buckets = models.NewHistogramBuckets(counts)
+	return histogram, nil
+}
+
+// minTime returns the earlier of two times
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
@@ -2,67 +2,105 @@ package monitoring
 
 import (
 	"context"
-	"fmt"
-	"net"
+	"errors"
+	"log/slog"
+	"math"
 	"net/http"
-	"net/url"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/abstractmelon/is-site-live/internal/checker"
+	"github.com/abstractmelon/is-site-live/internal/config"
 	"github.com/abstractmelon/is-site-live/internal/database"
+	"github.com/abstractmelon/is-site-live/internal/metrics"
 	"github.com/abstractmelon/is-site-live/internal/models"
+	"github.com/abstractmelon/is-site-live/internal/storage"
+	"github.com/abstractmelon/is-site-live/internal/utils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// tracer creates the spans of site checks
+var tracer = otel.Tracer("github.com/abstractmelon/is-site-live/internal/monitoring")
+
+// ErrSiteNotFound is returned when a site does not exist
+var ErrSiteNotFound = errors.New("site not found")
+
 // Service handles the monitoring of sites
 type Service struct {
-	db           *database.DB
-	client       *http.Client
-	stopChan     chan struct{}
-	wg           sync.WaitGroup
-	sitesCache   map[int]models.Site
-	sitesCacheMu sync.RWMutex
+	store           *storage.Store
+	db              *database.DB // nil unless running on PostgreSQL
+	config          *config.Config
+	emailSender     *utils.EmailSender
+	checkWriter     *checkWriter
+	locationWriter  *checkWriter // writes the results of single locations
+	flapDetector    *flapDetector
+	alertLimiter    *alertLimiter
+	client          *http.Client
+	stopChan        chan struct{}
+	wg              sync.WaitGroup
+	sitesCache      map[int]models.Site
+	sitesCacheMu    sync.RWMutex
+	snapshots       map[int]*siteSnapshot
+	snapshotsMu     sync.Mutex
+	sloStatuses     map[int]*models.SLOStatus
+	sloMu           sync.Mutex
+	sloAlerting     map[int]bool           // sites over their burn rate threshold, only used by the SLO job
+	locationResults map[int][]models.Check // latest result of each location, see consensus
+	locationsMu     sync.Mutex
+	leader          atomic.Bool // whether this instance holds the leader lock, see isLeader
+
+	// Scheduler progress, for health checks
+	checkInterval time.Duration
+	lastTick      atomic.Int64  // Unix nanoseconds of the latest tick or heartbeat
+	lastRoundSize atomic.Int64  // sites in the latest round
+	checkBusy     atomic.Int64  // nanoseconds spent checking sites in total
+	utilization   atomic.Uint64 // float64 bits, see models.WorkerHealth
 }
 
-// NewService creates a new monitoring service
-func NewService(db *database.DB) *Service {
-	// Create HTTP client with timeout
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-		Transport: &http.Transport{
-			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-				// Parse the address to get the host
-				host, _, err := net.SplitHostPort(addr)
-				if err != nil {
-					// If SplitHostPort fails, assume the address is just a host
-					host = addr
-				}
-
-				// Check if the host is a private IP
-				ip := net.ParseIP(host)
-				if ip != nil && (ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast()) {
-					return nil, fmt.Errorf("connection to private IP %s is not allowed", host)
-				}
-
-				// Use the default dialer
-				dialer := &net.Dialer{
-					Timeout:   5 * time.Second,
-					KeepAlive: 30 * time.Second,
-				}
-				return dialer.DialContext(ctx, network, addr)
-			},
-		},
-	}
-
+// NewService creates a new monitoring service. Incidents, alerts, digests and
+// rollups need PostgreSQL, so they are disabled when db is nil.
+func NewService(store *storage.Store, db *database.DB, cfg *config.Config) *Service {
 	return &Service{
-		db:         db,
-		client:     client,
-		stopChan:   make(chan struct{}),
-		sitesCache: make(map[int]models.Site),
+		store:           store,
+		db:              db,
+		config:          cfg,
+		emailSender:     utils.NewEmailSender(cfg.SMTP),
+		checkWriter:     newCheckWriter(store.Checks.InsertBatch, "write_checks"),
+		locationWriter:  newCheckWriter(store.Checks.InsertLocationBatch, "write_location_checks"),
+		flapDetector:    newFlapDetector(cfg.Alerts),
+		alertLimiter:    newAlertLimiter(cfg.Alerts),
+		client:          checker.NewClient(),
+		stopChan:        make(chan struct{}),
+		sitesCache:      make(map[int]models.Site),
+		snapshots:       make(map[int]*siteSnapshot),
+		sloStatuses:     make(map[int]*models.SLOStatus),
+		locationResults: make(map[int][]models.Check),
+		sloAlerting:     make(map[int]bool),
 	}
 }
 
 // StartWorkerPool starts the worker pool for monitoring sites
 func (s *Service) StartWorkerPool(numWorkers int, checkInterval time.Duration) {
+	// Start the check writers
+	go s.checkWriter.run()
+	go s.locationWriter.run()
+
+	// Count the scheduler as healthy until its first tick is due
+	s.checkInterval = checkInterval
+	s.lastTick.Store(time.Now().UnixNano())
+
+	// Elect the instance checking the sites when replicas share PostgreSQL
+	if s.db != nil {
+		s.wg.Add(1)
+		go s.leaderElector(leaderInterval)
+	} else {
+		metrics.SchedulerLeader.Set(1)
+	}
+
 	// Start the scheduler
 	s.wg.Add(1)
 	go s.scheduler(checkInterval)
@@ -72,12 +110,55 @@ func (s *Service) StartWorkerPool(numWorkers int, checkInterval time.Duration) {
 		s.wg.Add(1)
 		go s.worker()
 	}
+
+	// Start the SLO job
+	s.wg.Add(1)
+	go s.sloJob(sloInterval)
+
+	// The remaining jobs need PostgreSQL
+	if s.db == nil {
+		return
+	}
+
+	// Start the escalator
+	s.wg.Add(1)
+	go s.escalator(escalationInterval)
+
+	// Start the digest scheduler
+	s.wg.Add(1)
+	go s.digestScheduler(digestInterval)
+
+	// Start the notification dispatcher. It claims notifications with row
+	// locks, so it runs on every instance.
+	s.wg.Add(1)
+	go s.dispatcher(outboxInterval)
+
+	// Start the rollup job
+	s.wg.Add(1)
+	go s.rollupJob(rollupInterval)
 }
 
-// Stop stops the monitoring service
+// Stop stops the monitoring service, writing the check results that are
+// still buffered
 func (s *Service) Stop() {
 	close(s.stopChan)
 	s.wg.Wait()
+	s.checkWriter.close()
+	s.locationWriter.close()
+}
+
+// withTx runs fn in a transaction, committing it if fn succeeds
+func (s *Service) withTx(fn func(q database.Querier) error) error {
+	tx, err := s.db.Pool.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit(context.Background())
 }
 
 // scheduler schedules site checks at regular intervals
@@ -90,32 +171,62 @@ func (s *Service) scheduler(interval time.Duration) {
 	// Channel for site check tasks
 	checkChan := make(chan models.Site)
 
-	// Start a goroutine to send sites to the check channel
+	// Start a goroutine to send sites to the check channel. It beats while
+	// it waits for the workers too, so a slow round doesn't look stuck.
 	go func() {
+		heartbeat := time.NewTicker(interval)
+		defer heartbeat.Stop()
+
+		previousTick, previousBusy := time.Now(), int64(0)
 		for {
 			select {
 			case <-s.stopChan:
 				close(checkChan)
 				return
-			case <-ticker.C:
+			case scheduledAt := <-ticker.C:
+				// Record the progress of the scheduler
+				now, busy := time.Now(), s.checkBusy.Load()
+				if elapsed := now.Sub(previousTick); elapsed > 0 {
+					s.utilization.Store(math.Float64bits(float64(busy-previousBusy) / float64(elapsed)))
+				}
+				previousTick, previousBusy = now, busy
+				s.lastTick.Store(now.UnixNano())
+
 				// Get all sites from the database
 				sites, err := s.getAllSites()
 				if err != nil {
-					fmt.Printf("Error getting sites: %v\n", err)
+					metrics.DBErrors.WithLabelValues("get_sites").Inc()
+					slog.Error("Error getting sites", "error", err)
 					continue
 				}
 
 				// Update the sites cache
+				s.lastRoundSize.Store(int64(len(sites)))
 				s.updateSitesCache(sites)
+				s.pruneSnapshots(sites)
+				s.loadLocationResults()
+
+				// Only the leader checks the sites
+				if !s.isLeader() {
+					s.lastRoundSize.Store(0)
+					metrics.CheckQueueDepth.Set(0)
+					continue
+				}
 
 				// Send each site to the check channel
-				for _, site := range sites {
+				metrics.CheckQueueDepth.Set(float64(len(sites)))
+				for i := 0; i < len(sites); {
 					select {
 					case <-s.stopChan:
 						close(checkChan)
 						return
-					case checkChan <- site:
+					case beat := <-heartbeat.C:
+						s.lastTick.Store(beat.UnixNano())
+					case checkChan <- sites[i]:
 						// Site sent for checking
+						i++
+						metrics.CheckQueueDepth.Set(float64(len(sites) - i))
+						metrics.SchedulerLag.Set(time.Since(scheduledAt).Seconds())
 					}
 				}
 			}
@@ -129,7 +240,11 @@ func (s *Service) scheduler(interval time.Duration) {
 			return
 		default:
 			// Check the site
+			startTime := time.Now()
 			s.checkSite(site)
+			duration := time.Since(startTime)
+			s.checkBusy.Add(int64(duration))
+			metrics.CheckDuration.Observe(duration.Seconds())
 		}
 	}
 }
@@ -151,34 +266,7 @@ func (s *Service) worker() {
 
 // getAllSites gets all sites from the database
 func (s *Service) getAllSites() ([]models.Site, error) {
-	var sites []models.Site
-
-	rows, err := s.db.Pool.Query(context.Background(), `
-		SELECT id, user_id, name, url, created_at, updated_at
-		FROM sites
-	`)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var site models.Site
-		err := rows.Scan(
-			&site.ID,
-			&site.UserID,
-			&site.Name,
-			&site.URL,
-			&site.CreatedAt,
-			&site.UpdatedAt,
-		)
-		if err != nil {
-			return nil, err
-		}
-		sites = append(sites, site)
-	}
-
-	return sites, nil
+	return s.store.Sites.List(context.Background())
 }
 
 // updateSitesCache updates the sites cache
@@ -195,59 +283,98 @@ func (s *Service) updateSitesCache(sites []models.Site) {
 	}
 }
 
-// checkSite checks a site and records the result
+// checkSite checks a site and records the result, tracing the check and the
+// phases of its request
 func (s *Service) checkSite(site models.Site) {
-	// Parse the URL
-	parsedURL, err := url.Parse(site.URL)
-	if err != nil {
-		s.recordCheckResult(site.ID, 0, 0, false, fmt.Sprintf("Invalid URL: %v", err))
-		return
-	}
+	ctx, span := tracer.Start(context.Background(), "checkSite", trace.WithAttributes(
+		attribute.Int("site.id", site.ID),
+		semconv.URLFull(site.URL),
+	))
+	defer span.End()
 
-	// Ensure the URL has a scheme
-	if parsedURL.Scheme == "" {
-		parsedURL.Scheme = "http"
-	}
+	result := checker.Check(ctx, s.client, site.URL, site.TracePropagation)
 
-	// Create a new request
-	req, err := http.NewRequest(http.MethodGet, parsedURL.String(), nil)
-	if err != nil {
-		s.recordCheckResult(site.ID, 0, 0, false, fmt.Sprintf("Failed to create request: %v", err))
-		return
+	// Keep track of when the site's certificate expires
+	if result.CertExpiresAt != nil {
+		s.recordCertExpiry(site, *result.CertExpiresAt)
 	}
 
-	// Set a user agent
-	req.Header.Set("User-Agent", "IsItLive Monitoring/1.0")
+	// Record the result. The server's result is kept along with those of the
+	// probes, and the site's check is the result of the location reporting
+	// the state the locations agree on.
+	_, recordSpan := tracer.Start(ctx, "record")
+	own := models.Check{
+		SiteID:       site.ID,
+		StatusCode:   result.StatusCode,
+		ResponseTime: result.ResponseTime,
+		IsUp:         result.IsUp,
+		ErrorMessage: result.ErrorMessage,
+		CheckedAt:    time.Now(),
+		Location:     s.config.Monitoring.Location,
+	}
+	s.locationWriter.write(own)
+	s.setLocationResult(own)
+	s.recordCheckResult(site, s.consensus(site, own))
+	recordSpan.End()
+}
 
-	// Start the timer
-	startTime := time.Now()
+// recordCheckResult queues a check result to be written to the database
+func (s *Service) recordCheckResult(site models.Site, check models.Check) {
+	slog.Debug("Site checked", "site_id", site.ID, "location", check.Location, "up", check.IsUp,
+		"status_code", check.StatusCode, "response_time_ms", check.ResponseTime, "error", check.ErrorMessage)
 
-	// Send the request
-	resp, err := s.client.Do(req)
+	// Get the previous state, loading it from the database after a restart
+	previous, err := s.getSnapshot(site.ID, false, false)
 	if err != nil {
-		s.recordCheckResult(site.ID, 0, 0, false, fmt.Sprintf("Request failed: %v", err))
-		return
+		slog.Error("Error getting site state", "site_id", site.ID, "error", err)
 	}
-	defer resp.Body.Close()
 
-	// Calculate response time
-	responseTime := int(time.Since(startTime).Milliseconds())
+	s.checkWriter.write(check)
+	s.updateSnapshot(check)
+	if check.IsUp {
+		metrics.ChecksTotal.WithLabelValues("up").Inc()
+	} else {
+		metrics.ChecksTotal.WithLabelValues("down").Inc()
+	}
 
-	// Determine if the site is up (2xx or 3xx status codes)
-	isUp := resp.StatusCode >= 200 && resp.StatusCode < 400
+	// Log state transitions as events
+	if previous.status != nil && previous.status.IsUp != check.IsUp {
+		slog.Info("Site state changed",
+			"site_id", site.ID,
+			"site", site.Name,
+			"location", check.Location,
+			"state", stateName(check.IsUp),
+			"previous_state", stateName(previous.status.IsUp),
+			"previous_duration", check.CheckedAt.Sub(previous.status.Since).Round(time.Second).String(),
+			"status_code", check.StatusCode,
+			"error", check.ErrorMessage,
+		)
+	}
 
-	// Record the result
-	s.recordCheckResult(site.ID, resp.StatusCode, responseTime, isUp, "")
+	// Open or resolve incidents when the site changes state
+	if s.db != nil {
+		changed := previous.status == nil || previous.status.IsUp != check.IsUp
+		s.handleStateChange(site, check.StatusCode, check.IsUp, changed, check.ErrorMessage, check.CheckedAt)
+	}
 }
 
-// recordCheckResult records a check result in the database
-func (s *Service) recordCheckResult(siteID, statusCode, responseTime int, isUp bool, errorMessage string) {
-	_, err := s.db.Pool.Exec(context.Background(), `
-		INSERT INTO checks (site_id, status_code, response_time, is_up, error_message, checked_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
-	`, siteID, statusCode, responseTime, isUp, errorMessage, time.Now())
-	if err != nil {
-		fmt.Printf("Error recording check result: %v\n", err)
+// stateName names the up or down state of a site in logs
+func stateName(isUp bool) string {
+	if isUp {
+		return "up"
+	}
+	return "down"
+}
+
+// recordCertExpiry stores the expiry date of a site's certificate when it changes
+func (s *Service) recordCertExpiry(site models.Site, expiresAt time.Time) {
+	if site.CertExpiresAt != nil && site.CertExpiresAt.Equal(expiresAt) {
+		return
+	}
+
+	if err := s.store.Sites.SetCertExpiry(context.Background(), site.ID, expiresAt); err != nil {
+		metrics.DBErrors.WithLabelValues("set_cert_expiry").Inc()
+		slog.Error("Error recording certificate expiry", "site_id", site.ID, "error", err)
 	}
 }
 
@@ -260,134 +387,56 @@ func (s *Service) GetSiteStats(siteID int) (*models.SiteWithStats, error) {
 
 	if !ok {
 		// If not in cache, get from database
-		err := s.db.Pool.QueryRow(context.Background(), `
-			SELECT id, user_id, name, url, created_at, updated_at
-			FROM sites
-			WHERE id = $1
-		`, siteID).Scan(
-			&site.ID,
-			&site.UserID,
-			&site.Name,
-			&site.URL,
-			&site.CreatedAt,
-			&site.UpdatedAt,
-		)
+		dbSite, err := s.store.Sites.Get(context.Background(), siteID)
 		if err != nil {
 			return nil, err
 		}
+		site = *dbSite
 	}
 
-	// Get the current status (latest check)
-	var currentStatus models.Check
-	err := s.db.Pool.QueryRow(context.Background(), `
-		SELECT id, site_id, status_code, response_time, is_up, error_message, checked_at
-		FROM checks
-		WHERE site_id = $1
-		ORDER BY checked_at DESC
-		LIMIT 1
-	`, siteID).Scan(
-		&currentStatus.ID,
-		&currentStatus.SiteID,
-		&currentStatus.StatusCode,
-		&currentStatus.ResponseTime,
-		&currentStatus.IsUp,
-		&currentStatus.ErrorMessage,
-		&currentStatus.CheckedAt,
-	)
-	if err != nil {
-		// If no checks yet, return site with empty stats
-		return &models.SiteWithStats{
-			Site:           site,
-			CurrentStatus:  nil,
-			LifetimeStats:  models.UptimeStats{},
-			Last7DaysStats: models.UptimeStats{},
-			Last30DaysStats: models.UptimeStats{},
-			Last90DaysStats: models.UptimeStats{},
-		}, nil
-	}
-
-	// Get lifetime stats
-	lifetimeStats, err := s.getUptimeStats(siteID, 0)
+	// Get the precomputed status and stats
+	snapshot, err := s.getSnapshot(siteID, true, false)
 	if err != nil {
 		return nil, err
 	}
-
-	// Get 7-day stats
-	last7DaysStats, err := s.getUptimeStats(siteID, 7)
-	if err != nil {
-		return nil, err
-	}
-
-	// Get 30-day stats
-	last30DaysStats, err := s.getUptimeStats(siteID, 30)
+	slo, err := s.GetSLOStatus(site)
 	if err != nil {
 		return nil, err
 	}
-
-	// Get 90-day stats
-	last90DaysStats, err := s.getUptimeStats(siteID, 90)
-	if err != nil {
-		return nil, err
+	if snapshot.current == nil {
+		// If no checks yet, return site with empty stats
+		return &models.SiteWithStats{
+			Site:            site,
+			CurrentStatus:   nil,
+			SLO:             slo,
+			LifetimeStats:   models.UptimeStats{},
+			Last7DaysStats:  models.UptimeStats{},
+			Last30DaysStats: models.UptimeStats{},
+			Last90DaysStats: models.UptimeStats{},
+		}, nil
 	}
 
 	return &models.SiteWithStats{
-		Site:           site,
-		CurrentStatus:  &currentStatus,
-		LifetimeStats:  lifetimeStats,
-		Last7DaysStats: last7DaysStats,
-		Last30DaysStats: last30DaysStats,
-		Last90DaysStats: last90DaysStats,
+		Site:            site,
+		CurrentStatus:   snapshot.current,
+		Status:          snapshot.status,
+		LifetimeStats:   snapshot.stats[0],
+		Last7DaysStats:  snapshot.stats[1],
+		Last30DaysStats: snapshot.stats[2],
+		Last90DaysStats: snapshot.stats[3],
+		SLO:             slo,
+		Locations:       s.locationStats(siteID, snapshot.locations),
 	}, nil
 }
 
 // getUptimeStats gets the uptime statistics for a site over a period of days
 // If days is 0, get lifetime stats
 func (s *Service) getUptimeStats(siteID, days int) (models.UptimeStats, error) {
-	var stats models.UptimeStats
-	var query string
-	var args []interface{}
-
+	now := time.Now()
+	var from time.Time
 	if days > 0 {
-		query = `
-			SELECT
-				COUNT(*) AS total_checks,
-				SUM(CASE WHEN is_up THEN 1 ELSE 0 END) AS successful_checks,
-				CASE WHEN COUNT(*) > 0 THEN
-					(SUM(CASE WHEN is_up THEN 1 ELSE 0 END)::float / COUNT(*)) * 100
-				ELSE 0 END AS uptime_percentage,
-				CASE WHEN SUM(CASE WHEN is_up THEN 1 ELSE 0 END) > 0 THEN
-					SUM(CASE WHEN is_up THEN response_time ELSE 0 END) / SUM(CASE WHEN is_up THEN 1 ELSE 0 END)
-				ELSE 0 END AS average_response_time
-			FROM checks
-			WHERE site_id = $1 AND checked_at >= NOW() - INTERVAL '1 day' * $2
-		`
-		args = []interface{}{siteID, days}
-	} else {
-		query = `
-			SELECT
-				COUNT(*) AS total_checks,
-				SUM(CASE WHEN is_up THEN 1 ELSE 0 END) AS successful_checks,
-				CASE WHEN COUNT(*) > 0 THEN
-					(SUM(CASE WHEN is_up THEN 1 ELSE 0 END)::float / COUNT(*)) * 100
-				ELSE 0 END AS uptime_percentage,
-				CASE WHEN SUM(CASE WHEN is_up THEN 1 ELSE 0 END) > 0 THEN
-					SUM(CASE WHEN is_up THEN response_time ELSE 0 END) / SUM(CASE WHEN is_up THEN 1 ELSE 0 END)
-				ELSE 0 END AS average_response_time
-			FROM checks
-			WHERE site_id = $1
-		`
-		args = []interface{}{siteID}
-	}
-
-	err := s.db.Pool.QueryRow(context.Background(), query, args...).Scan(
-		&stats.TotalChecks,
-		&stats.SuccessfulChecks,
-		&stats.UptimePercentage,
-		&stats.AverageResponseTime,
-	)
-	if err != nil {
-		return models.UptimeStats{}, err
+		from = now.AddDate(0, 0, -days)
 	}
 
-	return stats, nil
+	return s.getUptimeStatsBetween(siteID, from, now)
 }
@@ -0,0 +1,232 @@
+package monitoring
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/abstractmelon/is-site-live/internal/database"
+	"github.com/abstractmelon/is-site-live/internal/metrics"
+	"github.com/abstractmelon/is-site-live/internal/models"
+	"github.com/abstractmelon/is-site-live/internal/utils"
+)
+
+// sloInterval is how often the SLO status of sites is recomputed
+const sloInterval = time.Minute
+
+// sloBurnWindow is the recent period the burn rate is measured over
+const sloBurnWindow = time.Hour
+
+// sloRollingWindow is the length of a rolling SLO window
+const sloRollingWindow = 30 * 24 * time.Hour
+
+// GetSLOStatus gets the SLO status of a site, nil if it has no SLO. Statuses
+// are kept from the last run of the SLO job, unless the SLO changed since.
+func (s *Service) GetSLOStatus(site models.Site) (*models.SLOStatus, error) {
+	if site.SLOTarget == nil {
+		return nil, nil
+	}
+
+	s.sloMu.Lock()
+	status, ok := s.sloStatuses[site.ID]
+	s.sloMu.Unlock()
+	if ok && status.Target == *site.SLOTarget && status.Window == site.SLOWindow &&
+		time.Since(status.ComputedAt) < 2*sloInterval {
+		return status, nil
+	}
+
+	status, err := s.computeSLOStatus(site, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	s.sloMu.Lock()
+	s.sloStatuses[site.ID] = status
+	s.sloMu.Unlock()
+
+	return status, nil
+}
+
+// sloJob periodically recomputes the SLO status of every site with an SLO
+// and, on PostgreSQL, sends burn rate alerts
+func (s *Service) sloJob(interval time.Duration) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case <-ticker.C:
+			// Followers compute statuses when they are requested
+			if s.isLeader() {
+				s.updateSLOs()
+			}
+		}
+	}
+}
+
+// updateSLOs recomputes the SLO status of every site with an SLO
+func (s *Service) updateSLOs() {
+	sites, err := s.getAllSites()
+	if err != nil {
+		metrics.DBErrors.WithLabelValues("get_sites").Inc()
+		slog.Error("Error getting sites for SLOs", "error", err)
+		return
+	}
+
+	now := time.Now()
+	statuses := make(map[int]*models.SLOStatus)
+	for _, site := range sites {
+		if site.SLOTarget == nil {
+			continue
+		}
+		status, err := s.computeSLOStatus(site, now)
+		if err != nil {
+			metrics.DBErrors.WithLabelValues("slo").Inc()
+			slog.Error("Error computing SLO", "site_id", site.ID, "error", err)
+			continue
+		}
+		statuses[site.ID] = status
+
+		if s.db != nil {
+			s.checkBurnRate(site, status)
+		}
+	}
+
+	// Forget the alerts of sites that no longer have an SLO
+	for siteID := range s.sloAlerting {
+		if statuses[siteID] == nil {
+			delete(s.sloAlerting, siteID)
+		}
+	}
+
+	s.sloMu.Lock()
+	s.sloStatuses = statuses
+	s.sloMu.Unlock()
+}
+
+// computeSLOStatus computes how a site is doing against its SLO. Calendar
+// months are in the timezone of the site's owner.
+func (s *Service) computeSLOStatus(site models.Site, now time.Time) (*models.SLOStatus, error) {
+	target := *site.SLOTarget
+	allowed := 1 - target/100
+
+	// Find the window and how far ahead a breach is worth projecting
+	start, end, horizon := now.Add(-sloRollingWindow), now, now.Add(sloRollingWindow)
+	if site.SLOWindow == models.SLOWindowCalendarMonth {
+		local := now.In(s.ownerLocation(site.UserID))
+		start = time.Date(local.Year(), local.Month(), 1, 0, 0, 0, 0, local.Location())
+		end = start.AddDate(0, 1, 0)
+		horizon = end
+	}
+
+	stats, err := s.getUptimeStatsBetween(site.ID, start, minTime(end, now))
+	if err != nil {
+		return nil, err
+	}
+	recent, err := s.getUptimeStatsBetween(site.ID, now.Add(-sloBurnWindow), now)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &models.SLOStatus{
+		Target:       target,
+		Window:       site.SLOWindow,
+		WindowStart:  start,
+		WindowEnd:    end,
+		TotalChecks:  stats.TotalChecks,
+		FailedChecks: stats.TotalChecks - stats.SuccessfulChecks,
+		ComputedAt:   now,
+	}
+	if stats.TotalChecks > 0 {
+		uptime := stats.UptimePercentage
+		status.UptimePercentage = &uptime
+	}
+
+	budget := end.Sub(start).Seconds() * allowed
+	used := float64(stats.DownSeconds)
+	status.ErrorBudget = math.Round(budget)
+	status.ErrorBudgetUsed = math.Round(used)
+	status.ErrorBudgetRemaining = math.Round((budget-used)/budget*10000) / 100
+	status.Breached = used >= budget
+
+	if known := recent.UpSeconds + recent.DownSeconds; known > 0 {
+		errorRate := float64(recent.DownSeconds) / float64(known)
+		status.BurnRate = math.Round(errorRate/allowed*100) / 100
+	}
+
+	// At a burn rate of 1 the whole budget lasts exactly the window
+	if !status.Breached && status.BurnRate > 0 {
+		left := (budget - used) / (status.BurnRate * allowed)
+		if left < horizon.Sub(now).Seconds() {
+			breachAt := now.Add(time.Duration(left * float64(time.Second)))
+			status.ProjectedBreachAt = &breachAt
+		}
+	}
+
+	return status, nil
+}
+
+// checkBurnRate alerts when the burn rate of a site reaches its alert
+// threshold. The alert is only sent again once the burn rate dropped below
+// the threshold in between.
+func (s *Service) checkBurnRate(site models.Site, status *models.SLOStatus) {
+	alerting := site.SLOBurnRateAlert != nil && status.BurnRate >= *site.SLOBurnRateAlert
+	wasAlerting := s.sloAlerting[site.ID]
+	if !alerting {
+		delete(s.sloAlerting, site.ID)
+		return
+	}
+	s.sloAlerting[site.ID] = true
+	if wasAlerting {
+		return
+	}
+
+	if err := s.notifyErrorBudget(site, status); err != nil {
+		slog.Error("Error sending error budget alert", "site_id", site.ID, "error", err)
+	}
+}
+
+// notifyErrorBudget tells the site owner, and whoever the site's escalation
+// policy pages first, that the site is burning through its error budget
+func (s *Service) notifyErrorBudget(site models.Site, status *models.SLOStatus) error {
+	return s.withTx(func(q database.Querier) error {
+		for _, userID := range s.alertRecipients(site) {
+			err := s.queueAlert(q, userID, utils.TemplateErrorBudget, func(username string) interface{} {
+				return utils.ErrorBudgetData{
+					Username:          username,
+					SiteName:          site.Name,
+					SiteURL:           site.URL,
+					Target:            status.Target,
+					Window:            status.Window,
+					BurnRate:          status.BurnRate,
+					Threshold:         *site.SLOBurnRateAlert,
+					Remaining:         status.ErrorBudgetRemaining,
+					ProjectedBreachAt: status.ProjectedBreachAt,
+				}
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// ownerLocation gets the timezone of a user, UTC if it can't be loaded
+func (s *Service) ownerLocation(userID int) *time.Location {
+	user, err := s.store.Users.Get(context.Background(), userID)
+	if err != nil {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(user.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
@@ -0,0 +1,294 @@
+package monitoring
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/abstractmelon/is-site-live/internal/models"
+	"github.com/abstractmelon/is-site-live/internal/storage"
+)
+
+// snapshotRefreshInterval is how long the uptime windows and daily uptime of
+// a site snapshot are served before being recomputed. In between, the
+// windows are updated with every check and checks leaving a window are
+// removed as they age out, but the response time percentiles and the
+// per-location stats are only accounted for on refresh.
+const snapshotRefreshInterval = 5 * time.Minute
+
+// statsWindows are the days covered by the uptime windows of a snapshot, 0
+// being the site's lifetime
+var statsWindows = [...]int{0, 7, 30, 90}
+
+// siteSnapshot is the precomputed status of a site, so stats pages and status
+// pages listing many sites don't query the checks on every request. Parts
+// are loaded when first needed. The pointers are replaced, never modified,
+// so copies of a snapshot are safe to read.
+type siteSnapshot struct {
+	status   *models.SiteStatus // nil if the site has no checks
+	current  *models.Check
+	loadedAt time.Time // when the status was loaded, as followers don't update it
+
+	stats     [len(statsWindows)]models.UptimeStats
+	leaving   [len(statsWindows)][]models.Check // checks leaving each window before the next refresh, oldest first
+	locations []models.LocationStats            // loaded along with the stats
+	statsAt   time.Time                         // when the stats were computed, zero if not loaded
+
+	daily   []models.DailyUptime
+	dailyAt time.Time // when the daily uptime was computed, zero if not loaded
+}
+
+// GetSiteSummary gets the current status of a site and, on PostgreSQL, its
+// daily uptime bars for status pages
+func (s *Service) GetSiteSummary(site models.Site) (models.SiteWithDailyUptime, error) {
+	snapshot, err := s.getSnapshot(site.ID, false, s.db != nil)
+	if err != nil {
+		return models.SiteWithDailyUptime{}, err
+	}
+	return models.SiteWithDailyUptime{
+		Site:        site,
+		Status:      snapshot.status,
+		DailyUptime: snapshot.daily,
+	}, nil
+}
+
+// getSnapshot gets the snapshot of a site, loading the parts that are
+// missing or stale. Instances that don't check the sites reload the status
+// after a check interval.
+func (s *Service) getSnapshot(siteID int, withStats, withDaily bool) (siteSnapshot, error) {
+	s.snapshotsMu.Lock()
+	snapshot, ok := s.snapshots[siteID]
+	if ok && (s.isLeader() || time.Since(snapshot.loadedAt) < s.checkInterval) &&
+		(!withStats || time.Since(snapshot.statsAt) < snapshotRefreshInterval) &&
+		(!withDaily || time.Since(snapshot.dailyAt) < snapshotRefreshInterval) {
+		snapshot.expireStats(time.Now())
+		result := *snapshot
+		s.snapshotsMu.Unlock()
+		return result, nil
+	}
+	s.snapshotsMu.Unlock()
+
+	// Query outside the lock so checks can still be recorded meanwhile
+	loaded, err := s.loadSnapshot(siteID, withStats, withDaily)
+	if err != nil {
+		return siteSnapshot{}, err
+	}
+
+	s.snapshotsMu.Lock()
+	defer s.snapshotsMu.Unlock()
+
+	// Keep what changed or was loaded since
+	if existing, ok := s.snapshots[siteID]; ok {
+		if existing.current != nil && (loaded.current == nil || existing.current.CheckedAt.After(loaded.current.CheckedAt)) {
+			loaded.status, loaded.current = existing.status, existing.current
+		}
+		if loaded.statsAt.IsZero() {
+			loaded.stats, loaded.leaving, loaded.locations, loaded.statsAt = existing.stats, existing.leaving, existing.locations, existing.statsAt
+		}
+		if loaded.dailyAt.IsZero() {
+			loaded.daily, loaded.dailyAt = existing.daily, existing.dailyAt
+		}
+	}
+	s.snapshots[siteID] = loaded
+
+	return *loaded, nil
+}
+
+// loadSnapshot computes the snapshot of a site from the database
+func (s *Service) loadSnapshot(siteID int, withStats, withDaily bool) (*siteSnapshot, error) {
+	snapshot := &siteSnapshot{loadedAt: time.Now()}
+
+	current, err := s.store.Checks.Latest(context.Background(), siteID)
+	if errors.Is(err, storage.ErrNotFound) {
+		// Not checked yet
+		return snapshot, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	since, err := s.store.Checks.StateSince(context.Background(), siteID, current.IsUp)
+	if err != nil {
+		return nil, err
+	}
+	snapshot.current = current
+	snapshot.status = newSiteStatus(*current, since)
+
+	if withStats {
+		for i, days := range statsWindows {
+			snapshot.stats[i], err = s.getUptimeStats(siteID, days)
+			if err != nil {
+				return nil, err
+			}
+			if days == 0 {
+				continue
+			}
+			from := time.Now().AddDate(0, 0, -days)
+			err = s.store.Checks.Stream(context.Background(), siteID, from, from.Add(snapshotRefreshInterval), func(check models.Check) error {
+				snapshot.leaving[i] = append(snapshot.leaving[i], check)
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		snapshot.locations, err = s.store.Checks.LocationStats(context.Background(), siteID,
+			time.Now().AddDate(0, 0, -locationStatsDays))
+		if err != nil {
+			return nil, err
+		}
+		snapshot.statsAt = time.Now()
+	}
+
+	if withDaily {
+		dailyUptime, err := s.GetDailyUptime(siteID, DailyUptimeDays)
+		if err != nil {
+			return nil, err
+		}
+		snapshot.daily = dailyUptime.Days
+		snapshot.dailyAt = time.Now()
+	}
+
+	return snapshot, nil
+}
+
+// cachedSnapshot gets the snapshot of a site if it is in memory, without
+// loading or refreshing anything
+func (s *Service) cachedSnapshot(siteID int) (siteSnapshot, bool) {
+	s.snapshotsMu.Lock()
+	defer s.snapshotsMu.Unlock()
+
+	snapshot, ok := s.snapshots[siteID]
+	if !ok {
+		return siteSnapshot{}, false
+	}
+	snapshot.expireStats(time.Now())
+	return *snapshot, true
+}
+
+// updateSnapshot applies a new check to the snapshot of its site, if the
+// site has one
+func (s *Service) updateSnapshot(check models.Check) {
+	s.snapshotsMu.Lock()
+	defer s.snapshotsMu.Unlock()
+
+	snapshot, ok := s.snapshots[check.SiteID]
+	if !ok {
+		return
+	}
+
+	since := check.CheckedAt
+	if snapshot.status != nil && snapshot.status.IsUp == check.IsUp {
+		since = snapshot.status.Since
+	}
+	snapshot.status = newSiteStatus(check, since)
+	snapshot.current = &check
+
+	if !snapshot.statsAt.IsZero() {
+		for i := range snapshot.stats {
+			addCheckToStats(&snapshot.stats[i], check)
+		}
+	}
+}
+
+// expireStats removes the checks that left the uptime windows since the
+// stats were computed
+func (snapshot *siteSnapshot) expireStats(now time.Time) {
+	for i, days := range statsWindows {
+		if days == 0 {
+			continue
+		}
+		from := now.AddDate(0, 0, -days)
+		expired := 0
+		for _, check := range snapshot.leaving[i] {
+			if !check.CheckedAt.Before(from) {
+				break
+			}
+			removeCheckFromStats(&snapshot.stats[i], check)
+			expired++
+		}
+		snapshot.leaving[i] = snapshot.leaving[i][expired:]
+	}
+}
+
+// resetSnapshots drops every snapshot, so they are loaded again when next
+// needed
+func (s *Service) resetSnapshots() {
+	s.snapshotsMu.Lock()
+	defer s.snapshotsMu.Unlock()
+
+	s.snapshots = make(map[int]*siteSnapshot)
+}
+
+// pruneSnapshots drops the snapshots of sites that no longer exist
+func (s *Service) pruneSnapshots(sites []models.Site) {
+	exists := make(map[int]bool, len(sites))
+	for _, site := range sites {
+		exists[site.ID] = true
+	}
+
+	s.snapshotsMu.Lock()
+	defer s.snapshotsMu.Unlock()
+
+	for siteID := range s.snapshots {
+		if !exists[siteID] {
+			delete(s.snapshots, siteID)
+		}
+	}
+}
+
+// newSiteStatus creates the status of a site from its latest check
+func newSiteStatus(check models.Check, since time.Time) *models.SiteStatus {
+	return &models.SiteStatus{
+		IsUp:             check.IsUp,
+		Since:            since,
+		LastCheckedAt:    check.CheckedAt,
+		LastStatusCode:   check.StatusCode,
+		LastResponseTime: check.ResponseTime,
+	}
+}
+
+// addCheckToStats counts a check in uptime stats. The percentiles, standard
+// deviation and time-weighted uptime are left as they are.
+func addCheckToStats(stats *models.UptimeStats, check models.Check) {
+	stats.TotalChecks++
+	if check.IsUp {
+		if stats.SuccessfulChecks == 0 || check.ResponseTime < stats.MinResponseTime {
+			stats.MinResponseTime = check.ResponseTime
+		}
+		if stats.SuccessfulChecks == 0 || check.ResponseTime > stats.MaxResponseTime {
+			stats.MaxResponseTime = check.ResponseTime
+		}
+		stats.ResponseTimeSum += int64(check.ResponseTime)
+		stats.SuccessfulChecks++
+	}
+	stats.UptimePercentage = float64(stats.SuccessfulChecks) / float64(stats.TotalChecks) * 100
+	setAverageResponseTime(stats)
+}
+
+// removeCheckFromStats takes a check that left the period out of uptime
+// stats. The minimum and maximum response times are left as they are.
+func removeCheckFromStats(stats *models.UptimeStats, check models.Check) {
+	if stats.TotalChecks == 0 {
+		return
+	}
+	stats.TotalChecks--
+	if check.IsUp && stats.SuccessfulChecks > 0 {
+		stats.ResponseTimeSum = max(0, stats.ResponseTimeSum-int64(check.ResponseTime))
+		stats.SuccessfulChecks--
+	}
+	setAverageResponseTime(stats)
+	stats.UptimePercentage = 0
+	if stats.TotalChecks > 0 {
+		stats.UptimePercentage = float64(stats.SuccessfulChecks) / float64(stats.TotalChecks) * 100
+	}
+}
+
+// setAverageResponseTime derives the average response time from the sum of
+// the response times, which unlike an updated average doesn't drift with
+// rounding as checks come and go
+func setAverageResponseTime(stats *models.UptimeStats) {
+	stats.AverageResponseTime = 0
+	if stats.SuccessfulChecks > 0 {
+		stats.AverageResponseTime = int(stats.ResponseTimeSum / int64(stats.SuccessfulChecks))
+	}
+}
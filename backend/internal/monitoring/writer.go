@@ -0,0 +1,181 @@
+package monitoring
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/abstractmelon/is-site-live/internal/metrics"
+	"github.com/abstractmelon/is-site-live/internal/models"
+)
+
+// Check writer limits
+const (
+	checkBatchSize     = 500              // checks written at once
+	checkFlushInterval = time.Second      // longest a check waits to be written
+	checkWriteTimeout  = 30 * time.Second // timeout of a single batch write
+	checkWriteRetries  = 3                // retries of a failed batch
+	checkRetryBackoff  = time.Second      // wait before the first retry, doubled each time
+
+	// checkRowFailures is how many checks in a row may fail when writing a
+	// batch one check at a time before the rest is given up on, as the
+	// database is then most likely unreachable
+	checkRowFailures = 3
+)
+
+// checkWriter buffers check results and writes them in batches, so a busy
+// worker pool doesn't make one round trip per check
+type checkWriter struct {
+	insert    func(ctx context.Context, checks []models.Check) error
+	operation string // names the writer in logs and metrics
+	input     chan models.Check
+	done      chan struct{}
+
+	mu      sync.Mutex
+	pending map[int][]models.Check // checks not written yet, by site
+}
+
+// newCheckWriter creates a check writer storing batches with insert, which
+// must be started with run
+func newCheckWriter(insert func(ctx context.Context, checks []models.Check) error, operation string) *checkWriter {
+	return &checkWriter{
+		insert:    insert,
+		operation: operation,
+		input:     make(chan models.Check, 2*checkBatchSize),
+		done:      make(chan struct{}),
+		pending:   make(map[int][]models.Check),
+	}
+}
+
+// write queues a check. It blocks while the buffer is full, slowing the
+// checks down to the rate the database keeps up with.
+func (w *checkWriter) write(check models.Check) {
+	w.mu.Lock()
+	w.pending[check.SiteID] = append(w.pending[check.SiteID], check)
+	w.mu.Unlock()
+
+	w.input <- check
+}
+
+// buffered returns the checks of a site before a given time that are queued
+// or being written. A check stays buffered until its batch is written or
+// given up on, so reading the buffered checks before the database finds a
+// check twice rather than not at all.
+func (w *checkWriter) buffered(siteID int, before time.Time) []models.Check {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var checks []models.Check
+	for _, check := range w.pending[siteID] {
+		if check.CheckedAt.Before(before) {
+			checks = append(checks, check)
+		}
+	}
+	return checks
+}
+
+// written removes the checks of a batch from the buffered checks
+func (w *checkWriter) written(batch []models.Check) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, check := range batch {
+		pending := w.pending[check.SiteID]
+		for i := range pending {
+			if pending[i].CheckedAt.Equal(check.CheckedAt) {
+				pending = append(pending[:i], pending[i+1:]...)
+				break
+			}
+		}
+		if len(pending) == 0 {
+			delete(w.pending, check.SiteID)
+		} else {
+			w.pending[check.SiteID] = pending
+		}
+	}
+}
+
+// close writes the queued checks and stops the writer. Nothing may be
+// written afterwards.
+func (w *checkWriter) close() {
+	close(w.input)
+	<-w.done
+}
+
+// run writes the queued checks whenever a batch is full or the flush
+// interval has passed, until the writer is closed
+func (w *checkWriter) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(checkFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]models.Check, 0, checkBatchSize)
+	for {
+		select {
+		case check, ok := <-w.input:
+			if !ok {
+				w.flush(batch)
+				return
+			}
+			batch = append(batch, check)
+			if len(batch) >= checkBatchSize {
+				w.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			w.flush(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+// flush writes a batch of checks. A failed batch is retried with backoff,
+// then written one check at a time, so a single check the database rejects,
+// such as one of a site deleted meanwhile, doesn't lose the whole batch.
+func (w *checkWriter) flush(batch []models.Check) {
+	if len(batch) == 0 {
+		return
+	}
+	defer w.written(batch)
+
+	backoff := checkRetryBackoff
+	err := w.insertBatch(batch)
+	for retry := 0; err != nil && retry < checkWriteRetries; retry++ {
+		slog.Warn("Error recording check results, retrying", "operation", w.operation, "count", len(batch), "backoff", backoff, "error", err)
+		time.Sleep(backoff)
+		backoff *= 2
+		err = w.insertBatch(batch)
+	}
+	if err == nil {
+		return
+	}
+
+	slog.Warn("Error recording check results, writing them one by one", "operation", w.operation, "count", len(batch), "error", err)
+	failures, dropped := 0, 0
+	for i, check := range batch {
+		if err := w.insertBatch([]models.Check{check}); err != nil {
+			metrics.DBErrors.WithLabelValues(w.operation).Inc()
+			slog.Error("Error recording check result", "operation", w.operation, "site_id", check.SiteID, "error", err)
+			dropped++
+			if failures++; failures >= checkRowFailures {
+				dropped += len(batch) - i - 1
+				break
+			}
+			continue
+		}
+		failures = 0
+	}
+	if dropped > 0 {
+		slog.Error("Dropped check results", "operation", w.operation, "count", dropped, "of", len(batch))
+	}
+}
+
+// insertBatch writes checks within the write timeout
+func (w *checkWriter) insertBatch(checks []models.Check) error {
+	ctx, cancel := context.WithTimeout(context.Background(), checkWriteTimeout)
+	defer cancel()
+
+	return w.insert(ctx, checks)
+}
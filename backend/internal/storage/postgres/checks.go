@@ -0,0 +1,341 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/abstractmelon/is-site-live/internal/database"
+	"github.com/abstractmelon/is-site-live/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+type checkRepository struct {
+	db     *database.DB
+	maxGap time.Duration
+}
+
+// InsertBatch copies the checks in with a single COPY
+func (r *checkRepository) InsertBatch(ctx context.Context, checks []models.Check) error {
+	_, err := r.db.Pool.CopyFrom(ctx,
+		pgx.Identifier{"checks"},
+		[]string{"site_id", "status_code", "response_time", "is_up", "error_message", "checked_at", "location"},
+		pgx.CopyFromSlice(len(checks), func(i int) ([]any, error) {
+			check := checks[i]
+			return []any{check.SiteID, check.StatusCode, check.ResponseTime, check.IsUp, check.ErrorMessage, check.CheckedAt, check.Location}, nil
+		}),
+	)
+	return err
+}
+
+func (r *checkRepository) Latest(ctx context.Context, siteID int) (*models.Check, error) {
+	var check models.Check
+	err := r.db.Pool.QueryRow(ctx, `
+		SELECT id, site_id, COALESCE(status_code, 0), COALESCE(response_time, 0), is_up,
+			COALESCE(error_message, ''), checked_at, location
+		FROM checks
+		WHERE site_id = $1
+		ORDER BY checked_at DESC
+		LIMIT 1
+	`, siteID).Scan(
+		&check.ID,
+		&check.SiteID,
+		&check.StatusCode,
+		&check.ResponseTime,
+		&check.IsUp,
+		&check.ErrorMessage,
+		&check.CheckedAt,
+		&check.Location,
+	)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	return &check, nil
+}
+
+func (r *checkRepository) StateSince(ctx context.Context, siteID int, isUp bool) (time.Time, error) {
+	var since time.Time
+	err := r.db.Pool.QueryRow(ctx, `
+		SELECT checked_at
+		FROM checks
+		WHERE site_id = $1 AND checked_at > COALESCE(
+			(SELECT checked_at FROM checks WHERE site_id = $1 AND is_up <> $2 ORDER BY checked_at DESC LIMIT 1),
+			'-infinity'
+		)
+		ORDER BY checked_at
+		LIMIT 1
+	`, siteID, isUp).Scan(&since)
+	if err != nil {
+		return time.Time{}, mapError(err)
+	}
+	return since, nil
+}
+
+// checkStreamBatchSize is the number of checks fetched from the cursor at
+// once by Stream
+const checkStreamBatchSize = 1000
+
+// Stream fetches the checks in batches from a cursor in a read-only
+// transaction, so the result is never held in memory in full
+func (r *checkRepository) Stream(ctx context.Context, siteID int, from, to time.Time, fn func(models.Check) error) error {
+	tx, err := r.db.Pool.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	_, err = tx.Exec(ctx, `
+		DECLARE check_stream NO SCROLL CURSOR FOR
+		SELECT id, site_id, COALESCE(status_code, 0), COALESCE(response_time, 0), is_up,
+			COALESCE(error_message, ''), checked_at, location
+		FROM checks
+		WHERE site_id = $1 AND checked_at >= $2 AND checked_at < $3
+		ORDER BY checked_at, id
+	`, siteID, from, to)
+	if err != nil {
+		return err
+	}
+
+	fetch := fmt.Sprintf("FETCH %d FROM check_stream", checkStreamBatchSize)
+	for {
+		rows, err := tx.Query(ctx, fetch)
+		if err != nil {
+			return err
+		}
+		checks, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.Check, error) {
+			var check models.Check
+			err := row.Scan(
+				&check.ID,
+				&check.SiteID,
+				&check.StatusCode,
+				&check.ResponseTime,
+				&check.IsUp,
+				&check.ErrorMessage,
+				&check.CheckedAt,
+				&check.Location,
+			)
+			return check, err
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, check := range checks {
+			if err := fn(check); err != nil {
+				return err
+			}
+		}
+		if len(checks) < checkStreamBatchSize {
+			return nil
+		}
+	}
+}
+
+// UptimeStats reads whole hours and days from the check rollups. The period
+// before the site was created doesn't count as having no data.
+func (r *checkRepository) UptimeStats(ctx context.Context, siteID int, from, to time.Time) (models.UptimeStats, error) {
+	to = minTime(to, time.Now())
+	query, args := CheckBucketsQuery(siteID, from, to, r.maxGap)
+
+	var stats models.UptimeStats
+	var totalChecks, successfulChecks, responseTimeSum, histogramChecks int64
+	var histogramSum, histogramSqSum, upSeconds, downSeconds float64
+	var minResponseTime, maxResponseTime *int
+	var histogram []int64
+	var createdAt *time.Time
+	err := r.db.Pool.QueryRow(ctx, `
+		WITH buckets AS (`+query+`)
+		SELECT
+			COALESCE(SUM(total_checks), 0),
+			COALESCE(SUM(successful_checks), 0),
+			COALESCE(SUM(response_time_sum), 0),
+			MIN(min_response_time),
+			MAX(max_response_time),
+			COALESCE(SUM(successful_checks) FILTER (WHERE latency_histogram IS NOT NULL), 0),
+			COALESCE(SUM(response_time_sum) FILTER (WHERE latency_histogram IS NOT NULL), 0),
+			COALESCE(SUM(response_time_sq_sum) FILTER (WHERE latency_histogram IS NOT NULL), 0),
+			(`+HistogramQuery+`),
+			COALESCE(SUM(up_seconds), 0),
+			COALESCE(SUM(down_seconds), 0),
+			(SELECT created_at FROM sites WHERE id = @siteID)
+		FROM buckets
+	`, args).Scan(
+		&totalChecks,
+		&successfulChecks,
+		&responseTimeSum,
+		&minResponseTime,
+		&maxResponseTime,
+		&histogramChecks,
+		&histogramSum,
+		&histogramSqSum,
+		&histogram,
+		&upSeconds,
+		&downSeconds,
+		&createdAt,
+	)
+	if err != nil {
+		return models.UptimeStats{}, mapError(err)
+	}
+
+	stats.TotalChecks = int(totalChecks)
+	stats.SuccessfulChecks = int(successfulChecks)
+	stats.ResponseTimeSum = responseTimeSum
+	if totalChecks > 0 {
+		stats.UptimePercentage = float64(successfulChecks) / float64(totalChecks) * 100
+	}
+	if successfulChecks > 0 {
+		stats.AverageResponseTime = int(responseTimeSum / successfulChecks)
+	}
+	if minResponseTime != nil && maxResponseTime != nil {
+		stats.MinResponseTime = *minResponseTime
+		stats.MaxResponseTime = *maxResponseTime
+		stats.P50ResponseTime = models.EstimatePercentile(histogram, 50, *minResponseTime, *maxResponseTime)
+		stats.P90ResponseTime = models.EstimatePercentile(histogram, 90, *minResponseTime, *maxResponseTime)
+		stats.P95ResponseTime = models.EstimatePercentile(histogram, 95, *minResponseTime, *maxResponseTime)
+		stats.P99ResponseTime = models.EstimatePercentile(histogram, 99, *minResponseTime, *maxResponseTime)
+	}
+	if histogramChecks > 0 {
+		// Population standard deviation from the sum and sum of squares
+		mean := histogramSum / float64(histogramChecks)
+		variance := histogramSqSum/float64(histogramChecks) - mean*mean
+		stats.ResponseTimeStdDev = math.Round(math.Sqrt(math.Max(variance, 0))*100) / 100
+	}
+	if createdAt != nil && createdAt.After(from) {
+		from = *createdAt
+	}
+	stats.SetDurations(seconds(upSeconds), seconds(downSeconds), to.Sub(from))
+
+	return stats, nil
+}
+
+// seconds converts a number of seconds to a duration
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// LatencyHistogramSQL builds an array expression with one element per
+// latency histogram bucket. Each element is element formatted with the
+// condition matching successful checks in that bucket.
+func LatencyHistogramSQL(element string) string {
+	elements := make([]string, 0, len(models.LatencyBucketBounds)+1)
+	lower := 0
+	for _, upper := range models.LatencyBucketBounds {
+		condition := fmt.Sprintf("is_up AND response_time >= %d AND response_time < %d", lower, upper)
+		elements = append(elements, fmt.Sprintf(element, condition))
+		lower = upper
+	}
+	elements = append(elements, fmt.Sprintf(element, fmt.Sprintf("is_up AND response_time >= %d", lower)))
+
+	return "ARRAY[" + strings.Join(elements, ", ") + "]::bigint[]"
+}
+
+// HistogramQuery sums the latency histograms of the buckets element-wise
+const HistogramQuery = `
+	SELECT COALESCE(array_agg(count ORDER BY position), '{}')
+	FROM (
+		SELECT h.position, SUM(h.count)::bigint AS count
+		FROM buckets, unnest(buckets.latency_histogram) WITH ORDINALITY AS h(count, position)
+		GROUP BY h.position
+	) AS histogram
+`
+
+// CheckBucketsQuery builds a query returning the summarised checks of a site
+// between two times. Whole days and hours are read from the rollups; only the
+// edges and the last hour or two, which may not be summarised yet, come from
+// raw checks, each raw check forming its own bucket. Like in the rollups, a
+// raw check covers the time until the next check, at most maxGap, but not
+// past the end of the period.
+func CheckBucketsQuery(siteID int, from, to time.Time, maxGap time.Duration) (string, pgx.NamedArgs) {
+	// The rollups are trusted up to the start of the previous hour, as the
+	// rollup job may not have run since the current hour began
+	hourTo := minTime(time.Now().Truncate(time.Hour).Add(-time.Hour), to.Truncate(time.Hour))
+	hourFrom := ceilTime(from, time.Hour)
+
+	var args pgx.NamedArgs
+	if !hourFrom.Before(hourTo) {
+		// Too short to use the rollups
+		args = pgx.NamedArgs{
+			"rawFrom": from, "rawTo": to,
+			"rawFrom2": to, "rawTo2": to,
+			"dayFrom": to, "dayTo": to,
+			"hourFrom": to, "hourTo": to,
+			"hourFrom2": to, "hourTo2": to,
+		}
+	} else {
+		dayFrom := ceilTime(hourFrom, 24*time.Hour)
+		dayTo := hourTo.Truncate(24 * time.Hour)
+		if !dayFrom.Before(dayTo) {
+			dayFrom, dayTo = hourTo, hourTo
+		}
+		args = pgx.NamedArgs{
+			"rawFrom": from, "rawTo": hourFrom,
+			"rawFrom2": hourTo, "rawTo2": to,
+			"dayFrom": dayFrom, "dayTo": dayTo,
+			"hourFrom": hourFrom, "hourTo": dayFrom,
+			"hourFrom2": dayTo, "hourTo2": hourTo,
+		}
+	}
+	args["siteID"] = siteID
+	args["maxGap"] = maxGap.Seconds()
+	args["coverTo"] = minTime(to, time.Now())
+
+	const rollupColumns = `total_checks, successful_checks, response_time_sum, response_time_sq_sum,
+		min_response_time, max_response_time, latency_histogram, up_seconds, down_seconds`
+	query := `
+		SELECT ` + rollupColumns + `
+		FROM check_rollups_daily
+		WHERE site_id = @siteID AND bucket >= @dayFrom AND bucket < @dayTo
+		UNION ALL
+		SELECT ` + rollupColumns + `
+		FROM check_rollups_hourly
+		WHERE site_id = @siteID AND (
+			(bucket >= @hourFrom AND bucket < @hourTo) OR
+			(bucket >= @hourFrom2 AND bucket < @hourTo2)
+		)
+		UNION ALL
+		SELECT
+			1,
+			CASE WHEN is_up THEN 1 ELSE 0 END,
+			CASE WHEN is_up THEN response_time ELSE 0 END,
+			CASE WHEN is_up THEN response_time::float8 * response_time ELSE 0 END,
+			CASE WHEN is_up THEN response_time END,
+			CASE WHEN is_up THEN response_time END,
+			` + LatencyHistogramSQL("CASE WHEN %s THEN 1 ELSE 0 END") + `,
+			CASE WHEN is_up THEN covered ELSE 0 END,
+			CASE WHEN is_up THEN 0 ELSE covered END
+		FROM (
+			SELECT c.response_time, c.is_up,
+				GREATEST(EXTRACT(EPOCH FROM LEAST(
+					(SELECT MIN(n.checked_at) FROM checks n WHERE n.site_id = c.site_id AND n.checked_at > c.checked_at),
+					c.checked_at + make_interval(secs => @maxGap),
+					@coverTo::timestamptz
+				) - c.checked_at), 0) AS covered
+			FROM checks c
+			WHERE c.site_id = @siteID AND (
+				(c.checked_at >= @rawFrom AND c.checked_at < @rawTo) OR
+				(c.checked_at >= @rawFrom2 AND c.checked_at < @rawTo2)
+			)
+		) AS checks
+	`
+
+	return query, args
+}
+
+// ceilTime rounds a time up to a multiple of d
+func ceilTime(t time.Time, d time.Duration) time.Time {
+	truncated := t.Truncate(d)
+	if truncated.Before(t) {
+		return truncated.Add(d)
+	}
+	return truncated
+}
+
+// minTime returns the earlier of two times
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,94 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/abstractmelon/is-site-live/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// InsertLocationBatch copies the results in with a single COPY
+func (r *checkRepository) InsertLocationBatch(ctx context.Context, checks []models.Check) error {
+	_, err := r.db.Pool.CopyFrom(ctx,
+		pgx.Identifier{"location_checks"},
+		[]string{"site_id", "location", "status_code", "response_time", "is_up", "error_message", "checked_at"},
+		pgx.CopyFromSlice(len(checks), func(i int) ([]any, error) {
+			check := checks[i]
+			return []any{check.SiteID, check.Location, check.StatusCode, check.ResponseTime, check.IsUp, check.ErrorMessage, check.CheckedAt}, nil
+		}),
+	)
+	return err
+}
+
+func (r *checkRepository) LatestByLocation(ctx context.Context, since time.Time) (map[int][]models.Check, error) {
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT DISTINCT ON (site_id, location)
+			id, site_id, status_code, response_time, is_up, error_message, checked_at, location
+		FROM location_checks
+		WHERE checked_at >= $1
+		ORDER BY site_id, location, checked_at DESC, id DESC
+	`, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	latest := make(map[int][]models.Check)
+	for rows.Next() {
+		var check models.Check
+		err := rows.Scan(
+			&check.ID,
+			&check.SiteID,
+			&check.StatusCode,
+			&check.ResponseTime,
+			&check.IsUp,
+			&check.ErrorMessage,
+			&check.CheckedAt,
+			&check.Location,
+		)
+		if err != nil {
+			return nil, err
+		}
+		latest[check.SiteID] = append(latest[check.SiteID], check)
+	}
+	return latest, rows.Err()
+}
+
+func (r *checkRepository) LocationStats(ctx context.Context, siteID int, from time.Time) ([]models.LocationStats, error) {
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT location, COUNT(*), COUNT(*) FILTER (WHERE is_up),
+			COALESCE(AVG(response_time) FILTER (WHERE is_up), 0),
+			COALESCE(MIN(response_time) FILTER (WHERE is_up), 0),
+			COALESCE(MAX(response_time) FILTER (WHERE is_up), 0)
+		FROM location_checks
+		WHERE site_id = $1 AND checked_at >= $2
+		GROUP BY location
+		ORDER BY location
+	`, siteID, from)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	locations := []models.LocationStats{}
+	for rows.Next() {
+		var stats models.LocationStats
+		var averageResponseTime float64
+		err := rows.Scan(
+			&stats.Location,
+			&stats.TotalChecks,
+			&stats.SuccessfulChecks,
+			&averageResponseTime,
+			&stats.MinResponseTime,
+			&stats.MaxResponseTime,
+		)
+		if err != nil {
+			return nil, err
+		}
+		stats.AverageResponseTime = int(averageResponseTime)
+		stats.UptimePercentage = float64(stats.SuccessfulChecks) / float64(stats.TotalChecks) * 100
+		locations = append(locations, stats)
+	}
+	return locations, rows.Err()
+}
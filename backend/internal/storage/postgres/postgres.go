@@ -0,0 +1,66 @@
+// Package postgres implements the storage repositories on PostgreSQL
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/abstractmelon/is-site-live/internal/database"
+	"github.com/abstractmelon/is-site-live/internal/storage"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// New creates a store backed by a PostgreSQL database. The schema is managed
+// by the database migrations. maxCheckGap is how long a check's result holds
+// for time-weighted uptime, see config.MonitoringConfig.MaxCheckGap.
+func New(db *database.DB, maxCheckGap time.Duration) *storage.Store {
+	return &storage.Store{
+		Driver:  storage.DriverPostgres,
+		Users:   &userRepository{db: db.Pool},
+		Sites:   &siteRepository{db: db.Pool},
+		Checks:  &checkRepository{db: db, maxGap: maxCheckGap},
+		Domains: &domainRepository{db: db.Pool},
+		Probes:  &probeRepository{db: db},
+		InTx: func(ctx context.Context, fn func(tx storage.Tx) error) error {
+			tx, err := db.Pool.Begin(ctx)
+			if err != nil {
+				return err
+			}
+			defer tx.Rollback(context.Background())
+
+			err = fn(storage.Tx{
+				Users:   &userRepository{db: tx},
+				Sites:   &siteRepository{db: tx},
+				Domains: &domainRepository{db: tx},
+			})
+			if err != nil {
+				return err
+			}
+			return tx.Commit(ctx)
+		},
+		Ping: db.Pool.Ping,
+		SchemaVersion: func(ctx context.Context) (int, int, error) {
+			return database.GetSchemaVersion(ctx, db)
+		},
+		Close: db.Close,
+	}
+}
+
+// rowScanner is implemented by both pgx.Row and pgx.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// mapError translates PostgreSQL errors into storage errors
+func mapError(err error) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return storage.ErrNotFound
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return storage.ErrConflict
+	}
+	return err
+}
@@ -0,0 +1,81 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/abstractmelon/is-site-live/internal/database"
+	"github.com/abstractmelon/is-site-live/internal/models"
+	"github.com/abstractmelon/is-site-live/internal/storage"
+)
+
+// probeColumns are the columns scanned by scanProbe
+const probeColumns = `id, name, location, last_seen_at, created_at, updated_at`
+
+type probeRepository struct {
+	db *database.DB
+}
+
+// scanProbe scans a row of probeColumns
+func scanProbe(row rowScanner) (*models.Probe, error) {
+	var probe models.Probe
+	err := row.Scan(
+		&probe.ID,
+		&probe.Name,
+		&probe.Location,
+		&probe.LastSeenAt,
+		&probe.CreatedAt,
+		&probe.UpdatedAt,
+	)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	return &probe, nil
+}
+
+func (r *probeRepository) Register(ctx context.Context, probe models.ProbeRegistration, tokenHash string) (*models.Probe, error) {
+	return scanProbe(r.db.Pool.QueryRow(ctx, `
+		INSERT INTO probes (name, location, token_hash, last_seen_at)
+		VALUES ($1, $2, $3, NOW())
+		RETURNING `+probeColumns,
+		probe.Name, probe.Location, tokenHash))
+}
+
+func (r *probeRepository) GetByTokenHash(ctx context.Context, tokenHash string) (*models.Probe, error) {
+	return scanProbe(r.db.Pool.QueryRow(ctx, `
+		SELECT `+probeColumns+` FROM probes WHERE token_hash = $1
+	`, tokenHash))
+}
+
+func (r *probeRepository) MarkSeen(ctx context.Context, id int) error {
+	_, err := r.db.Pool.Exec(ctx, `UPDATE probes SET last_seen_at = NOW() WHERE id = $1`, id)
+	return err
+}
+
+func (r *probeRepository) List(ctx context.Context) ([]models.Probe, error) {
+	rows, err := r.db.Pool.Query(ctx, `SELECT `+probeColumns+` FROM probes ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	probes := []models.Probe{}
+	for rows.Next() {
+		probe, err := scanProbe(rows)
+		if err != nil {
+			return nil, err
+		}
+		probes = append(probes, *probe)
+	}
+	return probes, rows.Err()
+}
+
+func (r *probeRepository) Delete(ctx context.Context, id int) error {
+	result, err := r.db.Pool.Exec(ctx, `DELETE FROM probes WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return storage.ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/abstractmelon/is-site-live/internal/database"
+	"github.com/abstractmelon/is-site-live/internal/models"
+	"github.com/abstractmelon/is-site-live/internal/storage"
+)
+
+// siteColumns are the columns scanned by scanSite
+const siteColumns = `id, user_id, name, url, escalation_policy_id, cert_expires_at,
+	slo_target, slo_window, slo_burn_rate_alert, trace_propagation, location_quorum, created_at, updated_at`
+
+type siteRepository struct {
+	db database.Querier
+}
+
+// scanSite scans a row of siteColumns
+func scanSite(row rowScanner) (*models.Site, error) {
+	var site models.Site
+	err := row.Scan(
+		&site.ID,
+		&site.UserID,
+		&site.Name,
+		&site.URL,
+		&site.EscalationPolicyID,
+		&site.CertExpiresAt,
+		&site.SLOTarget,
+		&site.SLOWindow,
+		&site.SLOBurnRateAlert,
+		&site.TracePropagation,
+		&site.LocationQuorum,
+		&site.CreatedAt,
+		&site.UpdatedAt,
+	)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	return &site, nil
+}
+
+// listSites runs a query returning siteColumns
+func (r *siteRepository) listSites(ctx context.Context, query string, args ...any) ([]models.Site, error) {
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sites := []models.Site{}
+	for rows.Next() {
+		site, err := scanSite(rows)
+		if err != nil {
+			return nil, err
+		}
+		sites = append(sites, *site)
+	}
+	return sites, rows.Err()
+}
+
+func (r *siteRepository) Create(ctx context.Context, userID int, site models.SiteCreation) (*models.Site, error) {
+	return scanSite(r.db.QueryRow(ctx, `
+		INSERT INTO sites (user_id, name, url, escalation_policy_id, slo_target, slo_window, slo_burn_rate_alert,
+			trace_propagation, location_quorum)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING `+siteColumns,
+		userID, site.Name, site.URL, site.EscalationPolicyID, site.SLOTarget, site.SLOWindowOrDefault(), site.SLOBurnRateAlert,
+		site.TracePropagation, site.LocationQuorum))
+}
+
+func (r *siteRepository) Get(ctx context.Context, id int) (*models.Site, error) {
+	return scanSite(r.db.QueryRow(ctx, `
+		SELECT `+siteColumns+` FROM sites WHERE id = $1
+	`, id))
+}
+
+func (r *siteRepository) List(ctx context.Context) ([]models.Site, error) {
+	return r.listSites(ctx, `SELECT `+siteColumns+` FROM sites`)
+}
+
+func (r *siteRepository) ListByUser(ctx context.Context, userID int) ([]models.Site, error) {
+	return r.listSites(ctx, `
+		SELECT `+siteColumns+` FROM sites WHERE user_id = $1 ORDER BY name
+	`, userID)
+}
+
+func (r *siteRepository) Update(ctx context.Context, id, userID int, site models.SiteCreation) (*models.Site, error) {
+	return scanSite(r.db.QueryRow(ctx, `
+		UPDATE sites
+		SET name = $1, url = $2, escalation_policy_id = $3, slo_target = $4, slo_window = $5,
+			slo_burn_rate_alert = $6, trace_propagation = $7, location_quorum = $8, updated_at = NOW()
+		WHERE id = $9 AND user_id = $10
+		RETURNING `+siteColumns,
+		site.Name, site.URL, site.EscalationPolicyID, site.SLOTarget, site.SLOWindowOrDefault(), site.SLOBurnRateAlert,
+		site.TracePropagation, site.LocationQuorum, id, userID))
+}
+
+func (r *siteRepository) Delete(ctx context.Context, id, userID int) error {
+	result, err := r.db.Exec(ctx, `
+		DELETE FROM sites WHERE id = $1 AND user_id = $2
+	`, id, userID)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return storage.ErrNotFound
+	}
+	return nil
+}
+
+func (r *siteRepository) SetCertExpiry(ctx context.Context, id int, expiresAt time.Time) error {
+	_, err := r.db.Exec(ctx, `
+		UPDATE sites SET cert_expires_at = $1 WHERE id = $2
+	`, expiresAt, id)
+	return err
+}
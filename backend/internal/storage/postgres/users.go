@@ -0,0 +1,69 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/abstractmelon/is-site-live/internal/database"
+	"github.com/abstractmelon/is-site-live/internal/models"
+	"github.com/abstractmelon/is-site-live/internal/storage"
+)
+
+// userColumns are the columns scanned by scanUser
+const userColumns = `id, username, password_hash, COALESCE(email, ''), digest_frequency, timezone, created_at, updated_at`
+
+type userRepository struct {
+	db database.Querier
+}
+
+// scanUser scans a row of userColumns
+func scanUser(row rowScanner) (*models.User, error) {
+	var user models.User
+	err := row.Scan(
+		&user.ID,
+		&user.Username,
+		&user.PasswordHash,
+		&user.Email,
+		&user.DigestFrequency,
+		&user.Timezone,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	return &user, nil
+}
+
+func (r *userRepository) Create(ctx context.Context, username, passwordHash, email string) (*models.User, error) {
+	return scanUser(r.db.QueryRow(ctx, `
+		INSERT INTO users (username, password_hash, email)
+		VALUES ($1, $2, $3)
+		RETURNING `+userColumns,
+		username, passwordHash, email))
+}
+
+func (r *userRepository) Get(ctx context.Context, id int) (*models.User, error) {
+	return scanUser(r.db.QueryRow(ctx, `
+		SELECT `+userColumns+` FROM users WHERE id = $1
+	`, id))
+}
+
+func (r *userRepository) GetByUsername(ctx context.Context, username string) (*models.User, error) {
+	return scanUser(r.db.QueryRow(ctx, `
+		SELECT `+userColumns+` FROM users WHERE username = $1
+	`, username))
+}
+
+func (r *userRepository) Update(ctx context.Context, id int, update storage.UserUpdate) (*models.User, error) {
+	return scanUser(r.db.QueryRow(ctx, `
+		UPDATE users
+		SET email = COALESCE($1, email),
+			password_hash = COALESCE($2, password_hash),
+			digest_frequency = COALESCE($3, digest_frequency),
+			timezone = COALESCE($4, timezone),
+			digest_unsubscribe_token = COALESCE(digest_unsubscribe_token, $5),
+			updated_at = NOW()
+		WHERE id = $6
+		RETURNING `+userColumns,
+		update.Email, update.PasswordHash, update.DigestFrequency, update.Timezone, update.UnsubscribeToken, id))
+}
@@ -0,0 +1,260 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/abstractmelon/is-site-live/internal/models"
+)
+
+type checkRepository struct {
+	db     *sql.DB
+	maxGap time.Duration
+}
+
+// InsertBatch inserts the checks in a single transaction
+func (r *checkRepository) InsertBatch(ctx context.Context, checks []models.Check) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO checks (site_id, status_code, response_time, is_up, error_message, checked_at, location)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, check := range checks {
+		_, err := stmt.ExecContext(ctx, check.SiteID, check.StatusCode, check.ResponseTime, check.IsUp, check.ErrorMessage, formatTime(check.CheckedAt), check.Location)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *checkRepository) Latest(ctx context.Context, siteID int) (*models.Check, error) {
+	var check models.Check
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id, site_id, status_code, response_time, is_up, error_message, checked_at, location
+		FROM checks
+		WHERE site_id = ?
+		ORDER BY checked_at DESC, id DESC
+		LIMIT 1
+	`, siteID).Scan(
+		&check.ID,
+		&check.SiteID,
+		&check.StatusCode,
+		&check.ResponseTime,
+		&check.IsUp,
+		&check.ErrorMessage,
+		&check.CheckedAt,
+		&check.Location,
+	)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	return &check, nil
+}
+
+func (r *checkRepository) StateSince(ctx context.Context, siteID int, isUp bool) (time.Time, error) {
+	var since time.Time
+	err := r.db.QueryRowContext(ctx, `
+		SELECT checked_at
+		FROM checks
+		WHERE site_id = ?1 AND checked_at > COALESCE(
+			(SELECT checked_at FROM checks WHERE site_id = ?1 AND is_up <> ?2 ORDER BY checked_at DESC LIMIT 1),
+			''
+		)
+		ORDER BY checked_at
+		LIMIT 1
+	`, siteID, isUp).Scan(&since)
+	if err != nil {
+		return time.Time{}, mapError(err)
+	}
+	return since, nil
+}
+
+// checkStreamBatchSize is the number of checks read at once by Stream
+const checkStreamBatchSize = 1000
+
+// Stream reads the checks in pages, continuing after the last check read, so
+// the single connection isn't held while fn runs and checks can be written
+// in between
+func (r *checkRepository) Stream(ctx context.Context, siteID int, from, to time.Time, fn func(models.Check) error) error {
+	afterTime, afterID := formatTime(from), 0
+	for {
+		rows, err := r.db.QueryContext(ctx, `
+			SELECT id, site_id, status_code, response_time, is_up, error_message, checked_at, location
+			FROM checks
+			WHERE site_id = ? AND checked_at < ? AND (checked_at > ? OR (checked_at = ? AND id > ?))
+			ORDER BY checked_at, id
+			LIMIT ?
+		`, siteID, formatTime(to), afterTime, afterTime, afterID, checkStreamBatchSize)
+		if err != nil {
+			return err
+		}
+
+		checks := make([]models.Check, 0, checkStreamBatchSize)
+		for rows.Next() {
+			var check models.Check
+			if err := rows.Scan(
+				&check.ID,
+				&check.SiteID,
+				&check.StatusCode,
+				&check.ResponseTime,
+				&check.IsUp,
+				&check.ErrorMessage,
+				&check.CheckedAt,
+				&check.Location,
+			); err != nil {
+				rows.Close()
+				return err
+			}
+			checks = append(checks, check)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, check := range checks {
+			if err := fn(check); err != nil {
+				return err
+			}
+		}
+		if len(checks) < checkStreamBatchSize {
+			return nil
+		}
+		last := checks[len(checks)-1]
+		afterTime, afterID = formatTime(last.CheckedAt), last.ID
+	}
+}
+
+// UptimeStats summarises the raw checks, as there are no rollups in SQLite.
+// Each check covers the time until the next check, at most the maximum
+// check gap, but not past the end of the period. The period before the site
+// was created doesn't count as having no data.
+func (r *checkRepository) UptimeStats(ctx context.Context, siteID int, from, to time.Time) (models.UptimeStats, error) {
+	to = minTime(to, time.Now())
+
+	var totalChecks, successfulChecks, responseTimeSum int64
+	var responseTimeSqSum, upSeconds, downSeconds float64
+	var minResponseTime, maxResponseTime sql.NullInt64
+	histogram := make([]int64, len(models.LatencyBucketBounds)+1)
+
+	dest := []any{
+		&totalChecks,
+		&successfulChecks,
+		&responseTimeSum,
+		&responseTimeSqSum,
+		&minResponseTime,
+		&maxResponseTime,
+		&upSeconds,
+		&downSeconds,
+	}
+	for i := range histogram {
+		dest = append(dest, &histogram[i])
+	}
+	err := r.db.QueryRowContext(ctx, `
+		SELECT
+			COUNT(*),
+			COALESCE(SUM(is_up), 0),
+			COALESCE(SUM(CASE WHEN is_up THEN response_time ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN is_up THEN CAST(response_time AS REAL) * response_time ELSE 0 END), 0),
+			MIN(CASE WHEN is_up THEN response_time END),
+			MAX(CASE WHEN is_up THEN response_time END),
+			COALESCE(SUM(CASE WHEN is_up THEN covered ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN is_up THEN 0 ELSE covered END), 0),
+			`+histogramColumns()+`
+		FROM (
+			SELECT is_up, response_time,
+				MAX(0, MIN(
+					COALESCE(LEAD(julianday(checked_at)) OVER (ORDER BY checked_at, id), julianday(?3)),
+					julianday(checked_at) + ?4,
+					julianday(?3)
+				) - julianday(checked_at)) * 86400 AS covered
+			FROM checks
+			WHERE site_id = ?1 AND checked_at >= ?2 AND checked_at < ?3
+		)
+	`, siteID, formatTime(from), formatTime(to), r.maxGap.Hours()/24).Scan(dest...)
+	if err != nil {
+		return models.UptimeStats{}, err
+	}
+
+	var createdAt time.Time
+	err = r.db.QueryRowContext(ctx, `
+		SELECT created_at FROM sites WHERE id = ?
+	`, siteID).Scan(&createdAt)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return models.UptimeStats{}, err
+	}
+
+	var stats models.UptimeStats
+	stats.TotalChecks = int(totalChecks)
+	stats.SuccessfulChecks = int(successfulChecks)
+	stats.ResponseTimeSum = responseTimeSum
+	if totalChecks > 0 {
+		stats.UptimePercentage = float64(successfulChecks) / float64(totalChecks) * 100
+	}
+	if successfulChecks > 0 {
+		stats.AverageResponseTime = int(responseTimeSum / successfulChecks)
+
+		// Population standard deviation from the sum and sum of squares
+		mean := float64(responseTimeSum) / float64(successfulChecks)
+		variance := responseTimeSqSum/float64(successfulChecks) - mean*mean
+		stats.ResponseTimeStdDev = math.Round(math.Sqrt(math.Max(variance, 0))*100) / 100
+	}
+	if minResponseTime.Valid && maxResponseTime.Valid {
+		min, max := int(minResponseTime.Int64), int(maxResponseTime.Int64)
+		stats.MinResponseTime = min
+		stats.MaxResponseTime = max
+		stats.P50ResponseTime = models.EstimatePercentile(histogram, 50, min, max)
+		stats.P90ResponseTime = models.EstimatePercentile(histogram, 90, min, max)
+		stats.P95ResponseTime = models.EstimatePercentile(histogram, 95, min, max)
+		stats.P99ResponseTime = models.EstimatePercentile(histogram, 99, min, max)
+	}
+	if createdAt.After(from) {
+		from = createdAt
+	}
+	stats.SetDurations(seconds(upSeconds), seconds(downSeconds), to.Sub(from))
+
+	return stats, nil
+}
+
+// seconds converts a number of seconds to a duration
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// minTime returns the earlier of two times
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+// histogramColumns builds one column per latency histogram bucket counting
+// the successful checks in that bucket
+func histogramColumns() string {
+	columns := make([]string, 0, len(models.LatencyBucketBounds)+1)
+	lower := 0
+	for _, upper := range models.LatencyBucketBounds {
+		columns = append(columns, fmt.Sprintf("COALESCE(SUM(is_up AND response_time >= %d AND response_time < %d), 0)", lower, upper))
+		lower = upper
+	}
+	columns = append(columns, fmt.Sprintf("COALESCE(SUM(is_up AND response_time >= %d), 0)", lower))
+
+	return strings.Join(columns, ", ")
+}
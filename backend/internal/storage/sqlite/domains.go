@@ -0,0 +1,94 @@
+package sqlite
+
+import (
+	"context"
+
+	"github.com/abstractmelon/is-site-live/internal/models"
+	"github.com/abstractmelon/is-site-live/internal/storage"
+)
+
+// domainColumns are the columns scanned by scanDomain
+const domainColumns = `id, user_id, domain, verified, created_at, updated_at`
+
+type domainRepository struct {
+	db querier
+}
+
+// scanDomain scans a row of domainColumns
+func scanDomain(row rowScanner) (*models.CustomDomain, error) {
+	var domain models.CustomDomain
+	err := row.Scan(
+		&domain.ID,
+		&domain.UserID,
+		&domain.Domain,
+		&domain.Verified,
+		&domain.CreatedAt,
+		&domain.UpdatedAt,
+	)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	return &domain, nil
+}
+
+func (r *domainRepository) Create(ctx context.Context, userID int, domain string) (*models.CustomDomain, error) {
+	return scanDomain(r.db.QueryRowContext(ctx, `
+		INSERT INTO custom_domains (user_id, domain, verified, created_at, updated_at)
+		VALUES (?1, ?2, false, ?3, ?3)
+		RETURNING `+domainColumns,
+		userID, domain, now()))
+}
+
+func (r *domainRepository) Get(ctx context.Context, id, userID int) (*models.CustomDomain, error) {
+	return scanDomain(r.db.QueryRowContext(ctx, `
+		SELECT `+domainColumns+` FROM custom_domains WHERE id = ? AND user_id = ?
+	`, id, userID))
+}
+
+func (r *domainRepository) GetByName(ctx context.Context, domain string) (*models.CustomDomain, error) {
+	return scanDomain(r.db.QueryRowContext(ctx, `
+		SELECT `+domainColumns+` FROM custom_domains WHERE domain = ?
+	`, domain))
+}
+
+func (r *domainRepository) ListByUser(ctx context.Context, userID int) ([]models.CustomDomain, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+domainColumns+` FROM custom_domains WHERE user_id = ? ORDER BY domain
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	domains := []models.CustomDomain{}
+	for rows.Next() {
+		domain, err := scanDomain(rows)
+		if err != nil {
+			return nil, err
+		}
+		domains = append(domains, *domain)
+	}
+	return domains, rows.Err()
+}
+
+func (r *domainRepository) SetVerified(ctx context.Context, id int, verified bool) (*models.CustomDomain, error) {
+	return scanDomain(r.db.QueryRowContext(ctx, `
+		UPDATE custom_domains
+		SET verified = ?1, updated_at = ?2
+		WHERE id = ?3
+		RETURNING `+domainColumns,
+		verified, now(), id))
+}
+
+func (r *domainRepository) Delete(ctx context.Context, id, userID int) error {
+	result, err := r.db.ExecContext(ctx, `
+		DELETE FROM custom_domains WHERE id = ? AND user_id = ?
+	`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return storage.ErrNotFound
+	}
+	return nil
+}
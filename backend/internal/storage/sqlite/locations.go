@@ -0,0 +1,109 @@
+package sqlite
+
+import (
+	"context"
+	"time"
+
+	"github.com/abstractmelon/is-site-live/internal/models"
+)
+
+// InsertLocationBatch inserts the results in a single transaction
+func (r *checkRepository) InsertLocationBatch(ctx context.Context, checks []models.Check) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO location_checks (site_id, location, status_code, response_time, is_up, error_message, checked_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, check := range checks {
+		_, err := stmt.ExecContext(ctx, check.SiteID, check.Location, check.StatusCode, check.ResponseTime, check.IsUp, check.ErrorMessage, formatTime(check.CheckedAt))
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *checkRepository) LatestByLocation(ctx context.Context, since time.Time) (map[int][]models.Check, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, site_id, status_code, response_time, is_up, error_message, checked_at, location
+		FROM (
+			SELECT *, ROW_NUMBER() OVER (PARTITION BY site_id, location ORDER BY checked_at DESC, id DESC) AS n
+			FROM location_checks
+			WHERE checked_at >= ?
+		)
+		WHERE n = 1
+		ORDER BY site_id, location
+	`, formatTime(since))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	latest := make(map[int][]models.Check)
+	for rows.Next() {
+		var check models.Check
+		err := rows.Scan(
+			&check.ID,
+			&check.SiteID,
+			&check.StatusCode,
+			&check.ResponseTime,
+			&check.IsUp,
+			&check.ErrorMessage,
+			&check.CheckedAt,
+			&check.Location,
+		)
+		if err != nil {
+			return nil, err
+		}
+		latest[check.SiteID] = append(latest[check.SiteID], check)
+	}
+	return latest, rows.Err()
+}
+
+func (r *checkRepository) LocationStats(ctx context.Context, siteID int, from time.Time) ([]models.LocationStats, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT location, COUNT(*), COALESCE(SUM(is_up), 0),
+			COALESCE(AVG(CASE WHEN is_up THEN response_time END), 0),
+			COALESCE(MIN(CASE WHEN is_up THEN response_time END), 0),
+			COALESCE(MAX(CASE WHEN is_up THEN response_time END), 0)
+		FROM location_checks
+		WHERE site_id = ? AND checked_at >= ?
+		GROUP BY location
+		ORDER BY location
+	`, siteID, formatTime(from))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	locations := []models.LocationStats{}
+	for rows.Next() {
+		var stats models.LocationStats
+		var averageResponseTime float64
+		err := rows.Scan(
+			&stats.Location,
+			&stats.TotalChecks,
+			&stats.SuccessfulChecks,
+			&averageResponseTime,
+			&stats.MinResponseTime,
+			&stats.MaxResponseTime,
+		)
+		if err != nil {
+			return nil, err
+		}
+		stats.AverageResponseTime = int(averageResponseTime)
+		stats.UptimePercentage = float64(stats.SuccessfulChecks) / float64(stats.TotalChecks) * 100
+		locations = append(locations, stats)
+	}
+	return locations, rows.Err()
+}
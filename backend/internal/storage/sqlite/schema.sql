@@ -0,0 +1,47 @@
+-- Schema of the embedded SQLite backend. Timestamps are stored as
+-- fixed-width UTC text so they sort and compare chronologically.
+
+CREATE TABLE IF NOT EXISTS users (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	username TEXT UNIQUE NOT NULL,
+	password_hash TEXT NOT NULL,
+	email TEXT NOT NULL DEFAULT '',
+	digest_frequency TEXT NOT NULL DEFAULT 'none',
+	digest_unsubscribe_token TEXT UNIQUE,
+	timezone TEXT NOT NULL DEFAULT 'UTC',
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS sites (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	name TEXT NOT NULL,
+	url TEXT NOT NULL,
+	escalation_policy_id INTEGER,
+	cert_expires_at TIMESTAMP,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+	UNIQUE(user_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS checks (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	site_id INTEGER NOT NULL REFERENCES sites(id) ON DELETE CASCADE,
+	status_code INTEGER NOT NULL DEFAULT 0,
+	response_time INTEGER NOT NULL DEFAULT 0, -- in milliseconds
+	is_up BOOLEAN NOT NULL,
+	error_message TEXT NOT NULL DEFAULT '',
+	checked_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS checks_site_checked_at_idx ON checks (site_id, checked_at);
+
+CREATE TABLE IF NOT EXISTS custom_domains (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	domain TEXT UNIQUE NOT NULL,
+	verified BOOLEAN NOT NULL DEFAULT FALSE,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,178 @@
+// Package sqlite implements the storage repositories on an embedded SQLite
+// database, for small installations without PostgreSQL
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/abstractmelon/is-site-live/internal/storage"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+//go:embed schema.sql
+var schema string
+
+// upgrades change the schema of databases created by earlier versions, in
+// order. schema.sql creates the schema as it was before the first upgrade,
+// and PRAGMA user_version records how many upgrades have been applied.
+var upgrades = []string{
+	// SLO targets
+	`ALTER TABLE sites ADD COLUMN slo_target REAL;
+	ALTER TABLE sites ADD COLUMN slo_window TEXT NOT NULL DEFAULT 'rolling_30d';
+	ALTER TABLE sites ADD COLUMN slo_burn_rate_alert REAL;`,
+	// Trace context propagation
+	`ALTER TABLE sites ADD COLUMN trace_propagation BOOLEAN NOT NULL DEFAULT 0;`,
+	// Remote probes
+	`CREATE TABLE probes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT UNIQUE NOT NULL,
+		location TEXT NOT NULL,
+		token_hash TEXT UNIQUE NOT NULL,
+		last_seen_at TIMESTAMP,
+		created_at TIMESTAMP NOT NULL,
+		updated_at TIMESTAMP NOT NULL
+	);
+	ALTER TABLE checks ADD COLUMN location TEXT NOT NULL DEFAULT '';`,
+	// Per-location results and quorum
+	`CREATE TABLE location_checks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		site_id INTEGER NOT NULL REFERENCES sites(id) ON DELETE CASCADE,
+		location TEXT NOT NULL,
+		status_code INTEGER NOT NULL DEFAULT 0,
+		response_time INTEGER NOT NULL DEFAULT 0,
+		is_up BOOLEAN NOT NULL,
+		error_message TEXT NOT NULL DEFAULT '',
+		checked_at TIMESTAMP NOT NULL
+	);
+	CREATE INDEX location_checks_site_checked_at_idx ON location_checks (site_id, checked_at);
+	CREATE INDEX location_checks_checked_at_idx ON location_checks (checked_at);
+	ALTER TABLE sites ADD COLUMN location_quorum INTEGER NOT NULL DEFAULT 0;`,
+}
+
+// timeFormat is how timestamps are stored. Unlike the driver's default
+// format it has a fixed width, so text comparisons order times correctly.
+const timeFormat = "2006-01-02 15:04:05.000000"
+
+// Open opens or creates the SQLite database at path and creates its schema.
+// maxCheckGap is how long a check's result holds for time-weighted uptime,
+// see config.MonitoringConfig.MaxCheckGap.
+func Open(path string, maxCheckGap time.Duration) (*storage.Store, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, fmt.Errorf("unable to open database: %v", err)
+	}
+	// SQLite only allows one writer, and in-memory databases are per connection
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("unable to create schema: %v", err)
+	}
+	if err := upgrade(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("unable to upgrade schema: %v", err)
+	}
+
+	return &storage.Store{
+		Driver:  storage.DriverSQLite,
+		Users:   &userRepository{db: db},
+		Sites:   &siteRepository{db: db},
+		Checks:  &checkRepository{db: db, maxGap: maxCheckGap},
+		Domains: &domainRepository{db: db},
+		Probes:  &probeRepository{db: db},
+		InTx: func(ctx context.Context, fn func(tx storage.Tx) error) error {
+			tx, err := db.BeginTx(ctx, nil)
+			if err != nil {
+				return err
+			}
+			defer tx.Rollback()
+
+			err = fn(storage.Tx{
+				Users:   &userRepository{db: tx},
+				Sites:   &siteRepository{db: tx},
+				Domains: &domainRepository{db: tx},
+			})
+			if err != nil {
+				return err
+			}
+			return tx.Commit()
+		},
+		Ping: db.PingContext,
+		SchemaVersion: func(ctx context.Context) (int, int, error) {
+			var version int
+			err := db.QueryRowContext(ctx, `PRAGMA user_version`).Scan(&version)
+			return version, len(upgrades), err
+		},
+		Close: func() { db.Close() },
+	}, nil
+}
+
+// upgrade applies the schema upgrades the database doesn't have yet, each in
+// its own transaction
+func upgrade(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+
+	for ; version < len(upgrades); version++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(upgrades[version]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("upgrade %d: %v", version+1, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, version+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// querier is implemented by both sql.DB and sql.Tx, so repositories can run
+// either on their own or in a transaction
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// rowScanner is implemented by both sql.Row and sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// formatTime formats a time for storage
+func formatTime(t time.Time) string {
+	return t.UTC().Format(timeFormat)
+}
+
+// now is the current time formatted for storage
+func now() string {
+	return formatTime(time.Now())
+}
+
+// mapError translates SQLite errors into storage errors
+func mapError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.ErrNotFound
+	}
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE {
+		return storage.ErrConflict
+	}
+	return err
+}
@@ -0,0 +1,68 @@
+package sqlite
+
+import (
+	"context"
+
+	"github.com/abstractmelon/is-site-live/internal/models"
+	"github.com/abstractmelon/is-site-live/internal/storage"
+)
+
+// userColumns are the columns scanned by scanUser
+const userColumns = `id, username, password_hash, email, digest_frequency, timezone, created_at, updated_at`
+
+type userRepository struct {
+	db querier
+}
+
+// scanUser scans a row of userColumns
+func scanUser(row rowScanner) (*models.User, error) {
+	var user models.User
+	err := row.Scan(
+		&user.ID,
+		&user.Username,
+		&user.PasswordHash,
+		&user.Email,
+		&user.DigestFrequency,
+		&user.Timezone,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	return &user, nil
+}
+
+func (r *userRepository) Create(ctx context.Context, username, passwordHash, email string) (*models.User, error) {
+	return scanUser(r.db.QueryRowContext(ctx, `
+		INSERT INTO users (username, password_hash, email, created_at, updated_at)
+		VALUES (?1, ?2, ?3, ?4, ?4)
+		RETURNING `+userColumns,
+		username, passwordHash, email, now()))
+}
+
+func (r *userRepository) Get(ctx context.Context, id int) (*models.User, error) {
+	return scanUser(r.db.QueryRowContext(ctx, `
+		SELECT `+userColumns+` FROM users WHERE id = ?
+	`, id))
+}
+
+func (r *userRepository) GetByUsername(ctx context.Context, username string) (*models.User, error) {
+	return scanUser(r.db.QueryRowContext(ctx, `
+		SELECT `+userColumns+` FROM users WHERE username = ?
+	`, username))
+}
+
+func (r *userRepository) Update(ctx context.Context, id int, update storage.UserUpdate) (*models.User, error) {
+	return scanUser(r.db.QueryRowContext(ctx, `
+		UPDATE users
+		SET email = COALESCE(?1, email),
+			password_hash = COALESCE(?2, password_hash),
+			digest_frequency = COALESCE(?3, digest_frequency),
+			timezone = COALESCE(?4, timezone),
+			digest_unsubscribe_token = COALESCE(digest_unsubscribe_token, ?5),
+			updated_at = ?6
+		WHERE id = ?7
+		RETURNING `+userColumns,
+		update.Email, update.PasswordHash, update.DigestFrequency, update.Timezone, update.UnsubscribeToken, now(), id))
+}
@@ -0,0 +1,151 @@
+// Package storage defines the repositories the core of the application uses
+// to store users, sites, checks, custom domains and probes, so it can run on
+// either PostgreSQL or an embedded SQLite database.
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/abstractmelon/is-site-live/internal/models"
+)
+
+// Storage drivers
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// ErrNotFound is returned when a record does not exist
+var ErrNotFound = errors.New("not found")
+
+// ErrConflict is returned when a record would violate a uniqueness constraint
+var ErrConflict = errors.New("already exists")
+
+// Store groups the repositories of a storage backend
+type Store struct {
+	Driver  string
+	Users   UserRepository
+	Sites   SiteRepository
+	Checks  CheckRepository
+	Domains DomainRepository
+	Probes  ProbeRepository
+
+	// InTx runs fn with repositories making their changes in a single
+	// transaction, committed if fn returns nil and rolled back otherwise
+	InTx func(ctx context.Context, fn func(tx Tx) error) error
+	// Ping checks that the database can be reached
+	Ping func(ctx context.Context) error
+	// SchemaVersion gets the version of the database schema and the latest
+	// version this build knows, which differ until it has been upgraded
+	SchemaVersion func(ctx context.Context) (current, latest int, err error)
+	// Close releases the resources of the backend
+	Close func()
+}
+
+// Tx groups the repositories that can make changes in a transaction. Only
+// they may be used until the transaction ends, as SQLite has one connection.
+type Tx struct {
+	Users   UserRepository
+	Sites   SiteRepository
+	Domains DomainRepository
+}
+
+// UserRepository stores users
+type UserRepository interface {
+	// Create creates a user, returning ErrConflict if the username is taken
+	Create(ctx context.Context, username, passwordHash, email string) (*models.User, error)
+	// Get gets a user by ID
+	Get(ctx context.Context, id int) (*models.User, error)
+	// GetByUsername gets a user, including their password hash, by username
+	GetByUsername(ctx context.Context, username string) (*models.User, error)
+	// Update changes the fields of a user that are set in the update
+	Update(ctx context.Context, id int, update UserUpdate) (*models.User, error)
+}
+
+// UserUpdate holds the user fields to change, nil fields are left unchanged
+type UserUpdate struct {
+	Email           *string
+	PasswordHash    *string
+	DigestFrequency *string
+	Timezone        *string
+	// UnsubscribeToken is only stored if the user doesn't have one yet
+	UnsubscribeToken *string
+}
+
+// SiteRepository stores monitored sites
+type SiteRepository interface {
+	// Create creates a site for a user
+	Create(ctx context.Context, userID int, site models.SiteCreation) (*models.Site, error)
+	// Get gets a site by ID
+	Get(ctx context.Context, id int) (*models.Site, error)
+	// List lists every site
+	List(ctx context.Context) ([]models.Site, error)
+	// ListByUser lists the sites of a user, ordered by name
+	ListByUser(ctx context.Context, userID int) ([]models.Site, error)
+	// Update updates a site owned by a user
+	Update(ctx context.Context, id, userID int, site models.SiteCreation) (*models.Site, error)
+	// Delete deletes a site owned by a user
+	Delete(ctx context.Context, id, userID int) error
+	// SetCertExpiry records when the certificate of a site expires
+	SetCertExpiry(ctx context.Context, id int, expiresAt time.Time) error
+}
+
+// CheckRepository stores the results of site checks
+type CheckRepository interface {
+	// InsertBatch stores a batch of checks
+	InsertBatch(ctx context.Context, checks []models.Check) error
+	// Latest gets the most recent check of a site
+	Latest(ctx context.Context, siteID int) (*models.Check, error)
+	// StateSince gets when a site entered its current up or down state: the
+	// first check after the last check in the other state
+	StateSince(ctx context.Context, siteID int, isUp bool) (time.Time, error)
+	// Stream calls fn with the checks of a site from one time up to another,
+	// oldest first, without loading them all into memory. It stops at the
+	// first error fn returns.
+	Stream(ctx context.Context, siteID int, from, to time.Time, fn func(models.Check) error) error
+	// UptimeStats gets the uptime statistics of a site between two times.
+	// A zero from covers the site's lifetime.
+	UptimeStats(ctx context.Context, siteID int, from, to time.Time) (models.UptimeStats, error)
+
+	// InsertLocationBatch stores a batch of results of single locations
+	InsertLocationBatch(ctx context.Context, checks []models.Check) error
+	// LatestByLocation gets the latest result of every location of every
+	// site since a time, by site ID
+	LatestByLocation(ctx context.Context, since time.Time) (map[int][]models.Check, error)
+	// LocationStats summarises the results of a site since a time per
+	// location, ordered by location. Current is left unset.
+	LocationStats(ctx context.Context, siteID int, from time.Time) ([]models.LocationStats, error)
+}
+
+// DomainRepository stores custom domains
+type DomainRepository interface {
+	// Create creates an unverified custom domain for a user, returning
+	// ErrConflict if the domain is taken
+	Create(ctx context.Context, userID int, domain string) (*models.CustomDomain, error)
+	// Get gets a custom domain owned by a user
+	Get(ctx context.Context, id, userID int) (*models.CustomDomain, error)
+	// GetByName gets a custom domain of any user by name
+	GetByName(ctx context.Context, domain string) (*models.CustomDomain, error)
+	// ListByUser lists the custom domains of a user, ordered by domain
+	ListByUser(ctx context.Context, userID int) ([]models.CustomDomain, error)
+	// SetVerified records whether a custom domain is verified
+	SetVerified(ctx context.Context, id int, verified bool) (*models.CustomDomain, error)
+	// Delete deletes a custom domain owned by a user
+	Delete(ctx context.Context, id, userID int) error
+}
+
+// ProbeRepository stores remote probes
+type ProbeRepository interface {
+	// Register creates a probe, returning ErrConflict if the name is taken
+	Register(ctx context.Context, probe models.ProbeRegistration, tokenHash string) (*models.Probe, error)
+	// GetByTokenHash gets the probe authenticating with a token
+	GetByTokenHash(ctx context.Context, tokenHash string) (*models.Probe, error)
+	// MarkSeen records that a probe was just heard from
+	MarkSeen(ctx context.Context, id int) error
+	// List lists every probe, ordered by name
+	List(ctx context.Context) ([]models.Probe, error)
+	// Delete deletes a probe
+	Delete(ctx context.Context, id int) error
+}
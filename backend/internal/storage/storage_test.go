@@ -0,0 +1,431 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/abstractmelon/is-site-live/internal/database"
+	"github.com/abstractmelon/is-site-live/internal/models"
+	"github.com/abstractmelon/is-site-live/internal/storage"
+	"github.com/abstractmelon/is-site-live/internal/storage/postgres"
+	"github.com/abstractmelon/is-site-live/internal/storage/sqlite"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// maxCheckGap is the maximum check gap the stores are opened with
+const maxCheckGap = 2 * time.Minute
+
+// forEachStore runs a test against an empty SQLite store, and against an
+// empty PostgreSQL store when TEST_DATABASE_URL points to a scratch database.
+// Everything in that database's public schema is dropped.
+func forEachStore(t *testing.T, test func(t *testing.T, store *storage.Store)) {
+	t.Run(storage.DriverSQLite, func(t *testing.T) {
+		store, err := sqlite.Open(filepath.Join(t.TempDir(), "test.db"), maxCheckGap)
+		if err != nil {
+			t.Fatalf("opening SQLite store: %v", err)
+		}
+		defer store.Close()
+		test(t, store)
+	})
+
+	t.Run(storage.DriverPostgres, func(t *testing.T) {
+		dsn := os.Getenv("TEST_DATABASE_URL")
+		if dsn == "" {
+			t.Skip("TEST_DATABASE_URL is not set")
+		}
+
+		pool, err := pgxpool.New(context.Background(), dsn)
+		if err != nil {
+			t.Fatalf("connecting to the scratch database: %v", err)
+		}
+		db := &database.DB{Pool: pool}
+		defer db.Close()
+
+		if _, err := pool.Exec(context.Background(), `DROP SCHEMA public CASCADE; CREATE SCHEMA public`); err != nil {
+			t.Fatalf("emptying the scratch database: %v", err)
+		}
+		if err := database.Migrate(db); err != nil {
+			t.Fatalf("migrating the scratch database: %v", err)
+		}
+		test(t, postgres.New(db, maxCheckGap))
+	})
+}
+
+// createUser creates a user or fails the test
+func createUser(t *testing.T, store *storage.Store, username string) *models.User {
+	t.Helper()
+
+	user, err := store.Users.Create(context.Background(), username, "hash-"+username, username+"@example.com")
+	if err != nil {
+		t.Fatalf("creating user %s: %v", username, err)
+	}
+	return user
+}
+
+// createSite creates a site or fails the test
+func createSite(t *testing.T, store *storage.Store, userID int, name string) *models.Site {
+	t.Helper()
+
+	site, err := store.Sites.Create(context.Background(), userID, models.SiteCreation{
+		Name: name,
+		URL:  "https://" + name + ".example.com",
+	})
+	if err != nil {
+		t.Fatalf("creating site %s: %v", name, err)
+	}
+	return site
+}
+
+func TestUsers(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store *storage.Store) {
+		ctx := context.Background()
+		alice := createUser(t, store, "alice")
+
+		if _, err := store.Users.Create(ctx, "alice", "other", "other@example.com"); !errors.Is(err, storage.ErrConflict) {
+			t.Errorf("creating a duplicate user: got %v, want ErrConflict", err)
+		}
+
+		got, err := store.Users.GetByUsername(ctx, "alice")
+		if err != nil {
+			t.Fatalf("getting user by username: %v", err)
+		}
+		if got.ID != alice.ID || got.PasswordHash != "hash-alice" || got.Email != "alice@example.com" {
+			t.Errorf("got user %+v, want %+v", got, alice)
+		}
+
+		if _, err := store.Users.Get(ctx, alice.ID+1000); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("getting a missing user: got %v, want ErrNotFound", err)
+		}
+
+		timezone := "Europe/Paris"
+		updated, err := store.Users.Update(ctx, alice.ID, storage.UserUpdate{Timezone: &timezone})
+		if err != nil {
+			t.Fatalf("updating user: %v", err)
+		}
+		if updated.Timezone != timezone || updated.Email != "alice@example.com" {
+			t.Errorf("updated user %+v, want only the timezone changed", updated)
+		}
+	})
+}
+
+func TestSites(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store *storage.Store) {
+		ctx := context.Background()
+		alice := createUser(t, store, "alice")
+		bob := createUser(t, store, "bob")
+		beta := createSite(t, store, alice.ID, "beta")
+		alpha := createSite(t, store, alice.ID, "alpha")
+		createSite(t, store, bob.ID, "gamma")
+		if beta.SLOWindow != models.SLOWindowRolling30d || beta.LocationQuorum != 0 {
+			t.Errorf("new site has SLO window %q and location quorum %d, want the defaults", beta.SLOWindow, beta.LocationQuorum)
+		}
+
+		all, err := store.Sites.List(ctx)
+		if err != nil {
+			t.Fatalf("listing sites: %v", err)
+		}
+		if len(all) != 3 {
+			t.Errorf("listed %d sites, want 3", len(all))
+		}
+
+		owned, err := store.Sites.ListByUser(ctx, alice.ID)
+		if err != nil {
+			t.Fatalf("listing sites of user: %v", err)
+		}
+		if len(owned) != 2 || owned[0].ID != alpha.ID || owned[1].ID != beta.ID {
+			t.Errorf("listed %+v, want alpha and beta ordered by name", owned)
+		}
+
+		update := models.SiteCreation{Name: "beta", URL: "https://beta.example.org", LocationQuorum: 2}
+		if _, err := store.Sites.Update(ctx, beta.ID, bob.ID, update); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("updating a site of another user: got %v, want ErrNotFound", err)
+		}
+		updated, err := store.Sites.Update(ctx, beta.ID, alice.ID, update)
+		if err != nil {
+			t.Fatalf("updating site: %v", err)
+		}
+		if updated.URL != update.URL || updated.LocationQuorum != 2 {
+			t.Errorf("updated site %+v, want %+v", updated, update)
+		}
+
+		expiresAt := time.Now().Add(30 * 24 * time.Hour).UTC().Truncate(time.Second)
+		if err := store.Sites.SetCertExpiry(ctx, beta.ID, expiresAt); err != nil {
+			t.Fatalf("setting certificate expiry: %v", err)
+		}
+		got, err := store.Sites.Get(ctx, beta.ID)
+		if err != nil {
+			t.Fatalf("getting site: %v", err)
+		}
+		if got.CertExpiresAt == nil || !got.CertExpiresAt.Equal(expiresAt) {
+			t.Errorf("certificate expires at %v, want %v", got.CertExpiresAt, expiresAt)
+		}
+
+		if err := store.Sites.Delete(ctx, beta.ID, bob.ID); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("deleting a site of another user: got %v, want ErrNotFound", err)
+		}
+		if err := store.Sites.Delete(ctx, beta.ID, alice.ID); err != nil {
+			t.Fatalf("deleting site: %v", err)
+		}
+		if _, err := store.Sites.Get(ctx, beta.ID); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("getting a deleted site: got %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestChecks(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store *storage.Store) {
+		ctx := context.Background()
+		alice := createUser(t, store, "alice")
+		site := createSite(t, store, alice.ID, "alpha")
+
+		if _, err := store.Checks.Latest(ctx, site.ID); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("getting the latest check without checks: got %v, want ErrNotFound", err)
+		}
+
+		start := time.Now().Add(-10 * time.Minute).UTC().Truncate(time.Second)
+		checks := []models.Check{
+			{SiteID: site.ID, StatusCode: 200, ResponseTime: 100, IsUp: true, CheckedAt: start},
+			{SiteID: site.ID, StatusCode: 500, IsUp: false, ErrorMessage: "HTTP 500", CheckedAt: start.Add(time.Minute)},
+			{SiteID: site.ID, StatusCode: 200, ResponseTime: 300, IsUp: true, CheckedAt: start.Add(2 * time.Minute), Location: "eu-west"},
+		}
+		if err := store.Checks.InsertBatch(ctx, checks); err != nil {
+			t.Fatalf("inserting checks: %v", err)
+		}
+
+		latest, err := store.Checks.Latest(ctx, site.ID)
+		if err != nil {
+			t.Fatalf("getting the latest check: %v", err)
+		}
+		if !latest.CheckedAt.Equal(checks[2].CheckedAt) || latest.ResponseTime != 300 || latest.Location != "eu-west" {
+			t.Errorf("latest check %+v, want %+v", latest, checks[2])
+		}
+
+		since, err := store.Checks.StateSince(ctx, site.ID, true)
+		if err != nil {
+			t.Fatalf("getting the state start: %v", err)
+		}
+		if !since.Equal(checks[2].CheckedAt) {
+			t.Errorf("up since %v, want %v", since, checks[2].CheckedAt)
+		}
+
+		var streamed []models.Check
+		err = store.Checks.Stream(ctx, site.ID, start, start.Add(2*time.Minute), func(check models.Check) error {
+			streamed = append(streamed, check)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("streaming checks: %v", err)
+		}
+		if len(streamed) != 2 || !streamed[0].CheckedAt.Equal(start) || streamed[1].ErrorMessage != "HTTP 500" {
+			t.Errorf("streamed %+v, want the first two checks in order", streamed)
+		}
+
+		stats, err := store.Checks.UptimeStats(ctx, site.ID, time.Time{}, time.Now())
+		if err != nil {
+			t.Fatalf("getting uptime stats: %v", err)
+		}
+		if stats.TotalChecks != 3 || stats.SuccessfulChecks != 2 || stats.AverageResponseTime != 200 ||
+			stats.ResponseTimeSum != 400 || stats.MinResponseTime != 100 || stats.MaxResponseTime != 300 {
+			t.Errorf("got stats %+v, want 3 checks, 2 successful, 100-300 ms summing to 400 ms", stats)
+		}
+	})
+}
+
+func TestLocationChecks(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store *storage.Store) {
+		ctx := context.Background()
+		alice := createUser(t, store, "alice")
+		site := createSite(t, store, alice.ID, "alpha")
+
+		start := time.Now().Add(-5 * time.Minute).UTC().Truncate(time.Second)
+		err := store.Checks.InsertLocationBatch(ctx, []models.Check{
+			{SiteID: site.ID, StatusCode: 200, ResponseTime: 100, IsUp: true, CheckedAt: start, Location: "eu-west"},
+			{SiteID: site.ID, StatusCode: 0, IsUp: false, ErrorMessage: "timeout", CheckedAt: start.Add(time.Minute), Location: "eu-west"},
+			{SiteID: site.ID, StatusCode: 200, ResponseTime: 50, IsUp: true, CheckedAt: start, Location: "us-east"},
+		})
+		if err != nil {
+			t.Fatalf("inserting location checks: %v", err)
+		}
+
+		latest, err := store.Checks.LatestByLocation(ctx, start.Add(-time.Minute))
+		if err != nil {
+			t.Fatalf("getting the latest location checks: %v", err)
+		}
+		results := latest[site.ID]
+		if len(results) != 2 {
+			t.Fatalf("got %d latest results, want one per location", len(results))
+		}
+		for _, check := range results {
+			if check.Location == "eu-west" && (check.IsUp || !check.CheckedAt.Equal(start.Add(time.Minute))) {
+				t.Errorf("latest eu-west result %+v, want the failed check", check)
+			}
+		}
+
+		stats, err := store.Checks.LocationStats(ctx, site.ID, start.Add(-time.Minute))
+		if err != nil {
+			t.Fatalf("getting location stats: %v", err)
+		}
+		if len(stats) != 2 || stats[0].Location != "eu-west" || stats[1].Location != "us-east" {
+			t.Fatalf("got stats %+v, want eu-west and us-east", stats)
+		}
+		if stats[0].TotalChecks != 2 || stats[0].SuccessfulChecks != 1 || stats[0].UptimePercentage != 50 {
+			t.Errorf("eu-west stats %+v, want 1 of 2 checks up", stats[0])
+		}
+	})
+}
+
+func TestDomains(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store *storage.Store) {
+		ctx := context.Background()
+		alice := createUser(t, store, "alice")
+		bob := createUser(t, store, "bob")
+
+		domain, err := store.Domains.Create(ctx, alice.ID, "status.example.com")
+		if err != nil {
+			t.Fatalf("creating domain: %v", err)
+		}
+		if domain.Verified {
+			t.Error("new domain is verified")
+		}
+		if _, err := store.Domains.Create(ctx, bob.ID, "status.example.com"); !errors.Is(err, storage.ErrConflict) {
+			t.Errorf("creating a taken domain: got %v, want ErrConflict", err)
+		}
+		if _, err := store.Domains.Get(ctx, domain.ID, bob.ID); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("getting a domain of another user: got %v, want ErrNotFound", err)
+		}
+
+		verified, err := store.Domains.SetVerified(ctx, domain.ID, true)
+		if err != nil {
+			t.Fatalf("verifying domain: %v", err)
+		}
+		if !verified.Verified {
+			t.Error("verified domain is not verified")
+		}
+
+		byName, err := store.Domains.GetByName(ctx, "status.example.com")
+		if err != nil {
+			t.Fatalf("getting domain by name: %v", err)
+		}
+		if byName.ID != domain.ID || byName.UserID != alice.ID {
+			t.Errorf("got domain %+v, want %+v", byName, domain)
+		}
+
+		if err := store.Domains.Delete(ctx, domain.ID, alice.ID); err != nil {
+			t.Fatalf("deleting domain: %v", err)
+		}
+		domains, err := store.Domains.ListByUser(ctx, alice.ID)
+		if err != nil {
+			t.Fatalf("listing domains: %v", err)
+		}
+		if len(domains) != 0 {
+			t.Errorf("listed %d domains after deleting the only one", len(domains))
+		}
+	})
+}
+
+func TestInTx(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store *storage.Store) {
+		ctx := context.Background()
+		alice := createUser(t, store, "alice")
+		failed := errors.New("failed")
+
+		// A failing transaction leaves nothing behind
+		err := store.InTx(ctx, func(tx storage.Tx) error {
+			if _, err := tx.Sites.Create(ctx, alice.ID, models.SiteCreation{Name: "rolled-back", URL: "https://rolled-back.example.com"}); err != nil {
+				return err
+			}
+			if _, err := tx.Domains.Create(ctx, alice.ID, "rolled-back.example.com"); err != nil {
+				return err
+			}
+			return failed
+		})
+		if !errors.Is(err, failed) {
+			t.Fatalf("failing transaction: got %v, want %v", err, failed)
+		}
+		sites, err := store.Sites.ListByUser(ctx, alice.ID)
+		if err != nil {
+			t.Fatalf("listing sites: %v", err)
+		}
+		domains, err := store.Domains.ListByUser(ctx, alice.ID)
+		if err != nil {
+			t.Fatalf("listing domains: %v", err)
+		}
+		if len(sites) != 0 || len(domains) != 0 {
+			t.Errorf("rolled back transaction left %d sites and %d domains", len(sites), len(domains))
+		}
+
+		// A successful one keeps every change
+		timezone := "Europe/Paris"
+		err = store.InTx(ctx, func(tx storage.Tx) error {
+			if _, err := tx.Sites.Create(ctx, alice.ID, models.SiteCreation{Name: "committed", URL: "https://committed.example.com"}); err != nil {
+				return err
+			}
+			_, err := tx.Users.Update(ctx, alice.ID, storage.UserUpdate{Timezone: &timezone})
+			return err
+		})
+		if err != nil {
+			t.Fatalf("committing transaction: %v", err)
+		}
+		sites, err = store.Sites.ListByUser(ctx, alice.ID)
+		if err != nil {
+			t.Fatalf("listing sites: %v", err)
+		}
+		user, err := store.Users.Get(ctx, alice.ID)
+		if err != nil {
+			t.Fatalf("getting user: %v", err)
+		}
+		if len(sites) != 1 || user.Timezone != timezone {
+			t.Errorf("committed transaction left %d sites and timezone %q", len(sites), user.Timezone)
+		}
+	})
+}
+
+func TestProbes(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store *storage.Store) {
+		ctx := context.Background()
+
+		probe, err := store.Probes.Register(ctx, models.ProbeRegistration{Name: "p1", Location: "eu-west"}, "hash1")
+		if err != nil {
+			t.Fatalf("registering probe: %v", err)
+		}
+		if probe.LastSeenAt == nil {
+			t.Error("registering did not mark the probe as seen")
+		}
+		if _, err := store.Probes.Register(ctx, models.ProbeRegistration{Name: "p1", Location: "us-east"}, "hash2"); !errors.Is(err, storage.ErrConflict) {
+			t.Errorf("registering a taken name: got %v, want ErrConflict", err)
+		}
+
+		got, err := store.Probes.GetByTokenHash(ctx, "hash1")
+		if err != nil {
+			t.Fatalf("getting probe by token: %v", err)
+		}
+		if got.ID != probe.ID || got.Location != "eu-west" {
+			t.Errorf("got probe %+v, want %+v", got, probe)
+		}
+		if _, err := store.Probes.GetByTokenHash(ctx, "unknown"); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("getting a probe by an unknown token: got %v, want ErrNotFound", err)
+		}
+
+		if err := store.Probes.MarkSeen(ctx, probe.ID); err != nil {
+			t.Fatalf("marking probe as seen: %v", err)
+		}
+		probes, err := store.Probes.List(ctx)
+		if err != nil {
+			t.Fatalf("listing probes: %v", err)
+		}
+		if len(probes) != 1 || probes[0].LastSeenAt == nil {
+			t.Errorf("listed %+v, want the probe marked as seen", probes)
+		}
+
+		if err := store.Probes.Delete(ctx, probe.ID); err != nil {
+			t.Fatalf("deleting probe: %v", err)
+		}
+		if err := store.Probes.Delete(ctx, probe.ID); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("deleting a deleted probe: got %v, want ErrNotFound", err)
+		}
+	})
+}
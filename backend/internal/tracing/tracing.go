@@ -0,0 +1,57 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/abstractmelon/is-site-live/internal/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// ServiceName is the default service name of the traces, overridden by
+// OTEL_SERVICE_NAME
+const ServiceName = "is-site-live"
+
+// Setup installs the global tracer provider exporting spans over OTLP/HTTP.
+// The exporter reads the standard OTEL_EXPORTER_OTLP_* variables, e.g. for
+// headers or TLS. Spans are dropped when no endpoint is configured. The
+// returned function flushes the remaining spans on shutdown.
+func Setup(cfg config.TracingConfig) (func(context.Context) error, error) {
+	// Propagate W3C trace context, e.g. to sites opting in to it
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	if cfg.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("unable to create OTLP exporter: %v", err)
+	}
+
+	// Settings from the environment take precedence over the default name
+	res, err := resource.New(context.Background(),
+		resource.WithAttributes(semconv.ServiceName(ServiceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create trace resource: %v", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
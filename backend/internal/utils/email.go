@@ -2,6 +2,7 @@ package utils
 
 import (
 	"fmt"
+	"log/slog"
 	"net/http"
 	"strconv"
 
@@ -11,79 +12,64 @@ import (
 
 // EmailSender handles sending emails
 type EmailSender struct {
-	config config.SMTPConfig
+	config    config.SMTPConfig
+	templates map[string]*emailTemplate
 }
 
-// NewEmailSender creates a new email sender
+// NewEmailSender creates a new email sender. Templates that fail to load
+// from the override directory fall back to the embedded defaults; use
+// CheckEmailTemplates to catch such errors at startup.
 func NewEmailSender(config config.SMTPConfig) *EmailSender {
+	templates, err := loadEmailTemplates(config.TemplateDir)
+	if err != nil {
+		slog.Warn("Error loading email templates, using defaults", "error", err)
+		templates, err = loadEmailTemplates("")
+		if err != nil {
+			panic(fmt.Sprintf("invalid default email templates: %v", err))
+		}
+	}
+
 	return &EmailSender{
-		config: config,
+		config:    config,
+		templates: templates,
 	}
 }
 
-// SendDowntimeAlert sends a downtime alert email
-func (e *EmailSender) SendDowntimeAlert(to, username, siteName, siteURL string, statusCode int, errorMessage string) error {
+// Configured reports whether SMTP settings are present
+func (e *EmailSender) Configured() bool {
+	return e.config.Host != "" && e.config.User != "" && e.config.Password != "" && e.config.From != ""
+}
+
+// Send renders a template and sends it as a multipart/alternative email with
+// plain-text and HTML parts
+func (e *EmailSender) Send(to, templateName string, data interface{}, headers map[string]string) error {
 	// Check if SMTP is configured
-	if e.config.Host == "" || e.config.User == "" || e.config.Password == "" || e.config.From == "" {
+	if !e.Configured() {
 		return fmt.Errorf("SMTP not configured")
 	}
 
-	// Create message
-	m := gomail.NewMessage()
-	m.SetHeader("From", e.config.From)
-	m.SetHeader("To", to)
-	m.SetHeader("Subject", fmt.Sprintf("Downtime Alert: %s is down", siteName))
-
-	// Create email body
-	body := fmt.Sprintf(`
-		<h2>Downtime Alert</h2>
-		<p>Hello %s,</p>
-		<p>Your site <strong>%s</strong> is currently down.</p>
-		<p><strong>URL:</strong> %s</p>
-		<p><strong>Status Code:</strong> %s</p>
-		<p><strong>Error:</strong> %s</p>
-		<p>We'll notify you when the site is back up.</p>
-		<p>Regards,<br>Is It Live Monitoring</p>
-	`, username, siteName, siteURL, getStatusCodeText(statusCode), errorMessage)
-
-	m.SetBody("text/html", body)
-
-	// Create dialer
-	d := gomail.NewDialer(e.config.Host, e.config.Port, e.config.User, e.config.Password)
-
-	// Send email
-	if err := d.DialAndSend(m); err != nil {
-		return fmt.Errorf("failed to send email: %v", err)
+	// Render the email
+	tmpl, ok := e.templates[templateName]
+	if !ok {
+		return fmt.Errorf("unknown email template %q", templateName)
 	}
-
-	return nil
-}
-
-// SendRecoveryAlert sends a recovery alert email
-func (e *EmailSender) SendRecoveryAlert(to, username, siteName, siteURL string, statusCode int, downtime string) error {
-	// Check if SMTP is configured
-	if e.config.Host == "" || e.config.User == "" || e.config.Password == "" || e.config.From == "" {
-		return fmt.Errorf("SMTP not configured")
+	email, err := tmpl.render(data)
+	if err != nil {
+		return fmt.Errorf("failed to render %s email: %v", templateName, err)
 	}
 
 	// Create message
 	m := gomail.NewMessage()
 	m.SetHeader("From", e.config.From)
 	m.SetHeader("To", to)
-	m.SetHeader("Subject", fmt.Sprintf("Recovery Alert: %s is back up", siteName))
-
-	// Create email body
-	body := fmt.Sprintf(`
-		<h2>Recovery Alert</h2>
-		<p>Hello %s,</p>
-		<p>Good news! Your site <strong>%s</strong> is back up.</p>
-		<p><strong>URL:</strong> %s</p>
-		<p><strong>Status Code:</strong> %s</p>
-		<p><strong>Downtime Duration:</strong> %s</p>
-		<p>Regards,<br>Is It Live Monitoring</p>
-	`, username, siteName, siteURL, getStatusCodeText(statusCode), downtime)
+	m.SetHeader("Subject", email.Subject)
+	for name, value := range headers {
+		m.SetHeader(name, value)
+	}
 
-	m.SetBody("text/html", body)
+	// The plain-text part comes first so clients prefer the HTML part
+	m.SetBody("text/plain", email.Text)
+	m.AddAlternative("text/html", email.HTML)
 
 	// Create dialer
 	d := gomail.NewDialer(e.config.Host, e.config.Port, e.config.User, e.config.Password)
@@ -96,8 +82,8 @@ func (e *EmailSender) SendRecoveryAlert(to, username, siteName, siteURL string,
 	return nil
 }
 
-// getStatusCodeText returns a human-readable status code text
-func getStatusCodeText(statusCode int) string {
+// StatusCodeText returns a human-readable status code text
+func StatusCodeText(statusCode int) string {
 	if statusCode == 0 {
 		return "Connection Failed"
 	}
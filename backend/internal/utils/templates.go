@@ -0,0 +1,231 @@
+package utils
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/abstractmelon/is-site-live/internal/models"
+)
+
+// Email template names. Each name has a <name>.html.tmpl and a
+// <name>.txt.tmpl template; the text template also defines the "subject".
+const (
+	TemplateDowntime         = "downtime"
+	TemplateRecovery         = "recovery"
+	TemplateFlapping         = "flapping"
+	TemplateRateLimitSummary = "rate_limit_summary"
+	TemplateDigest           = "digest"
+	TemplateErrorBudget      = "error_budget"
+)
+
+// templateNames lists every email template
+var templateNames = []string{
+	TemplateDowntime,
+	TemplateRecovery,
+	TemplateFlapping,
+	TemplateRateLimitSummary,
+	TemplateDigest,
+	TemplateErrorBudget,
+}
+
+//go:embed templates/*.tmpl
+var defaultTemplates embed.FS
+
+// templateFuncs are the helper functions available to email templates
+var templateFuncs = map[string]interface{}{
+	"formatTime": func(t time.Time) string {
+		return t.UTC().Format(time.RFC1123)
+	},
+	"incidentDuration": func(incident models.Incident) string {
+		if incident.ResolvedAt == nil {
+			return ""
+		}
+		return incident.ResolvedAt.Sub(incident.StartedAt).Round(time.Second).String()
+	},
+}
+
+// emailTemplate is the parsed HTML and plain-text version of an email
+type emailTemplate struct {
+	html *htmltemplate.Template
+	text *texttemplate.Template
+}
+
+// renderedEmail is an email ready to be sent
+type renderedEmail struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// DowntimeData is the data available to the downtime templates
+type DowntimeData struct {
+	Username     string
+	SiteName     string
+	SiteURL      string
+	StatusText   string
+	ErrorMessage string
+	AckURL       string
+}
+
+// RecoveryData is the data available to the recovery templates
+type RecoveryData struct {
+	Username   string
+	SiteName   string
+	SiteURL    string
+	StatusText string
+	Downtime   string
+}
+
+// FlappingData is the data available to the flapping templates
+type FlappingData struct {
+	Username string
+	SiteName string
+	SiteURL  string
+	Flapping bool
+	IsUp     bool
+	Percent  float64
+}
+
+// RateLimitSummaryData is the data available to the rate limit summary templates
+type RateLimitSummaryData struct {
+	Username string
+	Dropped  int
+	Window   time.Duration
+}
+
+// DigestData is the data available to the digest templates
+type DigestData struct {
+	Digest         *models.Digest
+	UnsubscribeURL string
+}
+
+// ErrorBudgetData is the data available to the error budget templates
+type ErrorBudgetData struct {
+	Username          string
+	SiteName          string
+	SiteURL           string
+	Target            float64
+	Window            string
+	BurnRate          float64
+	Threshold         float64
+	Remaining         float64 // percentage of the error budget left
+	ProjectedBreachAt *time.Time
+}
+
+// DecodeTemplateData decodes the JSON encoded data of a template into the
+// data type the template expects
+func DecodeTemplateData(templateName string, payload []byte) (interface{}, error) {
+	var data interface{}
+	switch templateName {
+	case TemplateDowntime:
+		data = &DowntimeData{}
+	case TemplateRecovery:
+		data = &RecoveryData{}
+	case TemplateFlapping:
+		data = &FlappingData{}
+	case TemplateRateLimitSummary:
+		data = &RateLimitSummaryData{}
+	case TemplateDigest:
+		data = &DigestData{}
+	case TemplateErrorBudget:
+		data = &ErrorBudgetData{}
+	default:
+		return nil, fmt.Errorf("unknown email template %q", templateName)
+	}
+
+	if err := json.Unmarshal(payload, data); err != nil {
+		return nil, fmt.Errorf("failed to decode %s data: %v", templateName, err)
+	}
+	return data, nil
+}
+
+// CheckEmailTemplates reports whether the email templates, including any
+// overrides in dir, parse correctly
+func CheckEmailTemplates(dir string) error {
+	_, err := loadEmailTemplates(dir)
+	return err
+}
+
+// loadEmailTemplates parses the embedded email templates, replacing any of
+// them with the file of the same name in dir if dir is set
+func loadEmailTemplates(dir string) (map[string]*emailTemplate, error) {
+	templates := make(map[string]*emailTemplate, len(templateNames))
+	for _, name := range templateNames {
+		htmlSource, err := readTemplate(dir, name+".html.tmpl")
+		if err != nil {
+			return nil, err
+		}
+		textSource, err := readTemplate(dir, name+".txt.tmpl")
+		if err != nil {
+			return nil, err
+		}
+
+		htmlTemplate, err := htmltemplate.New(name).Funcs(templateFuncs).Parse(htmlSource)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s.html.tmpl: %v", name, err)
+		}
+		textTemplate, err := texttemplate.New(name).Funcs(templateFuncs).Parse(textSource)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s.txt.tmpl: %v", name, err)
+		}
+		if textTemplate.Lookup("subject") == nil {
+			return nil, fmt.Errorf("%s.txt.tmpl does not define a subject", name)
+		}
+
+		templates[name] = &emailTemplate{html: htmlTemplate, text: textTemplate}
+	}
+
+	return templates, nil
+}
+
+// readTemplate reads a template from the override directory, falling back to
+// the embedded default
+func readTemplate(dir, file string) (string, error) {
+	if dir != "" {
+		source, err := os.ReadFile(filepath.Join(dir, file))
+		if err == nil {
+			return string(source), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", fmt.Errorf("failed to read template %s: %v", file, err)
+		}
+	}
+
+	source, err := defaultTemplates.ReadFile("templates/" + file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read default template %s: %v", file, err)
+	}
+	return string(source), nil
+}
+
+// render executes an email template
+func (t *emailTemplate) render(data interface{}) (*renderedEmail, error) {
+	var subject, text, html bytes.Buffer
+
+	if err := t.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, fmt.Errorf("failed to render subject: %v", err)
+	}
+	if err := t.text.Execute(&text, data); err != nil {
+		return nil, fmt.Errorf("failed to render text body: %v", err)
+	}
+	if err := t.html.Execute(&html, data); err != nil {
+		return nil, fmt.Errorf("failed to render HTML body: %v", err)
+	}
+
+	return &renderedEmail{
+		// Keep user-controlled values from injecting extra headers
+		Subject: strings.Join(strings.Fields(subject.String()), " "),
+		Text:    text.String(),
+		HTML:    html.String(),
+	}, nil
+}
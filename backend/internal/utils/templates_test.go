@@ -0,0 +1,196 @@
+package utils
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abstractmelon/is-site-live/internal/models"
+)
+
+// update rewrites the golden files with the rendered emails
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+func TestEmailTemplatesGolden(t *testing.T) {
+	started := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	resolved := started.Add(95 * time.Minute)
+	breach := time.Date(2024, 3, 20, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		template string
+		data     interface{}
+	}{
+		{
+			name:     "downtime",
+			template: TemplateDowntime,
+			data: DowntimeData{
+				Username:     "alice",
+				SiteName:     "Example",
+				SiteURL:      "https://example.com",
+				StatusText:   "HTTP 503",
+				ErrorMessage: "Service Unavailable",
+				AckURL:       "https://isitlive.example/incidents/7/ack?token=abc",
+			},
+		},
+		{
+			name:     "downtime_escaped",
+			template: TemplateDowntime,
+			data: DowntimeData{
+				Username:     "alice",
+				SiteName:     `<script>alert("x")</script>`,
+				SiteURL:      "https://example.com/?q=<b>",
+				StatusText:   "HTTP 500",
+				ErrorMessage: "<img src=x onerror=alert(1)>",
+			},
+		},
+		{
+			name:     "recovery",
+			template: TemplateRecovery,
+			data: RecoveryData{
+				Username:   "alice",
+				SiteName:   "Example",
+				SiteURL:    "https://example.com",
+				StatusText: "HTTP 200",
+				Downtime:   "1h35m0s",
+			},
+		},
+		{
+			name:     "flapping",
+			template: TemplateFlapping,
+			data: FlappingData{
+				Username: "alice",
+				SiteName: "Example",
+				SiteURL:  "https://example.com",
+				Flapping: true,
+				IsUp:     false,
+				Percent:  42.5,
+			},
+		},
+		{
+			name:     "rate_limit_summary",
+			template: TemplateRateLimitSummary,
+			data: RateLimitSummaryData{
+				Username: "alice",
+				Dropped:  12,
+				Window:   time.Hour,
+			},
+		},
+		{
+			name:     "digest",
+			template: TemplateDigest,
+			data: DigestData{
+				Digest: &models.Digest{
+					Username:  "alice",
+					Frequency: models.DigestDaily,
+					From:      started.Add(-24 * time.Hour),
+					To:        started,
+					Sites: []models.SiteDigest{
+						{
+							Name: "Example",
+							URL:  "https://example.com",
+							Stats: models.UptimeStats{
+								TotalChecks:         1440,
+								SuccessfulChecks:    1420,
+								UptimePercentage:    98.61,
+								AverageResponseTime: 230,
+							},
+							Incidents: []models.Incident{
+								{ID: 7, SiteID: 1, StartedAt: started.Add(-3 * time.Hour), ResolvedAt: &resolved},
+								{ID: 8, SiteID: 1, StartedAt: started.Add(-time.Hour)},
+							},
+							SlowestPeriods: []models.SlowPeriod{
+								{Start: started.Add(-5 * time.Hour), AverageResponseTime: 1200},
+							},
+							CertExpiresAt: &breach,
+						},
+					},
+				},
+				UnsubscribeURL: "https://isitlive.example/digests/unsubscribe?token=abc",
+			},
+		},
+		{
+			name:     "error_budget",
+			template: TemplateErrorBudget,
+			data: ErrorBudgetData{
+				Username:          "alice",
+				SiteName:          "Example",
+				SiteURL:           "https://example.com",
+				Target:            99.9,
+				Window:            models.SLOWindowRolling30d,
+				BurnRate:          14.4,
+				Threshold:         10,
+				Remaining:         37.5,
+				ProjectedBreachAt: &breach,
+			},
+		},
+	}
+
+	templates, err := loadEmailTemplates("")
+	if err != nil {
+		t.Fatalf("loading templates: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			email, err := templates[tt.template].render(tt.data)
+			if err != nil {
+				t.Fatalf("rendering: %v", err)
+			}
+
+			checkGolden(t, tt.name+".html.golden", email.HTML)
+			checkGolden(t, tt.name+".txt.golden", "Subject: "+email.Subject+"\n\n"+email.Text)
+		})
+	}
+}
+
+func TestEmailTemplatesEscapeHTML(t *testing.T) {
+	templates, err := loadEmailTemplates("")
+	if err != nil {
+		t.Fatalf("loading templates: %v", err)
+	}
+
+	email, err := templates[TemplateDowntime].render(DowntimeData{
+		SiteName:     "<script>alert(1)</script>",
+		ErrorMessage: "<img src=x>",
+	})
+	if err != nil {
+		t.Fatalf("rendering: %v", err)
+	}
+
+	if strings.Contains(email.HTML, "<script>") || strings.Contains(email.HTML, "<img") {
+		t.Errorf("HTML body contains unescaped markup:\n%s", email.HTML)
+	}
+	if !strings.Contains(email.HTML, "&lt;script&gt;") {
+		t.Errorf("HTML body does not contain the escaped site name:\n%s", email.HTML)
+	}
+	// The text part is plain text and keeps the name as is
+	if !strings.Contains(email.Text, "<script>alert(1)</script>") {
+		t.Errorf("text body does not contain the site name:\n%s", email.Text)
+	}
+}
+
+// checkGolden compares got with a golden file in testdata, rewriting the file
+// instead with -update
+func checkGolden(t *testing.T, file, got string) {
+	t.Helper()
+
+	path := filepath.Join("testdata", file)
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatalf("writing %s: %v", path, err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading %s: %v", path, err)
+	}
+	if got != string(want) {
+		t.Errorf("%s differs from the golden file:\n--- got\n%s\n--- want\n%s", file, got, want)
+	}
+}